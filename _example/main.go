@@ -22,6 +22,13 @@ func main() {
 	http.HandleFunc("/sub", func(w http.ResponseWriter, r *http.Request) { pubsubsse.Subscribe(ssePubSub, w, r) })                      // Subscribe endpoint
 	http.HandleFunc("/unsub", func(w http.ResponseWriter, r *http.Request) { pubsubsse.Unsubscribe(ssePubSub, w, r) })                  // Unsubscribe endpoint
 	http.HandleFunc("/event", func(w http.ResponseWriter, r *http.Request) { pubsubsse.Event(ssePubSub, w, r) })                        // Event SSE endpoint
+	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) { pubsubsse.WebSocket(ssePubSub, w, r) })                       // WebSocket endpoint
+	http.HandleFunc("/poll", func(w http.ResponseWriter, r *http.Request) { pubsubsse.LongPoll(ssePubSub, w, r) })                      // Long-polling endpoint
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) { pubsubsse.Metrics(ssePubSub, w, r) })                    // Prometheus metrics endpoint
+
+	// Or mount all endpoints with proper HTTP verbs at once
+	http.Handle("/api/", ssePubSub.Handler(pubsubsse.HandlerOptions{Prefix: "/api"}))
+
 	go func() {
 		log.Fatal(http.ListenAndServe(":8080", nil)) // Start http server
 	}()
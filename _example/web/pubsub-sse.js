@@ -16,12 +16,14 @@ class PubSubSSE {
         this.url = url;
         this.evtSource = null;
         this.topics = {}; // Stores Topic objects
+        this.patterns = new Set(); // Stores subscribed patterns
 
         this.onConnected = null;
         this.onDisconnected = null;
         this.onError = null;
         this.onNewTopic = null;
         this.onRemovedTopic = null;
+        this.onShutdown = null;
     }
 
     open() {
@@ -47,6 +49,12 @@ class PubSubSSE {
             this.handleUpdateMessages(data.updates);
         };
 
+        // Sys messages in the named events wire format
+        this.evtSource.addEventListener("sys", (e) => {
+            const data = JSON.parse(e.data);
+            this.handleSysMessages(data.sys);
+        });
+
         this.evtSource.onerror = () => {
             console.log("EventSource failed.");
             if (this.onError) {
@@ -71,6 +79,10 @@ class PubSubSSE {
             //   "topics": List of topics
             //   "subscribed": List of subscribed topics
             //   "unsubscribed": List of unsubscribed topics
+            //   "subscribed_patterns": List of subscribed patterns
+            //   "unsubscribed_patterns": List of unsubscribed patterns
+            //   "ping": Heartbeat of the server, nothing to do
+            //   "shutdown": The server shuts down, retry is the reconnect hint in milliseconds
 
             if (type === "topics") {
                 let removedTopicsList = sysData.list;
@@ -104,6 +116,15 @@ class PubSubSSE {
                         topic.subscribed = false; // Mark as unsubscribed
                     }
                 });
+            } else if (type === "subscribed_patterns") {
+                sysData.list.forEach(patternInfo => this.patterns.add(patternInfo.name));
+            } else if (type === "unsubscribed_patterns") {
+                sysData.list.forEach(patternInfo => this.patterns.delete(patternInfo.name));
+            } else if (type === "shutdown") {
+                // EventSource reconnects by itself after the retry directive the server sent
+                // and resumes with the Last-Event-ID, so the connection is not closed here
+                console.log("Server shuts down, reconnecting in " + (sysData.retry || "the default") + " ms.");
+                this.onShutdown?.(sysData.retry);
             }
         });
     }
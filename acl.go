@@ -0,0 +1,161 @@
+package pubsubsse
+
+import (
+	"sort"
+)
+
+// TopicACL lists who may see and subscribe to a topic.
+// A client is allowed if its ID, one of its groups or one of its roles is listed.
+// An empty ACL allows nobody.
+type TopicACL struct {
+	Clients []string `json:"clients,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+}
+
+// Create a copy of the ACL
+func (a *TopicACL) copy() *TopicACL {
+	if a == nil {
+		return nil
+	}
+	return &TopicACL{
+		Clients: append([]string{}, a.Clients...),
+		Groups:  append([]string{}, a.Groups...),
+		Roles:   append([]string{}, a.Roles...),
+	}
+}
+
+// Check if the ACL allows the client
+func (a *TopicACL) allows(c *Client) bool {
+	id := c.GetID()
+	for _, allowed := range a.Clients {
+		if allowed == id {
+			return true
+		}
+	}
+
+	if len(a.Groups) > 0 {
+		groups := c.GetGroups()
+		for _, allowed := range a.Groups {
+			if _, ok := groups[allowed]; ok {
+				return true
+			}
+		}
+	}
+
+	for _, allowed := range a.Roles {
+		if c.HasRole(allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the ACL of the topic. nil means everyone who can see the topic may subscribe.
+func (t *Topic) GetACL() *TopicACL {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.acl.copy()
+}
+
+// Set the ACL of the topic. nil removes the ACL.
+// The ACL applies to the subtopics as well.
+// 1. Set the ACL
+// 2. Unsubscribe the clients which are not allowed anymore
+// 3. Inform the clients about the topics they can see now
+// 4. Inform the other instances about the new ACL
+func (t *Topic) SetACL(acl *TopicACL) {
+	t.lock.Lock()
+	t.acl = acl.copy()
+	t.lock.Unlock()
+
+	t.enforceACL()
+	t.publishBackplaneOptions()
+}
+
+// Unsubscribe the clients which are not allowed by the ACL anymore and send the topic lists
+func (t *Topic) enforceACL() {
+	// Unsubscribe the clients which are not allowed anymore
+	for _, topic := range append([]*Topic{t}, t.getChildren()...) {
+		for _, c := range topic.GetClients() {
+			if topic.canAccess(c) {
+				continue
+			}
+			if err := c.Unsub(topic); err != nil {
+				t.logger().Error("Error unsubscribing client", logKeyClientID, c.GetID(), logKeyTopic, topic.GetName(), logKeyError, err)
+			}
+		}
+	}
+
+	// Inform the clients about the topics they can see now
+	for _, c := range t.getScopeClients() {
+		if err := c.sendTopicList(); err != nil {
+			c.logger().Error("Error sending topic list to client", logKeyClientID, c.GetID(), logKeyError, err)
+		}
+	}
+}
+
+// Check if the client may see and subscribe to the topic.
+// The ACLs of all parent topics have to allow the client as well.
+func (t *Topic) canAccess(c *Client) bool {
+	for _, topic := range append([]*Topic{t}, t.getParents()...) {
+		topic.lock.Lock()
+		acl := topic.acl
+		topic.lock.Unlock()
+
+		if acl != nil && !acl.allows(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Get the roles of the client
+func (c *Client) GetRoles() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	roles := make([]string, 0, len(c.roles))
+	for r := range c.roles {
+		roles = append(roles, r)
+	}
+	sort.Strings(roles)
+
+	return roles
+}
+
+// Set the roles of the client. They replace the previous roles.
+// The client is informed about the topics it can see now.
+func (c *Client) SetRoles(roles ...string) {
+	c.lock.Lock()
+	c.roles = make(map[string]struct{}, len(roles))
+	for _, r := range roles {
+		c.roles[r] = struct{}{}
+	}
+	c.lock.Unlock()
+
+	if err := c.sendTopicList(); err != nil {
+		c.logger().Error("Error sending topic list to client", logKeyClientID, c.GetID(), logKeyError, err)
+	}
+}
+
+// Check if the client has the role
+func (c *Client) HasRole(role string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, ok := c.roles[role]
+	return ok
+}
+
+// Get all topics the client can see
+func (c *Client) getVisibleTopics() map[string]*Topic {
+	topics := c.GetAllTopics()
+	for name, t := range topics {
+		if !t.canAccess(c) {
+			delete(topics, name)
+		}
+	}
+	return topics
+}
@@ -0,0 +1,164 @@
+package pubsubsse
+
+import (
+	"errors"
+	"testing"
+)
+
+// Tests for:
+// +SetACL(acl *TopicACL)
+// +GetACL(): *TopicACL
+// +SetRoles(roles ...string)
+// +GetRoles(): []string
+// +HasRole(role string): bool
+// -canAccess(c *Client): bool
+// -getVisibleTopics(): map[string]*Topic
+
+// Get the names of the last topic list sent to the client
+func lastTopicList(data []eventData) map[string]bool {
+	var names map[string]bool
+	for _, d := range data {
+		for _, sys := range d.Sys {
+			if sys.Type != "topics" {
+				continue
+			}
+			names = map[string]bool{}
+			for _, l := range sys.List {
+				names[l.Name] = true
+			}
+		}
+	}
+	return names
+}
+
+func TestTopic_SetACL_Sub(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("admin")
+
+	allowed := ssePubSub.NewClient()
+	denied := ssePubSub.NewClient()
+	topic.SetACL(&TopicACL{Clients: []string{allowed.GetID()}})
+
+	if err := allowed.Sub(topic); err != nil {
+		t.Errorf("Expected allowed client to subscribe, got %s", err)
+	}
+
+	// The topic is hidden like an unknown topic
+	err := denied.Sub(topic)
+	if !errors.Is(err, ErrTopicNotFound) {
+		t.Fatalf("Expected ErrTopicNotFound, got %v", err)
+	}
+	if unknown := denied.Sub(NewSSEPubSubService().NewPublicTopic("admin")); err.Error() != unknown.Error() {
+		t.Errorf("Expected the error of an unknown topic %q, got %q", unknown, err)
+	}
+
+	// The ACL is copied
+	acl := topic.GetACL()
+	acl.Clients[0] = denied.GetID()
+	if topic.GetACL().Clients[0] != allowed.GetID() {
+		t.Error("GetACL returned the internal ACL")
+	}
+
+	// Without ACL everyone can subscribe
+	topic.SetACL(nil)
+	if err := denied.Sub(topic); err != nil {
+		t.Errorf("Expected client to subscribe without ACL, got %s", err)
+	}
+}
+
+func TestTopic_SetACL_GroupsAndRoles(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("staff")
+	topic.SetACL(&TopicACL{Groups: []string{"moderators"}, Roles: []string{"admin"}})
+
+	member := ssePubSub.NewClient()
+	ssePubSub.NewGroup("moderators").AddClient(member)
+	if err := member.Sub(topic); err != nil {
+		t.Errorf("Expected group member to subscribe, got %s", err)
+	}
+
+	admin := ssePubSub.NewClient()
+	if err := admin.Sub(topic); !errors.Is(err, ErrTopicNotFound) {
+		t.Errorf("Expected ErrTopicNotFound without role, got %v", err)
+	}
+	admin.SetRoles("admin", "user")
+	if !admin.HasRole("admin") || len(admin.GetRoles()) != 2 {
+		t.Errorf("Unexpected roles %v", admin.GetRoles())
+	}
+	if err := admin.Sub(topic); err != nil {
+		t.Errorf("Expected admin to subscribe, got %s", err)
+	}
+}
+
+func TestTopic_SetACL_Unsubscribes(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	client.Sub(topic)
+
+	topic.SetACL(&TopicACL{})
+
+	if topic.IsSubscribed(client) {
+		t.Error("Client is still subscribed after it was removed from the ACL")
+	}
+	if len(topic.GetClients()) != 0 {
+		t.Error("Client was not removed from the topic")
+	}
+}
+
+func TestTopic_ACL_Pub(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	parent := ssePubSub.NewPublicTopic("chat")
+	child := ssePubSub.NewPublicTopic("chat/secret")
+	child.SetACL(&TopicACL{Roles: []string{"vip"}})
+
+	vip := ssePubSub.NewClient()
+	vip.SetRoles("vip")
+	other := ssePubSub.NewClient()
+	pattern := ssePubSub.NewClient()
+
+	setReceiving(vip)
+	setReceiving(other)
+	setReceiving(pattern)
+	vip.Sub(parent)
+	other.Sub(parent)
+	pattern.SubPattern("chat/#")
+	drainStream(t, vip)
+	drainStream(t, other)
+	drainStream(t, pattern)
+
+	<-child.PubAsync("hidden")
+
+	if len(getUpdates(drainStream(t, vip), "chat/secret")) != 1 {
+		t.Error("Allowed client did not receive the update")
+	}
+	if len(getUpdates(drainStream(t, other), "chat/secret")) != 0 {
+		t.Error("Subscriber of the parent received the update of a topic it is not allowed to see")
+	}
+	if len(getUpdates(drainStream(t, pattern), "chat/secret")) != 0 {
+		t.Error("Pattern subscriber received the update of a topic it is not allowed to see")
+	}
+}
+
+func TestClient_sendTopicList_ACL(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	setReceiving(client)
+
+	ssePubSub.NewPublicTopic("public")
+	secret := ssePubSub.NewPublicTopic("secret")
+	ssePubSub.NewPublicTopic("secret/sub")
+	secret.SetACL(&TopicACL{Roles: []string{"admin"}})
+
+	names := lastTopicList(drainStream(t, client))
+	if !names["public"] || names["secret"] || names["secret/sub"] {
+		t.Errorf("Expected only public in topic list, got %v", names)
+	}
+
+	// The topic list is updated when the roles change
+	client.SetRoles("admin")
+	names = lastTopicList(drainStream(t, client))
+	if !names["public"] || !names["secret"] || !names["secret/sub"] {
+		t.Errorf("Expected all topics in topic list, got %v", names)
+	}
+}
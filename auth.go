@@ -0,0 +1,386 @@
+package pubsubsse
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AuthAction is the action a request wants to perform.
+type AuthAction string
+
+const (
+	// Create a new client (AddClient)
+	ActionCreateClient AuthAction = "create_client"
+	// Create a public or private topic (AddPublicTopic, AddPrivateTopic)
+	ActionCreateTopic AuthAction = "create_topic"
+	// Subscribe or unsubscribe a topic or pattern (Subscribe, Unsubscribe)
+	ActionSubscribe AuthAction = "subscribe"
+	// Connect the event stream of a client (Event)
+	ActionConnect AuthAction = "connect"
+	// Remove a client (RemoveClient)
+	ActionRemoveClient AuthAction = "remove_client"
+	// Remove a public or private topic (RemovePublicTopic, RemovePrivateTopic)
+	ActionRemoveTopic AuthAction = "remove_topic"
+	// Read the metrics of the service (Metrics)
+	ActionMetrics AuthAction = "metrics"
+)
+
+var (
+	// ErrUnauthorized is returned by an Authorizer if the request has no valid credentials (401).
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden is returned by an Authorizer if the credentials do not allow the action (403).
+	ErrForbidden = errors.New("forbidden")
+)
+
+// AuthRequest describes the action an HTTP request wants to perform.
+type AuthRequest struct {
+	Action AuthAction
+	// ClientID is the client_id of the request. It is empty for ActionCreateClient and public topics.
+	ClientID string
+	// Topic is the topic or pattern of the request, if any.
+	Topic string
+	// TopicType is the type of the topic to create or remove (ActionCreateTopic, ActionRemoveTopic).
+	TopicType string
+}
+
+// Authorizer decides if an HTTP request may perform an action.
+// It returns nil to allow the request. Errors wrapping ErrUnauthorized are answered with 401,
+// all other errors with 403.
+type Authorizer interface {
+	Authorize(r *http.Request, req *AuthRequest) error
+}
+
+// AuthorizerFunc is a function which implements Authorizer.
+type AuthorizerFunc func(r *http.Request, req *AuthRequest) error
+
+// Authorize calls f(r, req).
+func (f AuthorizerFunc) Authorize(r *http.Request, req *AuthRequest) error {
+	return f(r, req)
+}
+
+// ClientTokenIssuer is implemented by authorizers which bind a token to a client.
+// AddClient returns the token as client_token.
+type ClientTokenIssuer interface {
+	IssueClientToken(clientID string) (string, error)
+}
+
+// Get the authorizer
+func (s *SSEPubSubService) GetAuthorizer() Authorizer {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.authorizer
+}
+
+// Set the authorizer which is consulted by the HTTP handlers.
+// Without an authorizer all requests are allowed.
+func (s *SSEPubSubService) SetAuthorizer(a Authorizer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.authorizer = a
+}
+
+// Check the request with the authorizer of the service.
+// If it is not allowed, the error is written to the response and false is returned.
+func authorize(s *SSEPubSubService, w http.ResponseWriter, r *http.Request, req *AuthRequest) bool {
+	a := s.GetAuthorizer()
+	if a == nil {
+		return true
+	}
+
+	err := a.Authorize(r, req)
+	if err == nil {
+		return true
+	}
+
+	err = authError(err)
+	if errors.Is(err, ErrUnauthorized) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	writeError(s, w, err)
+	return false
+}
+
+// Check if the request removes a public topic. The HMAC and JWT authorizers refuse it unless it is allowed explicitly,
+// because removing a public topic unsubscribes all clients.
+func isPublicTopicRemoval(req *AuthRequest) bool {
+	return req.Action == ActionRemoveTopic && req.TopicType == string(TPublic)
+}
+
+// Errors of an authorizer which wrap neither ErrUnauthorized nor ErrForbidden are forbidden
+func authError(err error) error {
+	if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden) {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrForbidden, err)
+}
+
+// Issue a client token if the authorizer binds tokens to clients
+func issueClientToken(s *SSEPubSubService, clientID string) (string, error) {
+	issuer, ok := s.GetAuthorizer().(ClientTokenIssuer)
+	if !ok {
+		return "", nil
+	}
+	return issuer.IssueClientToken(clientID)
+}
+
+// Get the bearer token from the Authorization header.
+// EventSource can not set headers, so the access_token query parameter is used as fallback.
+func bearerToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+// AllAuthorizers combines authorizers. A request is allowed if all of them allow it.
+// The first ClientTokenIssuer issues the client tokens.
+func AllAuthorizers(authorizers ...Authorizer) Authorizer {
+	return allAuthorizers(authorizers)
+}
+
+type allAuthorizers []Authorizer
+
+func (all allAuthorizers) Authorize(r *http.Request, req *AuthRequest) error {
+	for _, a := range all {
+		if err := a.Authorize(r, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (all allAuthorizers) IssueClientToken(clientID string) (string, error) {
+	for _, a := range all {
+		if issuer, ok := a.(ClientTokenIssuer); ok {
+			return issuer.IssueClientToken(clientID)
+		}
+	}
+	return "", nil
+}
+
+// -----------------------------
+// Bearer tokens
+// -----------------------------
+
+// BearerAuthorizer allows all actions for requests with one of the static tokens.
+type BearerAuthorizer struct {
+	tokens [][]byte
+}
+
+// NewBearerAuthorizer creates an authorizer which accepts the tokens.
+func NewBearerAuthorizer(tokens ...string) *BearerAuthorizer {
+	a := &BearerAuthorizer{}
+	for _, t := range tokens {
+		a.tokens = append(a.tokens, []byte(t))
+	}
+	return a
+}
+
+// Authorize checks the bearer token of the request.
+func (a *BearerAuthorizer) Authorize(r *http.Request, req *AuthRequest) error {
+	token := []byte(bearerToken(r))
+	if len(token) == 0 {
+		return detailError(ErrUnauthorized, "missing bearer token")
+	}
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(token, t) == 1 {
+			return nil
+		}
+	}
+	return detailError(ErrUnauthorized, "invalid bearer token")
+}
+
+// -----------------------------
+// HMAC client tokens
+// -----------------------------
+
+// HMACAuthorizer binds requests to a client with a signed client token.
+// AddClient returns the token as client_token. Requests for this client
+// have to send it in the X-Client-Token header or the client_token query parameter.
+// Actions which are not bound to a client (creating clients and public topics) are allowed,
+// combine it with AllAuthorizers to restrict them. Removing public topics is refused unless
+// AllowPublicTopicRemoval is set.
+type HMACAuthorizer struct {
+	// AllowPublicTopicRemoval allows to remove public topics, e.g. if another authorizer restricts it.
+	AllowPublicTopicRemoval bool
+
+	secret []byte
+}
+
+// NewHMACAuthorizer creates an authorizer which signs client tokens with the secret.
+func NewHMACAuthorizer(secret []byte) *HMACAuthorizer {
+	return &HMACAuthorizer{secret: secret}
+}
+
+// IssueClientToken returns the token of the client.
+func (a *HMACAuthorizer) IssueClientToken(clientID string) (string, error) {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(clientID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Authorize checks the client token of the request.
+func (a *HMACAuthorizer) Authorize(r *http.Request, req *AuthRequest) error {
+	if isPublicTopicRemoval(req) && !a.AllowPublicTopicRemoval {
+		return detailError(ErrForbidden, "removing public topics is not allowed")
+	}
+	if req.ClientID == "" {
+		return nil
+	}
+
+	token := r.Header.Get("X-Client-Token")
+	if token == "" {
+		token = r.URL.Query().Get("client_token")
+	}
+	if token == "" {
+		return detailError(ErrUnauthorized, "missing client token")
+	}
+
+	expected, _ := a.IssueClientToken(req.ClientID)
+	if !hmac.Equal([]byte(token), []byte(expected)) {
+		return detailError(ErrForbidden, "invalid client token")
+	}
+	return nil
+}
+
+// -----------------------------
+// JWT
+// -----------------------------
+
+// JWTClaims are the claims of a verified JWT.
+type JWTClaims map[string]interface{}
+
+// JWTOptions configures the JWT authorizer.
+// Set HMACSecret for HS256 and/or RSAPublicKey for RS256 tokens.
+type JWTOptions struct {
+	HMACSecret   []byte
+	RSAPublicKey *rsa.PublicKey
+	// ClientClaim is the claim which has to match the client_id of a request, e.g. "sub".
+	// If it is empty, tokens are not bound to a client.
+	ClientClaim string
+	// Check is called with the claims of a valid token to decide about the action.
+	Check func(claims JWTClaims, req *AuthRequest) error
+	// AllowPublicTopicRemoval allows to remove public topics. Without it they are refused,
+	// with it Check decides, e.g. by an admin claim.
+	AllowPublicTopicRemoval bool
+}
+
+// JWTAuthorizer allows requests with a valid JWT bearer token (HS256 or RS256).
+type JWTAuthorizer struct {
+	opts JWTOptions
+}
+
+// NewJWTAuthorizer creates a JWT authorizer.
+func NewJWTAuthorizer(opts JWTOptions) *JWTAuthorizer {
+	return &JWTAuthorizer{opts: opts}
+}
+
+// Authorize verifies the JWT of the request.
+func (a *JWTAuthorizer) Authorize(r *http.Request, req *AuthRequest) error {
+	token := bearerToken(r)
+	if token == "" {
+		return detailError(ErrUnauthorized, "missing bearer token")
+	}
+
+	claims, err := a.Verify(token)
+	if err != nil {
+		return fmt.Errorf("%w: %s", detailError(ErrUnauthorized, "invalid bearer token"), err)
+	}
+
+	// Token has to belong to the client
+	if a.opts.ClientClaim != "" && req.ClientID != "" {
+		if id, _ := claims[a.opts.ClientClaim].(string); id != req.ClientID {
+			return detailError(ErrForbidden, "token does not belong to client")
+		}
+	}
+
+	if isPublicTopicRemoval(req) && !a.opts.AllowPublicTopicRemoval {
+		return detailError(ErrForbidden, "removing public topics is not allowed")
+	}
+
+	if a.opts.Check != nil {
+		return a.opts.Check(claims, req)
+	}
+	return nil
+}
+
+// Verify checks the signature, exp and nbf of the token and returns its claims.
+func (a *JWTAuthorizer) Verify(token string) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	// Header
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed token header")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, errors.New("malformed token header")
+	}
+
+	// Signature
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch header.Alg {
+	case "HS256":
+		if a.opts.HMACSecret == nil {
+			return nil, errors.New("unsupported algorithm HS256")
+		}
+		mac := hmac.New(sha256.New, a.opts.HMACSecret)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, errors.New("invalid signature")
+		}
+	case "RS256":
+		if a.opts.RSAPublicKey == nil {
+			return nil, errors.New("unsupported algorithm RS256")
+		}
+		hash := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(a.opts.RSAPublicKey, crypto.SHA256, hash[:], sig); err != nil {
+			return nil, errors.New("invalid signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %s", header.Alg)
+	}
+
+	// Claims
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed token claims")
+	}
+	claims := JWTClaims{}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, errors.New("malformed token claims")
+	}
+
+	now := float64(time.Now().Unix())
+	if exp, ok := claims["exp"].(float64); ok && now >= exp {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return nil, errors.New("token not valid yet")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,232 @@
+package pubsubsse
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Tests for:
+// +SetAuthorizer(a Authorizer)
+// +NewBearerAuthorizer(tokens ...string): *BearerAuthorizer
+// +NewHMACAuthorizer(secret []byte): *HMACAuthorizer
+// +NewJWTAuthorizer(opts JWTOptions): *JWTAuthorizer
+// +AllAuthorizers(authorizers ...Authorizer): Authorizer
+
+// Create a signed JWT
+func signJWT(t *testing.T, alg string, claims JWTClaims, hsKey []byte, rsKey *rsa.PrivateKey) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var sig []byte
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, hsKey)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case "RS256":
+		hash := sha256.Sum256([]byte(signed))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, rsKey, crypto.SHA256, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// Make a request to the handler and decode the JSON response
+func doRequest(s *SSEPubSubService, handler func(*SSEPubSubService, http.ResponseWriter, *http.Request), url string, headers map[string]string) (int, apiResponse) {
+	req := httptest.NewRequest("GET", url, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	handler(s, w, req)
+
+	var body apiResponse
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body
+}
+
+func TestBearerAuthorizer(t *testing.T) {
+	s := NewSSEPubSubService()
+	s.SetAuthorizer(NewBearerAuthorizer("secret"))
+
+	// Missing token
+	code, body := doRequest(s, AddClient, "/add/user", nil)
+	if code != http.StatusUnauthorized || body.OK || body.errorCode() != CodeUnauthorized {
+		t.Errorf("Expected 401, got %d %v", code, body)
+	}
+
+	// Invalid token
+	code, _ = doRequest(s, AddClient, "/add/user", map[string]string{"Authorization": "Bearer wrong"})
+	if code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", code)
+	}
+
+	// Valid token in header and query
+	code, body = doRequest(s, AddClient, "/add/user", map[string]string{"Authorization": "Bearer secret"})
+	if code != http.StatusOK || body.ClientID == "" {
+		t.Errorf("Expected 200, got %d %v", code, body)
+	}
+	code, _ = doRequest(s, AddPublicTopic, "/add/topic/public?topic=news&access_token=secret", nil)
+	if code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", code)
+	}
+}
+
+func TestHMACAuthorizer(t *testing.T) {
+	s := NewSSEPubSubService()
+	s.SetAuthorizer(NewHMACAuthorizer([]byte("key")))
+	s.NewPublicTopic("news")
+
+	// The client token is returned with the client ID
+	code, body := doRequest(s, AddClient, "/add/user", nil)
+	if code != http.StatusOK || body.ClientToken == "" {
+		t.Fatalf("Expected client token, got %d %v", code, body)
+	}
+	id := body.ClientID
+	token := body.ClientToken
+
+	// Missing token
+	code, _ = doRequest(s, Subscribe, "/subscribe?client_id="+id+"&topic=news", nil)
+	if code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", code)
+	}
+
+	// Token of another client
+	other, _ := NewHMACAuthorizer([]byte("key")).IssueClientToken("other")
+	code, _ = doRequest(s, Subscribe, "/subscribe?client_id="+id+"&topic=news&client_token="+other, nil)
+	if code != http.StatusForbidden {
+		t.Errorf("Expected 403, got %d", code)
+	}
+
+	// Valid token
+	code, _ = doRequest(s, Subscribe, "/subscribe?client_id="+id+"&topic=news", map[string]string{"X-Client-Token": token})
+	if code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", code)
+	}
+
+	// The stream can not be hijacked
+	code, _ = doRequest(s, Event, "/event?client_id="+id, nil)
+	if code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", code)
+	}
+
+	// Public topics can only be removed if it is allowed explicitly
+	code, _ = doRequest(s, RemovePublicTopic, "/remove/topic/public?topic=news", nil)
+	if _, ok := s.GetPublicTopicByName("news"); code != http.StatusForbidden || !ok {
+		t.Errorf("Expected 403, got %d", code)
+	}
+	s.SetAuthorizer(&HMACAuthorizer{secret: []byte("key"), AllowPublicTopicRemoval: true})
+	code, _ = doRequest(s, RemovePublicTopic, "/remove/topic/public?topic=news", nil)
+	if _, ok := s.GetPublicTopicByName("news"); code != http.StatusOK || ok {
+		t.Errorf("Expected 200, got %d", code)
+	}
+}
+
+func TestJWTAuthorizer_HS256(t *testing.T) {
+	key := []byte("jwt-secret")
+	a := NewJWTAuthorizer(JWTOptions{HMACSecret: key, ClientClaim: "sub"})
+
+	req := &AuthRequest{Action: ActionSubscribe, ClientID: "c1", Topic: "news"}
+	check := func(token string) error {
+		r := httptest.NewRequest("GET", "/subscribe", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		return a.Authorize(r, req)
+	}
+
+	if err := check(signJWT(t, "HS256", JWTClaims{"sub": "c1"}, key, nil)); err != nil {
+		t.Errorf("Expected valid token, got %s", err)
+	}
+	if err := check(signJWT(t, "HS256", JWTClaims{"sub": "c2"}, key, nil)); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for other client, got %v", err)
+	}
+	if err := check(signJWT(t, "HS256", JWTClaims{"sub": "c1"}, []byte("wrong"), nil)); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized for invalid signature, got %v", err)
+	}
+	expired := JWTClaims{"sub": "c1", "exp": float64(time.Now().Add(-time.Minute).Unix())}
+	if err := check(signJWT(t, "HS256", expired, key, nil)); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized for expired token, got %v", err)
+	}
+	if err := check("not.a.jwt"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized for malformed token, got %v", err)
+	}
+}
+
+func TestJWTAuthorizer_RS256(t *testing.T) {
+	rsKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewJWTAuthorizer(JWTOptions{
+		RSAPublicKey: &rsKey.PublicKey,
+		Check: func(claims JWTClaims, req *AuthRequest) error {
+			if req.Action == ActionCreateTopic && claims["role"] != "admin" {
+				return ErrForbidden
+			}
+			return nil
+		},
+	})
+
+	s := NewSSEPubSubService()
+	s.SetAuthorizer(a)
+
+	user := signJWT(t, "RS256", JWTClaims{"role": "user"}, nil, rsKey)
+	admin := signJWT(t, "RS256", JWTClaims{"role": "admin"}, nil, rsKey)
+
+	code, _ := doRequest(s, AddPublicTopic, "/add/topic/public?topic=news", map[string]string{"Authorization": "Bearer " + user})
+	if code != http.StatusForbidden {
+		t.Errorf("Expected 403, got %d", code)
+	}
+	code, _ = doRequest(s, AddPublicTopic, "/add/topic/public?topic=news", map[string]string{"Authorization": "Bearer " + admin})
+	if code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", code)
+	}
+
+	// HS256 tokens are not accepted without a secret
+	hs := signJWT(t, "HS256", JWTClaims{"role": "admin"}, []byte("x"), nil)
+	code, _ = doRequest(s, AddPublicTopic, "/add/topic/public?topic=news", map[string]string{"Authorization": "Bearer " + hs})
+	if code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", code)
+	}
+
+	// Public topics can only be removed if it is allowed explicitly, even if Check allows it
+	code, _ = doRequest(s, RemovePublicTopic, "/remove/topic/public?topic=news", map[string]string{"Authorization": "Bearer " + admin})
+	if code != http.StatusForbidden {
+		t.Errorf("Expected 403, got %d", code)
+	}
+	a.opts.AllowPublicTopicRemoval = true
+	code, _ = doRequest(s, RemovePublicTopic, "/remove/topic/public?topic=news", map[string]string{"Authorization": "Bearer " + admin})
+	if code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", code)
+	}
+}
+
+func TestAllAuthorizers(t *testing.T) {
+	s := NewSSEPubSubService()
+	s.SetAuthorizer(AllAuthorizers(NewBearerAuthorizer("secret"), NewHMACAuthorizer([]byte("key"))))
+
+	code, _ := doRequest(s, AddClient, "/add/user", nil)
+	if code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", code)
+	}
+
+	code, body := doRequest(s, AddClient, "/add/user", map[string]string{"Authorization": "Bearer secret"})
+	if code != http.StatusOK || body.ClientToken == "" {
+		t.Errorf("Expected client token, got %d %v", code, body)
+	}
+}
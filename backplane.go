@@ -0,0 +1,490 @@
+package pubsubsse
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Backplane connects multiple sSEPubSubService instances, e.g. several replicas behind a load balancer.
+// Publishes on public and group topics, topic creation/removal and group membership
+// are sent to all other instances, so their SSE clients get the same data.
+type Backplane interface {
+	// Publish sends the message to all instances connected to the backplane.
+	Publish(msg *BackplaneMessage) error
+	// Subscribe registers the handler which receives the messages of all instances.
+	// Messages published by the instance itself may be received as well.
+	Subscribe(handler func(*BackplaneMessage)) error
+	// Close disconnects from the backplane.
+	Close() error
+}
+
+// Defaults of the Redis and NATS backplanes
+const (
+	// DefaultBackplaneQueueSize is the number of messages which are queued while the server is slow or unreachable.
+	DefaultBackplaneQueueSize = 1024
+	// DefaultBackplaneWriteTimeout is the deadline for writing a message to the server.
+	DefaultBackplaneWriteTimeout = 5 * time.Second
+	// DefaultBackplaneReconnectWait is the time between two attempts to reconnect to the server.
+	DefaultBackplaneReconnectWait = time.Second
+)
+
+// BackplaneEvent is the type of a backplane message.
+type BackplaneEvent string
+
+const (
+	BackplanePub          BackplaneEvent = "pub"
+	BackplaneTopicCreated BackplaneEvent = "topic_created"
+	BackplaneTopicRemoved BackplaneEvent = "topic_removed"
+	BackplaneTopicUpdated BackplaneEvent = "topic_updated"
+	BackplaneGroupJoin    BackplaneEvent = "group_join"
+	BackplaneGroupLeave   BackplaneEvent = "group_leave"
+)
+
+// BackplaneMessage is a change on one instance which is applied on all other instances.
+type BackplaneMessage struct {
+	// Node is the ID of the instance which sent the message.
+	Node      string          `json:"node"`
+	Event     BackplaneEvent  `json:"event"`
+	TopicType string          `json:"topic_type,omitempty"`
+	Topic     string          `json:"topic,omitempty"`
+	Group     string          `json:"group,omitempty"`
+	Client    string          `json:"client,omitempty"`
+	EventName string          `json:"event_name,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	// Options of the topic. They are sent with topic_created, topic_updated and pub.
+	Options *BackplaneTopicOptions `json:"options,omitempty"`
+}
+
+// BackplaneTopicOptions are the settings of a topic which are shared with the other instances.
+// Codec is the name of the codec of the topic. Only the built-in codecs are applied by the other instances.
+type BackplaneTopicOptions struct {
+	ACL       *TopicACL `json:"acl,omitempty"`
+	Retained  bool      `json:"retained,omitempty"`
+	EventName string    `json:"event_name,omitempty"`
+	Codec     string    `json:"codec,omitempty"`
+}
+
+// Marshal the message for the wire
+func (m *BackplaneMessage) marshal() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// Unmarshal a message from the wire
+func unmarshalBackplaneMessage(data []byte) (*BackplaneMessage, error) {
+	m := &BackplaneMessage{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid backplane message: %s", err)
+	}
+	return m, nil
+}
+
+// Get the ID of this instance on the backplane
+func (s *SSEPubSubService) GetNodeID() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.nodeID
+}
+
+// Get the backplane
+func (s *SSEPubSubService) GetBackplane() Backplane {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.backplane
+}
+
+// Set the backplane
+// 0. Close the previous backplane
+// 1. Subscribe to the messages of the other instances
+// 2. Publish changes of this instance from now on
+func (s *SSEPubSubService) SetBackplane(b Backplane) error {
+	s.lock.Lock()
+	old := s.backplane
+	s.backplane = nil
+	s.lock.Unlock()
+
+	// Close the previous backplane
+	if old != nil {
+		if err := old.Close(); err != nil {
+			s.GetLogger().Error("Error closing backplane", logKeyError, err)
+		}
+	}
+	if b == nil {
+		return nil
+	}
+
+	// Subscribe to the messages of the other instances
+	if err := b.Subscribe(s.handleBackplane); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.backplane = b
+	s.lock.Unlock()
+
+	return nil
+}
+
+// Send a change of this instance to the other instances
+func (s *SSEPubSubService) publishBackplane(msg *BackplaneMessage) {
+	b := s.GetBackplane()
+	if b == nil {
+		return
+	}
+
+	msg.Node = s.GetNodeID()
+	if err := b.Publish(msg); err != nil {
+		s.GetLogger().Error("Error publishing to backplane", "event", msg.Event, logKeyTopic, msg.Topic, logKeyGroup, msg.Group, logKeyError, err)
+	}
+}
+
+// Apply a change of another instance.
+// Changes are only applied locally and not published to the backplane again.
+func (s *SSEPubSubService) handleBackplane(msg *BackplaneMessage) {
+	// Ignore own messages
+	if msg.Node == s.GetNodeID() {
+		return
+	}
+
+	switch msg.Event {
+	case BackplanePub:
+		t, _ := s.backplaneTopic(msg)
+		if t == nil {
+			return
+		}
+		if err := t.pubLocal(msg.EventName, msg.Data); err != nil {
+			s.GetLogger().Error("Error publishing data from backplane", logKeyTopic, msg.Topic, logKeyGroup, msg.Group, logKeyError, err)
+		}
+
+	case BackplaneTopicCreated:
+		s.backplaneTopic(msg)
+
+	case BackplaneTopicUpdated:
+		// The options are applied to topics which exist on this instance as well
+		if t, created := s.backplaneTopic(msg); t != nil && !created && msg.Options != nil {
+			t.applyBackplaneOptions(msg.Options)
+		}
+
+	case BackplaneTopicRemoved:
+		switch topicType(msg.TopicType) {
+		case TPublic:
+			if t, ok := s.GetPublicTopicByName(msg.Topic); ok {
+				s.removePublicTopic(t, false)
+			}
+		case TGroup:
+			if g, ok := s.GetGroupByName(msg.Group); ok {
+				if t, ok := g.GetTopicByName(msg.Topic); ok {
+					g.removeTopic(t, false)
+				}
+			}
+		}
+
+	case BackplaneGroupJoin:
+		// Only clients connected to this instance can be added
+		if c, ok := s.GetClientByID(msg.Client); ok {
+			g := s.NewGroup(msg.Group)
+			if _, ok := g.GetClientByID(msg.Client); !ok {
+				g.addClient(c, false)
+			}
+		}
+
+	case BackplaneGroupLeave:
+		if g, ok := s.GetGroupByName(msg.Group); ok {
+			if c, ok := g.GetClientByID(msg.Client); ok {
+				g.removeClient(c, false)
+			}
+		}
+
+	default:
+		s.GetLogger().Error("Unknown backplane event", "event", msg.Event)
+	}
+}
+
+// Get the local topic of a backplane message. It is created if it does not exist yet.
+// The name is canonicalized with the topic rules of this instance.
+// A created topic gets the options of the message. Without options nobody may subscribe
+// to it, until its ACL is set on this instance.
+func (s *SSEPubSubService) backplaneTopic(msg *BackplaneMessage) (*Topic, bool) {
+	var scope topicScope
+	switch topicType(msg.TopicType) {
+	case TPublic:
+		scope = s
+	case TGroup:
+		scope = s.NewGroup(msg.Group)
+	default:
+		s.GetLogger().Error("Topic type can not be shared over the backplane", "topic_type", msg.TopicType, logKeyTopic, msg.Topic)
+		return nil, false
+	}
+
+	name, err := canonicalTopicName(scope, msg.Topic)
+	if err != nil {
+		s.GetLogger().Error("Invalid topic name from backplane", logKeyTopic, msg.Topic, logKeyGroup, msg.Group, logKeyError, err)
+		return nil, false
+	}
+
+	opts := msg.Options
+	if opts == nil {
+		opts = &BackplaneTopicOptions{ACL: &TopicACL{}}
+	}
+
+	if g, ok := scope.(*Group); ok {
+		if t, ok := g.topicByName(name); ok {
+			return t, false
+		}
+		return g.newTopic(name, opts), true
+	}
+	if t, ok := s.publicTopicByName(name); ok {
+		return t, false
+	}
+	return s.newPublicTopic(name, opts), true
+}
+
+// Get the options of the topic which are shared with the other instances
+func (t *Topic) backplaneOptions() *BackplaneTopicOptions {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	opts := &BackplaneTopicOptions{
+		ACL:       t.acl.copy(),
+		Retained:  t.retained,
+		EventName: t.eventName,
+	}
+	if t.codec != nil {
+		opts.Codec = t.codec.Name()
+	}
+	return opts
+}
+
+// Set the options of another instance without enforcing the ACL, e.g. before the topic is added to its scope.
+// Codecs which are not built in and invalid event names are ignored.
+func (t *Topic) setBackplaneOptions(opts *BackplaneTopicOptions) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.acl = opts.ACL.copy()
+	t.retained = opts.Retained
+	if !opts.Retained {
+		t.retainedMsg = nil
+	}
+	if validateEventName(opts.EventName) == nil {
+		t.eventName = opts.EventName
+	}
+	if opts.Codec == "" {
+		t.codec = nil
+	} else if c, ok := builtinCodec(opts.Codec); ok {
+		t.codec = c
+	}
+}
+
+// Apply the options of another instance. They are not published to the backplane again.
+func (t *Topic) applyBackplaneOptions(opts *BackplaneTopicOptions) {
+	t.setBackplaneOptions(opts)
+	t.enforceACL()
+}
+
+// Inform the other instances about the changed options of the topic
+func (t *Topic) publishBackplaneOptions() {
+	t.sendBackplane(&BackplaneMessage{Event: BackplaneTopicUpdated, Topic: t.GetName(), Options: t.backplaneOptions()})
+}
+
+// InProcessBackplane is the reference implementation of a Backplane.
+// It connects sSEPubSubService instances in the same process.
+// Every instance needs its own backplane created by the same InProcessHub.
+type InProcessBackplane struct {
+	hub *InProcessHub
+
+	handlerLock sync.Mutex
+	handler     func(*BackplaneMessage)
+
+	queue *backplaneQueue
+}
+
+// InProcessHub connects in-process backplanes.
+type InProcessHub struct {
+	lock       sync.Mutex
+	backplanes map[*InProcessBackplane]struct{}
+}
+
+// NewInProcessHub creates a new hub for in-process backplanes.
+func NewInProcessHub() *InProcessHub {
+	return &InProcessHub{
+		backplanes: make(map[*InProcessBackplane]struct{}),
+	}
+}
+
+// NewBackplane creates a backplane connected to the hub.
+// Messages are delivered asynchronously in the order they were published.
+// Up to DefaultBackplaneQueueSize messages are queued for the handler, Publish fails if the queue of a backplane is full.
+func (h *InProcessHub) NewBackplane() *InProcessBackplane {
+	b := &InProcessBackplane{
+		hub:   h,
+		queue: newBackplaneQueue(DefaultBackplaneQueueSize),
+	}
+
+	h.lock.Lock()
+	h.backplanes[b] = struct{}{}
+	h.lock.Unlock()
+
+	go b.run()
+
+	return b
+}
+
+// Get all backplanes connected to the hub
+func (h *InProcessHub) getBackplanes() []*InProcessBackplane {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	backplanes := make([]*InProcessBackplane, 0, len(h.backplanes))
+	for b := range h.backplanes {
+		backplanes = append(backplanes, b)
+	}
+	return backplanes
+}
+
+// Publish sends the message to all backplanes of the hub. It does not wait for the handlers.
+// The message is marshalled like on a network, so the instances share no memory.
+// An error is returned if the queue of a backplane is full, the other backplanes still get the message.
+func (b *InProcessBackplane) Publish(msg *BackplaneMessage) error {
+	data, err := msg.marshal()
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, other := range b.hub.getBackplanes() {
+		if err := other.deliver(data); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Subscribe registers the handler which receives the messages.
+func (b *InProcessBackplane) Subscribe(handler func(*BackplaneMessage)) error {
+	if b.queue.isClosed() {
+		return fmt.Errorf("backplane is closed")
+	}
+
+	b.handlerLock.Lock()
+	defer b.handlerLock.Unlock()
+
+	b.handler = handler
+	return nil
+}
+
+// Close disconnects the backplane from the hub.
+func (b *InProcessBackplane) Close() error {
+	b.hub.lock.Lock()
+	delete(b.hub.backplanes, b)
+	b.hub.lock.Unlock()
+
+	b.queue.close()
+	return nil
+}
+
+// Queue a message for the handler without waiting. A closed backplane discards it.
+func (b *InProcessBackplane) deliver(data []byte) error {
+	if err := b.queue.push(data); err != nil && !b.queue.isClosed() {
+		return fmt.Errorf("in-process backplane: %s", err)
+	}
+	return nil
+}
+
+// Deliver the queued messages to the handler until the backplane is closed
+func (b *InProcessBackplane) run() {
+	for {
+		data, ok := b.queue.pop()
+		if !ok {
+			return
+		}
+
+		// The messages are marshalled by the backplanes of the hub, so they are always valid
+		msg, err := unmarshalBackplaneMessage(data)
+		if err != nil {
+			continue
+		}
+
+		b.handlerLock.Lock()
+		handler := b.handler
+		b.handlerLock.Unlock()
+
+		if handler != nil {
+			handler(msg)
+		}
+	}
+}
+
+// backplaneQueue is the bounded queue of the messages a network backplane sends.
+// Publish only queues the message, so it never waits for the network.
+// The messages are written in order by a single goroutine of the backplane.
+type backplaneQueue struct {
+	messages  chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Create a queue for size messages
+func newBackplaneQueue(size int) *backplaneQueue {
+	return &backplaneQueue{
+		messages: make(chan []byte, size),
+		done:     make(chan struct{}),
+	}
+}
+
+// Queue a message. It fails if the queue is full or closed.
+func (q *backplaneQueue) push(data []byte) error {
+	select {
+	case <-q.done:
+		return fmt.Errorf("closed")
+	default:
+	}
+
+	select {
+	case q.messages <- data:
+		return nil
+	default:
+		return fmt.Errorf("queue is full")
+	}
+}
+
+// Wait for the next message. It returns false when the queue is closed.
+func (q *backplaneQueue) pop() ([]byte, bool) {
+	select {
+	case data := <-q.messages:
+		return data, true
+	case <-q.done:
+		return nil, false
+	}
+}
+
+// Wait for d, e.g. before reconnecting. It returns false if the queue is closed in the meantime.
+func (q *backplaneQueue) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-q.done:
+		return false
+	}
+}
+
+// Check if the queue is closed
+func (q *backplaneQueue) isClosed() bool {
+	select {
+	case <-q.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close the queue. The queued messages are discarded.
+func (q *backplaneQueue) close() {
+	q.closeOnce.Do(func() { close(q.done) })
+}
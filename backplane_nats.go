@@ -0,0 +1,376 @@
+package pubsubsse
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSBackplaneOptions configures the NATS backplane.
+type NATSBackplaneOptions struct {
+	// Addr is the address of the NATS server, e.g. "localhost:4222".
+	Addr string
+	// Token is sent as auth_token in CONNECT if it is not empty.
+	Token string
+	// Subject is the subject shared by all instances.
+	Subject string
+	// DialTimeout is the timeout for connecting to the server.
+	DialTimeout time.Duration
+	// QueueSize is the number of messages which are queued for sending and for the handler.
+	// Publish fails if the send queue is full. Received messages are dropped if the handler queue is full.
+	QueueSize int
+	// WriteTimeout is the deadline for sending a message to the server.
+	WriteTimeout time.Duration
+	// ReconnectWait is the time between two attempts to reconnect after the connection was lost.
+	ReconnectWait time.Duration
+	// Logger logs the errors of the connection. nil discards them.
+	Logger Logger
+}
+
+// NATSBackplane is a Backplane which uses NATS core pub/sub.
+// It speaks the NATS client protocol directly and needs no client library.
+// The connection is re-established if it is lost. Messages published by other instances
+// while the connection is down are not received.
+type NATSBackplane struct {
+	opts  NATSBackplaneOptions
+	log   Logger
+	queue *backplaneQueue
+
+	// Received messages, passed to the handler by its own goroutine.
+	// So the reader is never blocked by the handler and always answers the PINGs of the server.
+	received chan *BackplaneMessage
+
+	lock    sync.Mutex
+	conn    net.Conn
+	handler func(*BackplaneMessage)
+	pong    chan struct{}
+	closed  bool
+}
+
+// NewNATSBackplane connects to the NATS server.
+// 1. Read the INFO of the server and send CONNECT
+// 2. Send PING and wait for the PONG to make sure CONNECT was accepted
+// 3. Start reading, sending and handling messages
+func NewNATSBackplane(opts NATSBackplaneOptions) (*NATSBackplane, error) {
+	if opts.Subject == "" {
+		opts.Subject = DefaultBackplaneChannel
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultBackplaneQueueSize
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = DefaultBackplaneWriteTimeout
+	}
+	if opts.ReconnectWait <= 0 {
+		opts.ReconnectWait = DefaultBackplaneReconnectWait
+	}
+
+	b := &NATSBackplane{
+		opts:     opts,
+		log:      loggerOrNop(opts.Logger),
+		queue:    newBackplaneQueue(opts.QueueSize),
+		received: make(chan *BackplaneMessage, opts.QueueSize),
+		pong:     make(chan struct{}, 1),
+	}
+
+	conn, reader, err := b.dial()
+	if err != nil {
+		return nil, err
+	}
+	b.conn = conn
+
+	// Send PING
+	if err := b.write("PING\r\n"); err != nil {
+		b.Close()
+		return nil, fmt.Errorf("nats backplane: %s", err)
+	}
+
+	errs := make(chan error, 1)
+	go b.readMessages(reader, errs)
+
+	// Wait for the PONG
+	select {
+	case <-b.pong:
+	case err := <-errs:
+		b.Close()
+		return nil, fmt.Errorf("nats backplane: %s", err)
+	case <-time.After(opts.DialTimeout):
+		b.Close()
+		return nil, fmt.Errorf("nats backplane: timeout waiting for server")
+	}
+
+	go b.writeMessages()
+	go b.handleMessages()
+
+	return b, nil
+}
+
+// Connect to the server: read the INFO of the server and send CONNECT
+func (b *NATSBackplane) dial() (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", b.opts.Addr, b.opts.DialTimeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("nats backplane: %s", err)
+	}
+	reader := bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(b.opts.DialTimeout))
+
+	// Read the INFO of the server
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("nats backplane: %s", err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return nil, nil, fmt.Errorf("nats backplane: unexpected greeting %q", strings.TrimSpace(line))
+	}
+
+	// Send CONNECT
+	connect := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "pubsub-sse",
+		"lang":     "go",
+		"protocol": 0,
+	}
+	if b.opts.Token != "" {
+		connect["auth_token"] = b.opts.Token
+	}
+	connectJSON, err := json.Marshal(connect)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if _, err := io.WriteString(conn, "CONNECT "+string(connectJSON)+"\r\n"); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("nats backplane: %s", err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return conn, reader, nil
+}
+
+// Write a protocol line (and payload) with the write timeout
+func (b *NATSBackplane) write(data string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		return fmt.Errorf("nats backplane: closed")
+	}
+	b.conn.SetWriteDeadline(time.Now().Add(b.opts.WriteTimeout))
+	_, err := io.WriteString(b.conn, data)
+	if err != nil {
+		// The reader notices the closed connection and reconnects
+		b.conn.Close()
+	}
+	return err
+}
+
+// Publish queues the message for the subject. It does not wait for the server.
+// An error is returned if the queue is full, e.g. because the server is unreachable.
+func (b *NATSBackplane) Publish(msg *BackplaneMessage) error {
+	data, err := msg.marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := b.queue.push(data); err != nil {
+		return fmt.Errorf("nats backplane: %s", err)
+	}
+	return nil
+}
+
+// Send the queued messages in order until the backplane is closed.
+// A message which could not be sent is sent again when the connection was re-established.
+func (b *NATSBackplane) writeMessages() {
+	for {
+		data, ok := b.queue.pop()
+		if !ok {
+			return
+		}
+
+		for {
+			err := b.write("PUB " + b.opts.Subject + " " + strconv.Itoa(len(data)) + "\r\n" + string(data) + "\r\n")
+			if err == nil {
+				break
+			}
+			if b.queue.isClosed() {
+				return
+			}
+			b.log.Error("NATS backplane error", logKeyError, err)
+			if !b.queue.wait(b.opts.ReconnectWait) {
+				return
+			}
+		}
+	}
+}
+
+// Pass the received messages to the handler until the backplane is closed
+func (b *NATSBackplane) handleMessages() {
+	for {
+		select {
+		case msg := <-b.received:
+			b.lock.Lock()
+			handler := b.handler
+			b.lock.Unlock()
+			if handler != nil {
+				handler(msg)
+			}
+		case <-b.queue.done:
+			return
+		}
+	}
+}
+
+// Subscribe passes all messages of the subject to the handler.
+// It waits for the PONG of a PING, so the subscription is active when it returns.
+func (b *NATSBackplane) Subscribe(handler func(*BackplaneMessage)) error {
+	b.lock.Lock()
+	b.handler = handler
+	b.lock.Unlock()
+
+	if err := b.write("SUB " + b.opts.Subject + " 1\r\nPING\r\n"); err != nil {
+		return err
+	}
+
+	select {
+	case <-b.pong:
+		return nil
+	case <-time.After(b.opts.DialTimeout):
+		return fmt.Errorf("nats backplane: timeout waiting for server")
+	}
+}
+
+// Close closes the connection. Queued messages which were not sent yet are discarded.
+func (b *NATSBackplane) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	b.queue.close()
+	return b.conn.Close()
+}
+
+// Read the protocol messages of the server until the backplane is closed.
+// If the connection is lost, it is re-established.
+func (b *NATSBackplane) readMessages(reader *bufio.Reader, errs chan error) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			b.reportError(errs, err)
+			if reader = b.reconnect(err); reader == nil {
+				return
+			}
+			continue
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+
+		switch {
+		case line == "PING":
+			if err := b.write("PONG\r\n"); err != nil {
+				b.log.Error("NATS backplane error", logKeyError, err)
+			}
+
+		case line == "PONG":
+			select {
+			case b.pong <- struct{}{}:
+			default:
+			}
+
+		case strings.HasPrefix(line, "-ERR"):
+			b.log.Error("NATS backplane error", logKeyError, line)
+			b.reportError(errs, fmt.Errorf("%s", line))
+
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			n, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				b.log.Error("NATS backplane: invalid message", "line", line)
+				continue
+			}
+			payload := make([]byte, n+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				b.reportError(errs, err)
+				if reader = b.reconnect(err); reader == nil {
+					return
+				}
+				continue
+			}
+
+			msg, err := unmarshalBackplaneMessage(payload[:n])
+			if err != nil {
+				b.log.Error("NATS backplane error", logKeyError, err)
+				continue
+			}
+
+			select {
+			case b.received <- msg:
+			default:
+				b.log.Error("NATS backplane: handler is too slow, message dropped", "event", msg.Event, logKeyTopic, msg.Topic)
+			}
+		}
+	}
+}
+
+// Re-establish the connection after the read error err and subscribe again.
+// It returns nil if the backplane was closed or is still connecting (NewNATSBackplane handles the error).
+func (b *NATSBackplane) reconnect(err error) *bufio.Reader {
+	b.lock.Lock()
+	closed := b.closed
+	b.conn.Close()
+	b.lock.Unlock()
+	if closed {
+		return nil
+	}
+	b.log.Error("NATS backplane error", logKeyError, err)
+
+	for b.queue.wait(b.opts.ReconnectWait) {
+		conn, reader, err := b.dial()
+		if err != nil {
+			b.log.Error("NATS backplane error", logKeyError, err)
+			continue
+		}
+
+		b.lock.Lock()
+		if b.closed {
+			b.lock.Unlock()
+			conn.Close()
+			return nil
+		}
+		b.conn = conn
+		subscribed := b.handler != nil
+		b.lock.Unlock()
+
+		if subscribed {
+			if err := b.write("SUB " + b.opts.Subject + " 1\r\n"); err != nil {
+				b.log.Error("NATS backplane error", logKeyError, err)
+				continue
+			}
+		}
+		b.log.Info("NATS backplane reconnected")
+		return reader
+	}
+	return nil
+}
+
+// Report an error to NewNATSBackplane if it is still waiting for the server
+func (b *NATSBackplane) reportError(errs chan error, err error) {
+	select {
+	case errs <- err:
+	default:
+	}
+}
@@ -0,0 +1,251 @@
+package pubsubsse
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Tests for:
+// +NewNATSBackplane(opts NATSBackplaneOptions): *NATSBackplane, error
+
+// Minimal NATS server which supports CONNECT, PING, PONG, SUB and PUB
+type fakeNATS struct {
+	listener net.Listener
+	lock     sync.Mutex
+	subs     map[string][]fakeNATSSub
+	conns    []net.Conn
+	pongs    int
+}
+
+type fakeNATSSub struct {
+	conn net.Conn
+	sid  string
+}
+
+func newFakeNATS(t *testing.T) *fakeNATS {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &fakeNATS{listener: l, subs: make(map[string][]fakeNATSSub)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go n.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return n
+}
+
+// Close all connections, like a restart of the server
+func (n *fakeNATS) dropAll() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for _, conn := range n.conns {
+		conn.Close()
+	}
+	n.conns = nil
+	n.subs = make(map[string][]fakeNATSSub)
+}
+
+// Send a PING to all connections
+func (n *fakeNATS) pingAll() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for _, conn := range n.conns {
+		conn.Write([]byte("PING\r\n"))
+	}
+}
+
+// Get the number of PONGs received
+func (n *fakeNATS) getPongs() int {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	return n.pongs
+}
+
+func (n *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	n.lock.Lock()
+	n.conns = append(n.conns, conn)
+	n.lock.Unlock()
+	conn.Write([]byte("INFO {\"server_id\":\"fake\"}\r\n"))
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "CONNECT":
+			if !strings.Contains(line, `"auth_token":"secret"`) {
+				conn.Write([]byte("-ERR 'Authorization Violation'\r\n"))
+				return
+			}
+		case "PING":
+			conn.Write([]byte("PONG\r\n"))
+		case "PONG":
+			n.lock.Lock()
+			n.pongs++
+			n.lock.Unlock()
+		case "SUB":
+			n.lock.Lock()
+			n.subs[fields[1]] = append(n.subs[fields[1]], fakeNATSSub{conn: conn, sid: fields[2]})
+			n.lock.Unlock()
+		case "PUB":
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			n.lock.Lock()
+			for _, sub := range n.subs[fields[1]] {
+				sub.conn.Write([]byte("MSG " + fields[1] + " " + sub.sid + " " + strconv.Itoa(size) + "\r\n" + string(payload)))
+			}
+			n.lock.Unlock()
+		}
+	}
+}
+
+func TestNATSBackplane(t *testing.T) {
+	server := newFakeNATS(t)
+	addr := server.listener.Addr().String()
+
+	s1 := NewSSEPubSubService()
+	s2 := NewSSEPubSubService()
+	for _, s := range []*SSEPubSubService{s1, s2} {
+		b, err := NewNATSBackplane(NATSBackplaneOptions{Addr: addr, Token: "secret"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SetBackplane(b); err != nil {
+			t.Fatal(err)
+		}
+		defer s.SetBackplane(nil)
+	}
+
+	topic := s1.NewPublicTopic("news")
+	eventually(t, "Topic not created on the other instance", func() bool {
+		_, ok := s2.GetPublicTopicByName("news")
+		return ok
+	})
+
+	client := s2.NewClient()
+	remote, _ := s2.GetPublicTopicByName("news")
+	client.Sub(remote)
+	frames, cancel := resumeClient(client, "")
+	defer cancel()
+
+	topic.Pub("hello")
+	waitForUpdate(t, frames, "hello")
+}
+
+func TestNATSBackplane_Unauthorized(t *testing.T) {
+	server := newFakeNATS(t)
+
+	_, err := NewNATSBackplane(NATSBackplaneOptions{Addr: server.listener.Addr().String(), Token: "wrong"})
+	if err == nil {
+		t.Error("Expected error for wrong token")
+	}
+}
+
+// Connect a NATS backplane which passes the received messages to received
+func newTestNATSBackplane(t *testing.T, addr string, received chan *BackplaneMessage) *NATSBackplane {
+	b, err := NewNATSBackplane(NATSBackplaneOptions{Addr: addr, Token: "secret", ReconnectWait: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	if received != nil {
+		if err := b.Subscribe(func(msg *BackplaneMessage) { received <- msg }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b
+}
+
+func TestNATSBackplane_Reconnect(t *testing.T) {
+	server := newFakeNATS(t)
+	addr := server.listener.Addr().String()
+
+	received := make(chan *BackplaneMessage, 100)
+	pub := newTestNATSBackplane(t, addr, nil)
+	newTestNATSBackplane(t, addr, received)
+
+	// The server restarts. Messages are received again once both backplanes reconnected.
+	server.dropAll()
+	eventually(t, "Messages not received after reconnect", func() bool {
+		if err := pub.Publish(&BackplaneMessage{Event: BackplanePub, Topic: "news"}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-received:
+			return true
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	})
+}
+
+func TestNATSBackplane_SlowHandler(t *testing.T) {
+	server := newFakeNATS(t)
+	addr := server.listener.Addr().String()
+
+	// The handler blocks
+	block := make(chan struct{})
+	defer close(block)
+	b := newTestNATSBackplane(t, addr, nil)
+	handled := make(chan struct{}, 1)
+	b.Subscribe(func(msg *BackplaneMessage) {
+		handled <- struct{}{}
+		<-block
+	})
+	b.Publish(&BackplaneMessage{Event: BackplanePub, Topic: "news"})
+	<-handled
+
+	// The PINGs of the server are still answered
+	server.pingAll()
+	eventually(t, "PING not answered", func() bool {
+		return server.getPongs() > 0
+	})
+}
+
+func TestNATSBackplane_QueueFull(t *testing.T) {
+	server := newFakeNATS(t)
+	b, err := NewNATSBackplane(NATSBackplaneOptions{Addr: server.listener.Addr().String(), Token: "secret", QueueSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// Nothing is sent while the server is unreachable
+	server.listener.Close()
+	server.dropAll()
+
+	var err2 error
+	for i := 0; i < 100 && err2 == nil; i++ {
+		err2 = b.Publish(&BackplaneMessage{Event: BackplanePub, Topic: "news"})
+	}
+	if err2 == nil {
+		t.Error("Expected error when the queue is full")
+	}
+}
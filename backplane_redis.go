@@ -0,0 +1,388 @@
+package pubsubsse
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBackplaneChannel is the Redis channel or NATS subject used by default.
+const DefaultBackplaneChannel = "pubsub-sse"
+
+// RedisBackplaneOptions configures the Redis backplane.
+type RedisBackplaneOptions struct {
+	// Addr is the address of the Redis server, e.g. "localhost:6379".
+	Addr string
+	// Password is sent with AUTH if it is not empty.
+	Password string
+	// Channel is the pub/sub channel shared by all instances.
+	Channel string
+	// DialTimeout is the timeout for connecting to the server.
+	DialTimeout time.Duration
+	// QueueSize is the number of messages which are queued for sending. Publish fails if the queue is full.
+	QueueSize int
+	// WriteTimeout is the deadline for sending a message and reading the reply of the server.
+	WriteTimeout time.Duration
+	// ReconnectWait is the time between two attempts to reconnect after the connection was lost.
+	ReconnectWait time.Duration
+	// Logger logs the errors of the connection. nil discards them.
+	Logger Logger
+}
+
+// RedisBackplane is a Backplane which uses Redis pub/sub.
+// It speaks the Redis protocol (RESP) directly and needs no client library.
+// It uses one connection for PUBLISH and one for SUBSCRIBE.
+// Both connections are re-established if they are lost. Messages published by other instances
+// while the subscriber connection is down are not received.
+type RedisBackplane struct {
+	opts  RedisBackplaneOptions
+	log   Logger
+	queue *backplaneQueue
+
+	lock      sync.Mutex
+	pubConn   net.Conn
+	pubReader *bufio.Reader
+	subConn   net.Conn
+}
+
+// redisError is an error reply of the server
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// NewRedisBackplane connects to the Redis server.
+func NewRedisBackplane(opts RedisBackplaneOptions) (*RedisBackplane, error) {
+	if opts.Channel == "" {
+		opts.Channel = DefaultBackplaneChannel
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultBackplaneQueueSize
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = DefaultBackplaneWriteTimeout
+	}
+	if opts.ReconnectWait <= 0 {
+		opts.ReconnectWait = DefaultBackplaneReconnectWait
+	}
+
+	b := &RedisBackplane{opts: opts, log: loggerOrNop(opts.Logger), queue: newBackplaneQueue(opts.QueueSize)}
+
+	conn, reader, err := b.dial()
+	if err != nil {
+		return nil, err
+	}
+	b.pubConn = conn
+	b.pubReader = reader
+
+	go b.writeMessages()
+
+	return b, nil
+}
+
+// Connect to the server and authenticate
+func (b *RedisBackplane) dial() (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", b.opts.Addr, b.opts.DialTimeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("redis backplane: %s", err)
+	}
+	reader := bufio.NewReader(conn)
+
+	if b.opts.Password != "" {
+		conn.SetDeadline(time.Now().Add(b.opts.DialTimeout))
+		if err := writeRESPCommand(conn, "AUTH", b.opts.Password); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("redis backplane: %s", err)
+		}
+		if _, err := readRESP(reader); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("redis backplane: %s", err)
+		}
+		conn.SetDeadline(time.Time{})
+	}
+
+	return conn, reader, nil
+}
+
+// Publish queues the message for the channel. It does not wait for the server.
+// An error is returned if the queue is full, e.g. because the server is unreachable.
+func (b *RedisBackplane) Publish(msg *BackplaneMessage) error {
+	data, err := msg.marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := b.queue.push(data); err != nil {
+		return fmt.Errorf("redis backplane: %s", err)
+	}
+	return nil
+}
+
+// Send the queued messages in order until the backplane is closed.
+// A message which could not be sent because of the connection is sent again after reconnecting.
+func (b *RedisBackplane) writeMessages() {
+	for {
+		data, ok := b.queue.pop()
+		if !ok {
+			return
+		}
+
+		for {
+			err := b.publish(data)
+			if err == nil {
+				break
+			}
+			if b.queue.isClosed() {
+				return
+			}
+			b.log.Error("Redis backplane error", logKeyError, err)
+
+			// The server rejected the message, sending it again would not help
+			var replyErr redisError
+			if errors.As(err, &replyErr) {
+				break
+			}
+			if !b.queue.wait(b.opts.ReconnectWait) {
+				return
+			}
+		}
+	}
+}
+
+// Send a message over the publisher connection. The connection is re-established if it was lost.
+func (b *RedisBackplane) publish(data []byte) error {
+	b.lock.Lock()
+	conn, reader := b.pubConn, b.pubReader
+	b.lock.Unlock()
+
+	if conn == nil {
+		var err error
+		if conn, reader, err = b.dial(); err != nil {
+			return err
+		}
+		b.lock.Lock()
+		if b.queue.isClosed() {
+			b.lock.Unlock()
+			conn.Close()
+			return fmt.Errorf("redis backplane: closed")
+		}
+		b.pubConn, b.pubReader = conn, reader
+		b.lock.Unlock()
+	}
+
+	conn.SetDeadline(time.Now().Add(b.opts.WriteTimeout))
+	err := writeRESPCommand(conn, "PUBLISH", b.opts.Channel, string(data))
+	if err == nil {
+		_, err = readRESP(reader)
+	}
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// The connection is broken or out of sync with the replies
+		b.lock.Lock()
+		if b.pubConn == conn {
+			b.pubConn.Close()
+			b.pubConn, b.pubReader = nil, nil
+		}
+		b.lock.Unlock()
+	}
+	if err != nil {
+		return fmt.Errorf("redis backplane: %w", err)
+	}
+	return nil
+}
+
+// Subscribe opens the subscriber connection and passes all messages of the channel to the handler.
+func (b *RedisBackplane) Subscribe(handler func(*BackplaneMessage)) error {
+	reader, err := b.subscribe()
+	if err != nil {
+		return err
+	}
+
+	go b.readMessages(reader, handler)
+
+	return nil
+}
+
+// Open the subscriber connection and subscribe to the channel
+func (b *RedisBackplane) subscribe() (*bufio.Reader, error) {
+	conn, reader, err := b.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(b.opts.DialTimeout))
+	if err := writeRESPCommand(conn, "SUBSCRIBE", b.opts.Channel); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("redis backplane: %s", err)
+	}
+	// Wait for the confirmation: ["subscribe", channel, count]
+	if _, err := readRESP(reader); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("redis backplane: %s", err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.queue.isClosed() {
+		conn.Close()
+		return nil, fmt.Errorf("redis backplane: closed")
+	}
+	b.subConn = conn
+	return reader, nil
+}
+
+// Read the messages of the subscriber connection until the backplane is closed.
+// If the connection is lost, it is re-established.
+func (b *RedisBackplane) readMessages(reader *bufio.Reader, handler func(*BackplaneMessage)) {
+	for {
+		reply, err := readRESP(reader)
+		if err != nil {
+			if b.queue.isClosed() {
+				return
+			}
+			b.log.Error("Redis backplane error", logKeyError, err)
+			if reader = b.resubscribe(); reader == nil {
+				return
+			}
+			continue
+		}
+
+		// Messages are ["message", channel, payload]
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 3 || parts[0] != "message" {
+			continue
+		}
+		payload, ok := parts[2].(string)
+		if !ok {
+			continue
+		}
+
+		msg, err := unmarshalBackplaneMessage([]byte(payload))
+		if err != nil {
+			b.log.Error("Redis backplane error", logKeyError, err)
+			continue
+		}
+		handler(msg)
+	}
+}
+
+// Re-establish the subscriber connection. It returns nil if the backplane was closed in the meantime.
+func (b *RedisBackplane) resubscribe() *bufio.Reader {
+	b.lock.Lock()
+	if b.subConn != nil {
+		b.subConn.Close()
+		b.subConn = nil
+	}
+	b.lock.Unlock()
+
+	for b.queue.wait(b.opts.ReconnectWait) {
+		reader, err := b.subscribe()
+		if err == nil {
+			b.log.Info("Redis backplane reconnected")
+			return reader
+		}
+		if !b.queue.isClosed() {
+			b.log.Error("Redis backplane error", logKeyError, err)
+		}
+	}
+	return nil
+}
+
+// Close closes both connections. Queued messages which were not sent yet are discarded.
+func (b *RedisBackplane) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.queue.close()
+
+	var err error
+	if b.pubConn != nil {
+		err = b.pubConn.Close()
+		b.pubConn = nil
+	}
+	if b.subConn != nil {
+		if e := b.subConn.Close(); e != nil && err == nil {
+			err = e
+		}
+		b.subConn = nil
+	}
+	return err
+}
+
+// writeRESPCommand writes a command as RESP array of bulk strings.
+func writeRESPCommand(w io.Writer, args ...string) error {
+	var sb strings.Builder
+	sb.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		sb.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// readRESP reads a single RESP value.
+// Simple strings and bulk strings are returned as string, integers as int64,
+// arrays as []interface{} and null values as nil. Error replies are returned as error.
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("invalid RESP reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid RESP bulk length: %s", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid RESP array length: %s", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := readRESP(r)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("invalid RESP reply: %s", line)
+}
@@ -0,0 +1,206 @@
+package pubsubsse
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Tests for:
+// +NewRedisBackplane(opts RedisBackplaneOptions): *RedisBackplane, error
+// -writeRESPCommand(w Writer, args ...string): error
+// -readRESP(r *Reader): interface{}, error
+
+// Minimal Redis server which supports AUTH, PUBLISH and SUBSCRIBE
+type fakeRedis struct {
+	listener net.Listener
+	lock     sync.Mutex
+	subs     map[string][]net.Conn
+	conns    []net.Conn
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{listener: l, subs: make(map[string][]net.Conn)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return r
+}
+
+// Close all connections, like a restart of the server
+func (r *fakeRedis) dropAll() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, conn := range r.conns {
+		conn.Close()
+	}
+	r.conns = nil
+	r.subs = make(map[string][]net.Conn)
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r.lock.Lock()
+	r.conns = append(r.conns, conn)
+	r.lock.Unlock()
+	reader := bufio.NewReader(conn)
+	for {
+		v, err := readRESP(reader)
+		if err != nil {
+			return
+		}
+		args, ok := v.([]interface{})
+		if !ok || len(args) == 0 {
+			return
+		}
+
+		switch args[0] {
+		case "AUTH":
+			if args[1] != "secret" {
+				conn.Write([]byte("-WRONGPASS invalid password\r\n"))
+				continue
+			}
+			conn.Write([]byte("+OK\r\n"))
+		case "SUBSCRIBE":
+			channel := args[1].(string)
+			r.lock.Lock()
+			r.subs[channel] = append(r.subs[channel], conn)
+			r.lock.Unlock()
+			writeRESPArray(conn, "subscribe", channel, ":1")
+		case "PUBLISH":
+			channel := args[1].(string)
+			r.lock.Lock()
+			subs := r.subs[channel]
+			for _, sub := range subs {
+				writeRESPArray(sub, "message", channel, args[2].(string))
+			}
+			r.lock.Unlock()
+			conn.Write([]byte(":" + strconv.Itoa(len(subs)) + "\r\n"))
+		}
+	}
+}
+
+// Write an array of bulk strings. Values starting with ":" are written as integer.
+func writeRESPArray(conn net.Conn, values ...string) {
+	out := "*" + strconv.Itoa(len(values)) + "\r\n"
+	for _, v := range values {
+		if v[0] == ':' {
+			out += v + "\r\n"
+			continue
+		}
+		out += "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+	}
+	conn.Write([]byte(out))
+}
+
+func TestRedisBackplane(t *testing.T) {
+	server := newFakeRedis(t)
+	addr := server.listener.Addr().String()
+
+	s1 := NewSSEPubSubService()
+	s2 := NewSSEPubSubService()
+	for _, s := range []*SSEPubSubService{s1, s2} {
+		b, err := NewRedisBackplane(RedisBackplaneOptions{Addr: addr, Password: "secret"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SetBackplane(b); err != nil {
+			t.Fatal(err)
+		}
+		defer s.SetBackplane(nil)
+	}
+
+	topic := s1.NewPublicTopic("news")
+	eventually(t, "Topic not created on the other instance", func() bool {
+		_, ok := s2.GetPublicTopicByName("news")
+		return ok
+	})
+
+	client := s2.NewClient()
+	remote, _ := s2.GetPublicTopicByName("news")
+	client.Sub(remote)
+	frames, cancel := resumeClient(client, "")
+	defer cancel()
+
+	topic.Pub("hello")
+	waitForUpdate(t, frames, "hello")
+}
+
+func TestRedisBackplane_WrongPassword(t *testing.T) {
+	server := newFakeRedis(t)
+
+	_, err := NewRedisBackplane(RedisBackplaneOptions{Addr: server.listener.Addr().String(), Password: "wrong"})
+	if err == nil {
+		t.Error("Expected error for wrong password")
+	}
+}
+
+func TestRedisBackplane_Reconnect(t *testing.T) {
+	server := newFakeRedis(t)
+	opts := RedisBackplaneOptions{Addr: server.listener.Addr().String(), Password: "secret", ReconnectWait: 10 * time.Millisecond}
+
+	pub, err := NewRedisBackplane(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+	sub, err := NewRedisBackplane(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	received := make(chan *BackplaneMessage, 100)
+	if err := sub.Subscribe(func(msg *BackplaneMessage) { received <- msg }); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server restarts. Messages are received again once both connections are re-established.
+	server.dropAll()
+	eventually(t, "Messages not received after reconnect", func() bool {
+		if err := pub.Publish(&BackplaneMessage{Event: BackplanePub, Topic: "news"}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-received:
+			return true
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	})
+}
+
+func TestRedisBackplane_QueueFull(t *testing.T) {
+	server := newFakeRedis(t)
+	b, err := NewRedisBackplane(RedisBackplaneOptions{Addr: server.listener.Addr().String(), QueueSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// Nothing is sent while the server is unreachable
+	server.listener.Close()
+	server.dropAll()
+
+	var err2 error
+	for i := 0; i < 100 && err2 == nil; i++ {
+		err2 = b.Publish(&BackplaneMessage{Event: BackplanePub, Topic: "news"})
+	}
+	if err2 == nil {
+		t.Error("Expected error when the queue is full")
+	}
+}
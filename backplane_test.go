@@ -0,0 +1,295 @@
+package pubsubsse
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Tests for:
+// +SetBackplane(b Backplane): error
+// +GetBackplane(): Backplane
+// +GetNodeID(): string
+// +NewInProcessHub(): *InProcessHub
+// +NewBackplane(): *InProcessBackplane
+
+// Create two instances connected by an in-process backplane
+func newBackplaneServices(t *testing.T) (*SSEPubSubService, *SSEPubSubService) {
+	hub := NewInProcessHub()
+
+	s1 := NewSSEPubSubService()
+	s2 := NewSSEPubSubService()
+	if err := s1.SetBackplane(hub.NewBackplane()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.SetBackplane(hub.NewBackplane()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		s1.SetBackplane(nil)
+		s2.SetBackplane(nil)
+	})
+
+	return s1, s2
+}
+
+// Wait until the condition is true
+func eventually(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for !cond() {
+		select {
+		case <-timeout:
+			t.Fatal(msg)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// Give the client the ID of a client of another instance.
+// A client connected to a load balancer reconnects with the same ID on every instance.
+func setClientID(s *SSEPubSubService, c *Client, id string) {
+	s.lock.Lock()
+	delete(s.clients, c.GetID())
+	c.lock.Lock()
+	c.id = id
+	c.lock.Unlock()
+	s.clients[id] = c
+	s.lock.Unlock()
+}
+
+func TestSSEPubSubService_SetBackplane(t *testing.T) {
+	s1, s2 := newBackplaneServices(t)
+
+	if s1.GetBackplane() == nil {
+		t.Error("Backplane not set")
+	}
+	if s1.GetNodeID() == "" || s1.GetNodeID() == s2.GetNodeID() {
+		t.Errorf("Node IDs must be unique: %s %s", s1.GetNodeID(), s2.GetNodeID())
+	}
+
+	if err := s1.SetBackplane(nil); err != nil {
+		t.Error(err)
+	}
+	if s1.GetBackplane() != nil {
+		t.Error("Backplane not removed")
+	}
+}
+
+func TestBackplane_Pub(t *testing.T) {
+	s1, s2 := newBackplaneServices(t)
+
+	// Topic is created on the other instance
+	topic := s1.NewPublicTopic("news")
+	eventually(t, "Topic not created on the other instance", func() bool {
+		_, ok := s2.GetPublicTopicByName("news")
+		return ok
+	})
+
+	// Client connected to the other instance receives the update
+	client := s2.NewClient()
+	remote, _ := s2.GetPublicTopicByName("news")
+	if err := client.Sub(remote); err != nil {
+		t.Fatal(err)
+	}
+	frames, cancel := resumeClient(client, "")
+	defer cancel()
+
+	if err := topic.Pub("hello"); err != nil {
+		t.Fatal(err)
+	}
+	waitForUpdate(t, frames, "hello")
+
+	// The update is not published back
+	time.Sleep(10 * time.Millisecond)
+	if len(topic.getHistorySince(0)) != 1 {
+		t.Errorf("Expected 1 message in history, got %d", len(topic.getHistorySince(0)))
+	}
+}
+
+func TestBackplane_TopicRemoved(t *testing.T) {
+	s1, s2 := newBackplaneServices(t)
+
+	topic := s1.NewPublicTopic("news")
+	eventually(t, "Topic not created on the other instance", func() bool {
+		_, ok := s2.GetPublicTopicByName("news")
+		return ok
+	})
+
+	s1.RemovePublicTopic(topic)
+	eventually(t, "Topic not removed on the other instance", func() bool {
+		_, ok := s2.GetPublicTopicByName("news")
+		return !ok
+	})
+}
+
+func TestBackplane_Group(t *testing.T) {
+	s1, s2 := newBackplaneServices(t)
+
+	c1 := s1.NewClient()
+	c2 := s2.NewClient()
+	setClientID(s2, c2, c1.GetID())
+
+	// Group topic and membership are shared
+	g1 := s1.NewGroup("room")
+	topic := g1.NewTopic("chat")
+	g1.AddClient(c1)
+
+	eventually(t, "Client not added to the group on the other instance", func() bool {
+		g2, ok := s2.GetGroupByName("room")
+		if !ok {
+			return false
+		}
+		_, ok = g2.GetClientByID(c1.GetID())
+		return ok
+	})
+
+	g2, _ := s2.GetGroupByName("room")
+	remote, ok := g2.GetTopicByName("chat")
+	if !ok {
+		t.Fatal("Group topic not created on the other instance")
+	}
+	if err := c2.Sub(remote); err != nil {
+		t.Fatal(err)
+	}
+	frames, cancel := resumeClient(c2, "")
+	defer cancel()
+
+	if err := topic.Pub("hi"); err != nil {
+		t.Fatal(err)
+	}
+	waitForUpdate(t, frames, "hi")
+
+	g1.RemoveClient(c1)
+	eventually(t, "Client not removed from the group on the other instance", func() bool {
+		_, ok := g2.GetClientByID(c1.GetID())
+		return !ok
+	})
+}
+
+func TestBackplane_PrivateTopic(t *testing.T) {
+	s1, s2 := newBackplaneServices(t)
+
+	c1 := s1.NewClient()
+	c1.NewPrivateTopic("secret").Pub("data")
+
+	// Public topic created afterwards is received, the private one never
+	s1.NewPublicTopic("marker")
+	eventually(t, "Topic not created on the other instance", func() bool {
+		_, ok := s2.GetPublicTopicByName("marker")
+		return ok
+	})
+	if _, ok := s2.GetPublicTopicByName("secret"); ok {
+		t.Error("Private topic shared over the backplane")
+	}
+}
+
+func TestBackplane_TopicOptions(t *testing.T) {
+	s1, s2 := newBackplaneServices(t)
+
+	allowed := s1.NewClient()
+	denied1 := s1.NewClient()
+	denied2 := s2.NewClient()
+
+	topic := s1.NewPublicTopic("admin")
+	topic.SetACL(&TopicACL{Clients: []string{allowed.GetID()}})
+	topic.SetRetained(true)
+	if err := topic.SetEventName("admin-update"); err != nil {
+		t.Fatal(err)
+	}
+	topic.SetCodec(MsgPackCodec{})
+
+	// The options are applied on the other instance
+	eventually(t, "Topic options not applied on the other instance", func() bool {
+		remote, ok := s2.GetPublicTopicByName("admin")
+		return ok && remote.GetACL() != nil && remote.GetCodec().Name() == "msgpack"
+	})
+	remote, _ := s2.GetPublicTopicByName("admin")
+	if !remote.IsRetained() || remote.GetEventName() != "admin-update" {
+		t.Errorf("Expected retained topic with event name admin-update, got %v %s", remote.IsRetained(), remote.GetEventName())
+	}
+
+	// The subscriber is denied on both instances
+	if err := denied1.Sub(topic); !errors.Is(err, ErrTopicNotFound) {
+		t.Errorf("Expected ErrTopicNotFound on the first instance, got %v", err)
+	}
+	if err := denied2.Sub(remote); !errors.Is(err, ErrTopicNotFound) {
+		t.Errorf("Expected ErrTopicNotFound on the other instance, got %v", err)
+	}
+
+	// The allowed client reconnects to the other instance
+	setClientID(s2, denied2, allowed.GetID())
+	if err := denied2.Sub(remote); err != nil {
+		t.Errorf("Expected allowed client to subscribe on the other instance, got %s", err)
+	}
+}
+
+func TestBackplane_TopicWithoutOptions(t *testing.T) {
+	s := NewSSEPubSubService()
+	client := s.NewClient()
+
+	// A topic only known from a message without options is denied by default.
+	// The name is canonicalized.
+	s.handleBackplane(&BackplaneMessage{Node: "other", Event: BackplanePub, TopicType: string(TPublic), Topic: "/news//today/", Data: []byte(`"hello"`)})
+	topic, ok := s.GetPublicTopicByName("news/today")
+	if !ok || topic.GetName() != "news/today" {
+		t.Fatal("Topic not created with its canonical name")
+	}
+	if err := client.Sub(topic); !errors.Is(err, ErrTopicNotFound) {
+		t.Errorf("Expected ErrTopicNotFound, got %v", err)
+	}
+
+	// Until it is configured on this instance
+	topic.SetACL(nil)
+	if err := client.Sub(topic); err != nil {
+		t.Errorf("Expected client to subscribe, got %s", err)
+	}
+
+	// Invalid names are dropped
+	s.handleBackplane(&BackplaneMessage{Node: "other", Event: BackplaneTopicCreated, TopicType: string(TPublic), Topic: "news/#"})
+	if _, ok := s.GetPublicTopicByName("news/#"); ok {
+		t.Error("Topic with invalid name created")
+	}
+}
+
+// TestInProcessBackplane_QueueFull tests that Publish does not wait for a handler which does not keep up.
+func TestInProcessBackplane_QueueFull(t *testing.T) {
+	hub := NewInProcessHub()
+	b := hub.NewBackplane()
+	defer b.Close()
+
+	block := make(chan struct{})
+	defer close(block)
+	b.Subscribe(func(msg *BackplaneMessage) { <-block })
+
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		for i := 0; i < DefaultBackplaneQueueSize+2 && err == nil; i++ {
+			err = b.Publish(&BackplaneMessage{Event: BackplanePub, Topic: "news"})
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected error for a full queue")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a full queue")
+	}
+
+	// Close does not wait for the handler either
+	closed := make(chan struct{})
+	go func() {
+		b.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked on a full queue")
+	}
+}
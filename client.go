@@ -4,11 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/apex/log"
-	"github.com/google/uuid"
 )
 
 type status int
@@ -16,18 +15,39 @@ type status int
 const (
 	Waiting status = iota
 	Receving
+	// The client receives over long-polling. See Poll.
+	Polling
 )
 
 type OnEventFunc func(string)
 
+// pendingMessage is a message waiting for space in the stream of a client
+type pendingMessage struct {
+	m    *message
+	done func(DeliveryStatus)
+}
+
 // Client represents a subscriber with a channel to send messages.
 type Client struct {
 	id     string
 	status status
 
-	stream chan string
+	stream        *streamQueue
+	streamOptions StreamOptions
+	dropped       atomic.Uint64
+
+	// Messages waiting for space in the stream. See enqueueAsync.
+	pending     []pendingMessage
+	pendingLock sync.Mutex
+	// Closed when the pending messages were written. See waitPending.
+	pendingDone chan struct{}
+
+	// Last delivered position in every topic. Used as SSE event id.
+	cursor map[string]cursorPos
 
 	stopchan chan struct{}
+	// Generation of the current event stream. A stream which was taken over by a newer one must not stop the client.
+	streamGen uint64
 
 	lock sync.Mutex
 
@@ -36,15 +56,34 @@ type Client struct {
 	privateTopics map[string]*Topic
 
 	groups map[string]*Group
+
+	patterns map[string]struct{}
+
+	// Roles used by the ACLs of topics
+	roles map[string]struct{}
+
+	// Last time the client was receiving. Used for the idle TTL.
+	lastSeen time.Time
+
+	// Wire format of the current event stream
+	wireFormat WireFormat
+
+	// Long-polling: only one poll at a time, polls is the number of waiting polls.
+	// pollInit is set until a poll returned the init message of the session.
+	pollLock sync.Mutex
+	polls    int
+	pollInit bool
 }
 
 // Create a new client
-func newClient(sSEPubSubService *SSEPubSubService) *Client {
+func newClient(sSEPubSubService *SSEPubSubService, id string) *Client {
 	return &Client{
-		id:     uuid.New().String(),
+		id:     id,
 		status: Waiting,
 
-		stream: make(chan string, 100),
+		stream:        newStreamQueue(),
+		streamOptions: sSEPubSubService.GetDefaultStreamOptions(),
+		cursor:        make(map[string]cursorPos),
 
 		lock: sync.Mutex{},
 
@@ -55,6 +94,12 @@ func newClient(sSEPubSubService *SSEPubSubService) *Client {
 		privateTopics: make(map[string]*Topic),
 
 		groups: make(map[string]*Group),
+
+		patterns: make(map[string]struct{}),
+
+		roles: make(map[string]struct{}),
+
+		lastSeen: time.Now(),
 	}
 }
 
@@ -64,19 +109,31 @@ func (c *Client) stop() {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	c.stopLocked()
+}
+
+// Stop the client while its lock is held
+func (c *Client) stopLocked() {
 	if c.status == Waiting {
 		return
 	}
 
 	// Stop the client
 	c.status = Waiting
+	c.lastSeen = time.Now()
 
-	// Close the stream
-	if c.stream != nil {
-		close(c.stream)
+	// Close the stop channel to end the event stream
+	if c.stopchan != nil {
+		close(c.stopchan)
+		c.stopchan = nil
 	}
 }
 
+// Check if messages can be put into the stream of the client
+func (c *Client) isReceiving() bool {
+	return c.GetStatus() != Waiting
+}
+
 // Get ID
 func (c *Client) GetID() string {
 	c.lock.Lock()
@@ -93,6 +150,34 @@ func (c *Client) GetStatus() status {
 	return c.status
 }
 
+// Get the stream options
+func (c *Client) GetStreamOptions() StreamOptions {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.streamOptions
+}
+
+// Set the stream options.
+// They define the size of the stream buffer and what happens if it is full.
+func (c *Client) SetStreamOptions(o StreamOptions) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.streamOptions = o.normalize()
+}
+
+// Get the number of messages which were dropped because the stream was full
+func (c *Client) GetDroppedMessages() uint64 {
+	return c.dropped.Load()
+}
+
+// Count dropped messages of the client and of the service
+func (c *Client) addDropped(n uint64) {
+	c.dropped.Add(n)
+	c.metrics().addDropped(n)
+}
+
 // Get public topics
 func (c *Client) GetPublicTopics() map[string]*Topic {
 	return c.sSEPubSubService.GetPublicTopics()
@@ -117,8 +202,13 @@ func (c *Client) GetPrivateTopics() map[string]*Topic {
 	return newmap
 }
 
-// Get private topic by name
+// Get private topic by name. The name is canonicalized, so "/news/" finds "news".
 func (c *Client) GetPrivateTopicByName(name string) (*Topic, bool) {
+	return c.privateTopicByName(lookupTopicName(c, name))
+}
+
+// Get private topic by its canonical name
+func (c *Client) privateTopicByName(name string) (*Topic, bool) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
@@ -126,6 +216,31 @@ func (c *Client) GetPrivateTopicByName(name string) (*Topic, bool) {
 	return t, ok
 }
 
+// Resolve a private topic by name for the subscription hierarchy
+func (c *Client) scopeTopicByName(name string) (*Topic, bool) {
+	return c.privateTopicByName(name)
+}
+
+// Get all private topics for the subscription hierarchy
+func (c *Client) scopeTopics() map[string]*Topic {
+	return c.GetPrivateTopics()
+}
+
+// Private topics belong to the sSEPubSubService of the client
+func (c *Client) scopeService() *SSEPubSubService {
+	return c.sSEPubSubService
+}
+
+// The only client which can see a private topic is its owner
+func (c *Client) scopeClients() map[string]*Client {
+	return map[string]*Client{c.GetID(): c}
+}
+
+// Check if the client is the owner of the private topic
+func (c *Client) scopeHasClient(client *Client) bool {
+	return client == c
+}
+
 // Add group
 func (c *Client) addGroup(g *Group) {
 	c.lock.Lock()
@@ -185,15 +300,16 @@ func (c *Client) GetAllTopics() map[string]*Topic {
 	return newmap
 }
 
-// Get topic by name
+// Get topic by name. The name is canonicalized, so "/news/" finds "news".
 func (c *Client) GetTopicByName(name string) (*Topic, bool) {
 	topics := c.GetAllTopics()
 
-	t, ok := topics[name]
+	t, ok := topics[lookupTopicName(c, name)]
 	return t, ok
 }
 
-// Get subscribed topics
+// Get subscribed topics.
+// This includes the subtopics of subscribed topics.
 func (c *Client) GetSubscribedTopics() map[string]*Topic {
 	topics := make(map[string]*Topic)
 	for k, v := range c.GetAllTopics() {
@@ -204,18 +320,46 @@ func (c *Client) GetSubscribedTopics() map[string]*Topic {
 	return topics
 }
 
+// Get all topics the client receives updates of: the subscribed topics and the topics matching its patterns
+func (c *Client) getReceivedTopics() map[string]*Topic {
+	topics := make(map[string]*Topic)
+	for k, v := range c.GetAllTopics() {
+		if v.receives(c) {
+			topics[k] = v
+		}
+	}
+	return topics
+}
+
 // New private topic
-// 0. Check if topic already exists, return it if it does
-// 1. Create a new private topic
-// 2. Add the topic to the client
-// 3. Inform the client about the new topic
+// It returns nil if the name is invalid. Use CreatePrivateTopic to get the error.
 func (c *Client) NewPrivateTopic(name string) *Topic {
+	t, err := c.CreatePrivateTopic(name)
+	if err != nil {
+		c.logger().Error("Error creating private topic", logKeyClientID, c.GetID(), logKeyTopic, name, logKeyError, err)
+	}
+	return t
+}
+
+// Create a private topic
+// 0. Canonicalize the name, return an error wrapping ErrInvalidTopic if it is invalid
+// 1. Check if topic already exists, return it if it does
+// 2. Create a new private topic
+// 3. Add the topic to the client
+// 4. Inform the client about the new topic
+func (c *Client) CreatePrivateTopic(name string) (*Topic, error) {
+	name, err := canonicalTopicName(c, name)
+	if err != nil {
+		return nil, err
+	}
+
 	// if topic exists, return it
-	if t, ok := c.GetPrivateTopicByName(name); ok {
-		return t
+	if t, ok := c.privateTopicByName(name); ok {
+		return t, nil
 	}
 
 	t := newTopic(name, TPrivate)
+	t.setScope(c)
 
 	c.lock.Lock()
 	c.privateTopics[t.GetName()] = t
@@ -223,10 +367,13 @@ func (c *Client) NewPrivateTopic(name string) *Topic {
 
 	// Inform the client about the new topic
 	if err := c.sendTopicList(); err != nil {
-		log.Errorf("[C:%s]: Error sending new topic to client: %s", c.GetID(), err)
+		c.logger().Error("Error sending new topic to client", logKeyClientID, c.GetID(), logKeyError, err)
 	}
 
-	return t
+	// Emit event
+	c.sSEPubSubService.emitOnTopicCreated(t)
+
+	return t, nil
 }
 
 // Remove private topic
@@ -234,11 +381,10 @@ func (c *Client) NewPrivateTopic(name string) *Topic {
 // 1. Unsubscribe from the topic
 // 2. Remove the topic from the client
 // 3. Inform the client about the removed topic by sending the new topic list
-func (c *Client) RemovePrivateTopic(t *Topic) {
-	// if topic does not exist, return
-	if _, ok := c.GetPrivateTopicByName(t.GetName()); !ok {
-		log.Errorf("[C:%s]: topic %s does not exist", c.GetID(), t.GetName())
-		return
+func (c *Client) RemovePrivateTopic(t *Topic) error {
+	// if topic does not exist, return an error
+	if top, ok := c.GetPrivateTopicByName(t.GetName()); !ok || top != t {
+		return fmt.Errorf("%w: private topic %s of client %s", ErrTopicNotFound, t.GetName(), c.GetID())
 	}
 
 	// Remove this topic from all clients
@@ -253,29 +399,48 @@ func (c *Client) RemovePrivateTopic(t *Topic) {
 
 	// Inform the client about the removed topic by sending the new topic list
 	if err := c.sendTopicList(); err != nil {
-		log.Errorf("[C:%s]: Error sending new topic to client: %s", c.GetID(), err)
+		c.logger().Error("Error sending new topic to client", logKeyClientID, c.GetID(), logKeyError, err)
 	}
+
+	// Emit event
+	c.sSEPubSubService.emitOnTopicRemoved(t)
+
+	return nil
 }
 
 // Subscribe to a topic
 // 1. If client can subscribe to this topic, add client to topic and return nil
 // 2. Inform the client about the new topic by sending this topic as subscribed
+// 3. Send the retained values of the topic and its subtopics
+//
+// If the ACL of the topic does not allow the client, the same ErrTopicNotFound error
+// as for an unknown topic is returned, so the client can not tell that the topic exists.
 func (c *Client) Sub(topic *Topic) error {
-	// if topic exists, add client to topic and return nil
+	// if topic exists and the client can see it, add client to topic and return nil
 	if t, ok := c.GetTopicByName(topic.GetName()); ok {
-		if topic == t {
+		if topic == t && t.canAccess(c) {
 			t.addClient(c)
 
+			// Updates published from now on can be re-delivered after a reconnect, also of the subtopics
+			c.setCursor(t.GetName(), t.getCursor())
+			c.seedCursor(t.getChildren())
+
 			// Inform the client about the new topic by sending this topic as subscribed
 			if err := c.sendSubscribedTopic(t); err != nil {
-				log.Errorf("[C:%s]: Error sending new topic to client: %s", c.GetID(), err)
+				c.logger().Error("Error sending new topic to client", logKeyClientID, c.GetID(), logKeyError, err)
 			}
 
+			// Send the retained values of the topic and its subtopics
+			c.sendRetained(append([]*Topic{t}, t.getChildren()...))
+
+			// Emit event
+			c.sSEPubSubService.emitOnSubscribe(SubscriptionEvent{Client: c, Topic: t})
+
 			return nil
 		}
 	}
 
-	return fmt.Errorf("[C:%s]: topic %s does not exist or client can not subscribe to it", c.GetID(), topic.GetName())
+	return fmt.Errorf("[C:%s]: topic %s: %w", c.GetID(), topic.GetName(), ErrTopicNotFound)
 }
 
 // Unsubscribe from a topic
@@ -285,21 +450,120 @@ func (c *Client) Unsub(topic *Topic) error {
 	// if topic exists and client is subscribed to it, remove client from topic and return nil
 	if t, ok := c.GetTopicByName(topic.GetName()); ok {
 		if topic == t {
-			if !t.IsSubscribed(c) {
-				return fmt.Errorf("[C:%s]: client is not subscribed to topic %s", c.GetID(), topic.GetName())
+			if !t.isDirectSubscribed(c) {
+				return fmt.Errorf("[C:%s]: topic %s: %w", c.GetID(), topic.GetName(), ErrNotSubscribed)
 			}
 			t.removeClient(c)
+			c.removeCursor(t.GetName())
 
 			// Inform the client about the new topic by sending this topic as unsubscribed
 			if err := c.sendUnsubscribedTopic(t); err != nil {
-				log.Errorf("[C:%s]: Error sending new topic to client: %s", c.GetID(), err)
+				c.logger().Error("Error sending new topic to client", logKeyClientID, c.GetID(), logKeyError, err)
 			}
 
+			// Emit event
+			c.sSEPubSubService.emitOnUnsubscribe(SubscriptionEvent{Client: c, Topic: t})
+
 			return nil
 		}
 	}
 
-	return fmt.Errorf("[C:%s]: topic %s does not exist or client can not unsubscribe from it", c.GetID(), topic.GetName())
+	return fmt.Errorf("[C:%s]: topic %s: %w", c.GetID(), topic.GetName(), ErrTopicNotFound)
+}
+
+// Subscribe to a topic pattern
+// 0. Check if the pattern is valid
+// 1. Add the pattern to the client
+// 2. Inform the client about the new pattern by sending this pattern as subscribed
+// 3. Send the retained values of all matching topics
+//
+// The pattern matches public, group and private topics of the client,
+// including topics which are created after the subscription.
+func (c *Client) SubPattern(pattern string) error {
+	// Check if the pattern is valid
+	if err := validatePattern(pattern); err != nil {
+		return fmt.Errorf("[C:%s]: %w", c.GetID(), detailError(ErrInvalidPattern, "%s", err))
+	}
+
+	// Add the pattern to the client
+	c.lock.Lock()
+	c.patterns[pattern] = struct{}{}
+	c.lock.Unlock()
+	c.sSEPubSubService.updatePatternClient(c)
+
+	// Inform the client about the new pattern by sending this pattern as subscribed
+	if err := c.sendSubscribedPattern(pattern); err != nil {
+		c.logger().Error("Error sending new pattern to client", logKeyClientID, c.GetID(), logKeyError, err)
+	}
+
+	// Send the retained values of all matching topics
+	matching := []*Topic{}
+	for name, t := range c.GetAllTopics() {
+		if matchPattern(pattern, name) {
+			matching = append(matching, t)
+		}
+	}
+	c.sendRetained(matching)
+
+	// Updates of the matching topics published from now on can be re-delivered after a reconnect
+	c.seedCursor(matching)
+
+	// Emit event
+	c.sSEPubSubService.emitOnSubscribe(SubscriptionEvent{Client: c, Pattern: pattern})
+
+	return nil
+}
+
+// Unsubscribe from a topic pattern
+// 1. If client is subscribed to this pattern, remove it and return nil
+// 2. Inform the client about the removed pattern by sending this pattern as unsubscribed
+func (c *Client) UnsubPattern(pattern string) error {
+	// If client is subscribed to this pattern, remove it
+	c.lock.Lock()
+	if _, ok := c.patterns[pattern]; !ok {
+		c.lock.Unlock()
+		return fmt.Errorf("[C:%s]: pattern %s: %w", c.GetID(), pattern, ErrNotSubscribed)
+	}
+	delete(c.patterns, pattern)
+	c.lock.Unlock()
+	c.sSEPubSubService.updatePatternClient(c)
+
+	// Inform the client about the removed pattern by sending this pattern as unsubscribed
+	if err := c.sendUnsubscribedPattern(pattern); err != nil {
+		c.logger().Error("Error sending removed pattern to client", logKeyClientID, c.GetID(), logKeyError, err)
+	}
+
+	// Emit event
+	c.sSEPubSubService.emitOnUnsubscribe(SubscriptionEvent{Client: c, Pattern: pattern})
+
+	return nil
+}
+
+// Get subscribed patterns
+func (c *Client) GetSubscribedPatterns() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	patterns := make([]string, 0, len(c.patterns))
+	for p := range c.patterns {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+
+	return patterns
+}
+
+// Check if one of the subscribed patterns matches the topic name
+func (c *Client) matchesPattern(name string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for p := range c.patterns {
+		if matchPattern(p, name) {
+			return true
+		}
+	}
+	return false
 }
 
 // send a message to the client
@@ -313,31 +577,358 @@ func (c *Client) send(msg interface{}) error {
 	}
 
 	// Send the data
-	if c.GetStatus() == Receving {
-		data := "data: " + string(jsonData) + "\n\n"
-
-		//Try 10 times with 100ms to send data to the stream
-		for i := 0; i < 10; i++ {
-			select {
-			case c.stream <- data:
-				// successfully sent
-				log.Infof("[C:%s]: push data to stream", c.GetID())
-				return nil
-			default:
-				log.Infof("[C:%s]: stream is full: try: %d", c.GetID(), i)
-				time.Sleep(10 * time.Millisecond)		
-			}
+	return c.enqueue(&message{data: string(jsonData), time: time.Now()})
+}
+
+// enqueue puts an already marshalled message into the stream to send it to the client.
+// If the stream is full, the overflow policy of the client is applied.
+func (c *Client) enqueue(m *message) error {
+	status, wouldBlock := c.tryEnqueue(m)
+	if wouldBlock {
+		status = c.waitEnqueue(m)
+	}
+
+	switch status {
+	case NotReceiving:
+		return fmt.Errorf("[C:%s]: %w", c.GetID(), ErrNotReceiving)
+	case Dropped:
+		return fmt.Errorf("[C:%s]: %w", c.GetID(), ErrStreamFull)
+	}
+	return nil
+}
+
+// tryEnqueue puts the message into the stream without blocking.
+// If the stream is full and the client uses BlockWithTimeout, wouldBlock is true
+// and the message has to be sent with waitEnqueue.
+func (c *Client) tryEnqueue(m *message) (status DeliveryStatus, wouldBlock bool) {
+	if !c.isReceiving() {
+		return NotReceiving, false
+	}
+
+	opts := c.GetStreamOptions()
+	if c.stream.tryPush(m, opts.BufferSize) {
+		c.logger().Debug("Push data to stream", logKeyClientID, c.GetID(), logKeyTopic, m.topic)
+		return Delivered, false
+	}
+
+	// Apply the overflow policy
+	switch opts.Policy {
+	case DropNewest:
+		c.addDropped(1)
+		return Dropped, false
+
+	case DropOldest:
+		c.addDropped(uint64(c.stream.pushDropOldest(m, opts.BufferSize)))
+		return Delivered, false
+
+	case CoalesceLatest:
+		if !c.stream.replaceTopic(m) {
+			c.stream.pushDropOldest(m, opts.BufferSize)
+		}
+		c.addDropped(1)
+		return Delivered, false
+
+	case DisconnectSlowConsumer:
+		c.addDropped(1)
+		c.stop()
+		c.logger().Warn("Stream is full: slow consumer disconnected", logKeyClientID, c.GetID(), logKeyTopic, m.topic)
+		return Dropped, false
+	}
+
+	return "", true
+}
+
+// waitEnqueue blocks until there is space in the stream or the timeout of the client expires.
+func (c *Client) waitEnqueue(m *message) DeliveryStatus {
+	timeout := time.NewTimer(c.GetStreamOptions().BlockTimeout)
+	defer timeout.Stop()
+
+	for {
+		space := c.stream.spaceChan()
+		if !c.isReceiving() {
+			return NotReceiving
+		}
+		if c.stream.tryPush(m, c.GetStreamOptions().BufferSize) {
+			c.logger().Debug("Push data to stream", logKeyClientID, c.GetID(), logKeyTopic, m.topic)
+			return Delivered
+		}
+		select {
+		case <-space:
+		case <-timeout.C:
+			c.addDropped(1)
+			return Dropped
+		}
+	}
+}
+
+// enqueueAsync puts the message into the stream without blocking the caller.
+// If the client has to be waited for, the message is handed to a writer goroutine
+// of the client, which keeps the order of the messages. done is called with the result.
+func (c *Client) enqueueAsync(m *message, done func(DeliveryStatus)) {
+	c.pendingLock.Lock()
+	if len(c.pending) == 0 {
+		status, wouldBlock := c.tryEnqueue(m)
+		if !wouldBlock {
+			c.pendingLock.Unlock()
+			done(status)
+			return
+		}
+		c.pending = append(c.pending, pendingMessage{m: m, done: done})
+		c.pendingLock.Unlock()
+		go c.writePending()
+		return
+	}
+	c.pending = append(c.pending, pendingMessage{m: m, done: done})
+	c.pendingLock.Unlock()
+}
+
+// writePending is the writer goroutine of the client.
+// It puts the pending messages into the stream in order and exits when there are none left.
+func (c *Client) writePending() {
+	for {
+		c.pendingLock.Lock()
+		if len(c.pending) == 0 {
+			c.pendingLock.Unlock()
+			return
+		}
+		p := c.pending[0]
+		c.pendingLock.Unlock()
+
+		status := c.waitEnqueue(p.m)
+
+		c.pendingLock.Lock()
+		c.pending = c.pending[1:]
+		if len(c.pending) == 0 && c.pendingDone != nil {
+			close(c.pendingDone)
+			c.pendingDone = nil
+		}
+		c.pendingLock.Unlock()
+
+		p.done(status)
+	}
+}
+
+// Wait until the writer goroutine put all pending messages into the stream.
+// If ctx is done before, ctx.Err() is returned.
+func (c *Client) waitPending(ctx context.Context) error {
+	c.pendingLock.Lock()
+	if len(c.pending) == 0 {
+		c.pendingLock.Unlock()
+		return nil
+	}
+	if c.pendingDone == nil {
+		c.pendingDone = make(chan struct{})
+	}
+	done := c.pendingDone
+	c.pendingLock.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Build the SSE frame for the message.
+// Every frame carries the cursor of the client as id, so the browser
+// sends it back as Last-Event-ID when it reconnects.
+func (c *Client) frame(data string) string {
+	return c.frameEvent("", data)
+}
+
+// Build the SSE frame for the message with an event name
+func (c *Client) frameEvent(event, data string) string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	id := ""
+	if len(c.cursor) > 0 {
+		id = encodeCursor(c.cursor)
+	}
+	return sseFrame(id, event, data)
+}
+
+// Build the SSE frame for a message of the stream in the wire format of the client
+func (c *Client) frameMessage(m *message) string {
+	c.lock.Lock()
+	format := c.wireFormat
+	c.lock.Unlock()
+
+	if format == WireNamedEvents {
+		if m.topic == "" {
+			return c.frameEvent(SysEventName, m.data)
+		}
+		return c.frameEvent(m.event, string(m.payload))
+	}
+	return c.frame(m.data)
+}
+
+// deliver sends a message from the stream to the client.
+// Updates which were already delivered (e.g. by a replay) are skipped and false is returned.
+func (c *Client) deliver(m *message, onEvent OnEventFunc) bool {
+	if m.seq > 0 {
+		c.lock.Lock()
+		if last, ok := c.cursor[m.topic]; ok && last.epoch == m.epoch && m.seq <= last.seq {
+			c.lock.Unlock()
+			return false
+		}
+		c.cursor[m.topic] = cursorPos{epoch: m.epoch, seq: m.seq}
+		c.lock.Unlock()
+	}
+
+	if s := c.sSEPubSubService; s != nil && s.GetLogPayloads() {
+		c.logger().Debug("Sending message to client", logKeyClientID, c.GetID(), logKeyTopic, m.topic, logKeyPayload, m.data)
+	} else {
+		c.logger().Debug("Sending message to client", logKeyClientID, c.GetID(), logKeyTopic, m.topic)
+	}
+	span := c.startDeliverSpan(m)
+	onEvent(c.frameMessage(m))
+	span.AddEvent(EventFlush)
+	span.End()
+
+	c.metrics().addDelivered()
+	return true
+}
+
+// deliverStream sends all queued messages of the stream to the client
+func (c *Client) deliverStream(onEvent OnEventFunc) {
+	c.deliverMessages(c.stream.popAll(), onEvent)
+}
+
+// deliverMessages sends messages taken from the stream to the client
+func (c *Client) deliverMessages(msgs []*message, onEvent OnEventFunc) {
+	if len(msgs) == 0 {
+		return
+	}
+
+	m := c.metrics()
+	m.observeQueueDepth(len(msgs))
+	for _, msg := range msgs {
+		if c.deliver(msg, onEvent) && !msg.time.IsZero() {
+			m.observeSendLatency(time.Since(msg.time))
+		}
+	}
+}
+
+// Set the last delivered position in a topic
+func (c *Client) setCursor(topic string, pos cursorPos) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.cursor[topic] = pos
+}
+
+// Get the positions in the topics of the messages, nil if the client has none.
+// They restore the cursor with restoreCursor if the messages are not delivered.
+func (c *Client) cursorPositions(msgs []*message) map[string]*cursorPos {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	positions := make(map[string]*cursorPos)
+	for _, m := range msgs {
+		if m.seq == 0 {
+			continue
+		}
+		if _, ok := positions[m.topic]; ok {
+			continue
+		}
+		positions[m.topic] = nil
+		if pos, ok := c.cursor[m.topic]; ok {
+			positions[m.topic] = &pos
+		}
+	}
+	return positions
+}
+
+// Restore the positions of cursorPositions
+func (c *Client) restoreCursor(positions map[string]*cursorPos) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for topic, pos := range positions {
+		if pos == nil {
+			delete(c.cursor, topic)
+			continue
 		}
-		// handle the case where the channel is full or the client is not receiving
-		return fmt.Errorf("[C:%s]: stream is full", c.GetID())
+		c.cursor[topic] = *pos
 	}
-	return fmt.Errorf("[C:%s]: client is not receiving", c.GetID())
+}
+
+// Set the position in the topics to their last update, unless the client already has a position in them
+func (c *Client) seedCursor(topics []*Topic) {
+	for _, t := range topics {
+		pos := t.getCursor()
+
+		c.lock.Lock()
+		if last, ok := c.cursor[t.GetName()]; !ok || last.epoch != pos.epoch {
+			c.cursor[t.GetName()] = pos
+		}
+		c.lock.Unlock()
+	}
+}
+
+// Remove a topic from the cursor
+func (c *Client) removeCursor(topic string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.cursor, topic)
+}
+
+// replay re-delivers all updates of subscribed topics the browser missed.
+// 1. Decode the Last-Event-ID and merge the entries of received topics into the cursor
+// 2. Collect all updates newer than the cursor from the replay buffers
+// 3. Send the updates in the order they were published
+//
+// Entries of other topics and entries of another epoch of the topic
+// (e.g. the topic was re-created or the id comes from another instance) are ignored.
+// Topics without a position, e.g. subtopics which were created while the client was disconnected,
+// re-deliver the updates published since the client was last seen.
+func (c *Client) replay(lastEventID string, onEvent OnEventFunc) error {
+	// Decode the Last-Event-ID and merge it into the cursor
+	cursor, err := decodeCursor(lastEventID)
+	if err != nil {
+		return err
+	}
+	topics := c.getReceivedTopics()
+	c.lock.Lock()
+	for name, pos := range cursor {
+		if t, ok := topics[name]; ok && pos.epoch == t.epoch {
+			c.cursor[name] = pos
+		}
+	}
+	c.lock.Unlock()
+
+	// Collect all updates newer than the cursor from the replay buffers
+	c.lock.Lock()
+	lastSeen := c.lastSeen
+	c.lock.Unlock()
+	msgs := []*message{}
+	for name, t := range topics {
+		c.lock.Lock()
+		pos, ok := c.cursor[name]
+		c.lock.Unlock()
+		if !ok || pos.epoch != t.epoch {
+			msgs = append(msgs, t.getHistoryAfter(lastSeen)...)
+			continue
+		}
+		msgs = append(msgs, t.getHistorySince(pos.seq)...)
+	}
+
+	// Send the updates in the order they were published
+	sortMessages(msgs)
+	for _, m := range msgs {
+		c.deliver(m, onEvent)
+	}
+
+	return nil
 }
 
 // sendTopicList sends a message to the client to inform it about the topics
 func (c *Client) sendTopicList() error {
-	// Get all topics
-	topics := c.GetAllTopics()
+	// Get all topics the client can see
+	topics := c.getVisibleTopics()
 
 	// Build the JSON data
 	fulldata := &eventData{
@@ -415,16 +1006,85 @@ func (c *Client) sendUnsubscribedTopic(topic *Topic) error {
 	return nil
 }
 
+// sendRetained sends the retained values of the topics to the client
+func (c *Client) sendRetained(topics []*Topic) {
+	if !c.isReceiving() {
+		// The init message contains the retained values when the client connects
+		return
+	}
+
+	for _, t := range topics {
+		if !t.canAccess(c) {
+			continue
+		}
+		if m, ok := t.getRetained(); ok {
+			if err := c.enqueue(m); err != nil {
+				c.logger().Error("Error sending retained value", logKeyClientID, c.GetID(), logKeyTopic, t.GetName(), logKeyError, err)
+			}
+		}
+	}
+}
+
+// sendSubscribedPattern sends a message to the client to inform it about the subscribed pattern
+func (c *Client) sendSubscribedPattern(pattern string) error {
+	// Build the JSON data
+	fulldata := &eventData{
+		Sys: []eventDataSys{
+			{
+				Type: "subscribed_patterns",
+				List: []eventDataSysList{
+					{
+						Name: pattern,
+					},
+				},
+			},
+		},
+	}
+
+	// Send the JSON data to the client
+	if err := c.send(fulldata); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// sendUnsubscribedPattern sends a message to the client to inform it about the unsubscribed pattern
+func (c *Client) sendUnsubscribedPattern(pattern string) error {
+	// Build the JSON data
+	fulldata := &eventData{
+		Sys: []eventDataSys{
+			{
+				Type: "unsubscribed_patterns",
+				List: []eventDataSysList{
+					{
+						Name: pattern,
+					},
+				},
+			},
+		},
+	}
+
+	// Send the JSON data to the client
+	if err := c.send(fulldata); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // sendInitMSG generates the initial message to send to the client
-// It contains all topics and subscribed topics
+// It contains all topics, subscribed topics, subscribed patterns
+// and the retained values of subscribed topics
 func (c *Client) sendInitMSG(onEvent OnEventFunc) error {
-	// Get all topics and subscribed topics
-	topics := c.GetAllTopics()
+	// Get all visible topics, subscribed topics and subscribed patterns
+	topics := c.getVisibleTopics()
 	subtopics := c.GetSubscribedTopics()
+	patterns := c.GetSubscribedPatterns()
 
 	// Build the JSON data
 	fulldata := &eventData{
-		Sys: make([]eventDataSys, 0, 2),
+		Sys: make([]eventDataSys, 0, 3),
 	}
 
 	// Append topics data
@@ -448,13 +1108,56 @@ func (c *Client) sendInitMSG(onEvent OnEventFunc) error {
 		fulldata.Sys = append(fulldata.Sys, subTopicData)
 	}
 
+	// Append subscribed patterns data
+	if len(patterns) > 0 {
+		patternData := eventDataSys{Type: "subscribed_patterns"}
+		for _, pattern := range patterns {
+			patternData.List = append(patternData.List, eventDataSysList{Name: pattern})
+		}
+		fulldata.Sys = append(fulldata.Sys, patternData)
+	}
+
+	// Get retained values of subscribed topics and topics matching the patterns
+	retained := []*message{}
+	for _, topic := range c.getReceivedTopics() {
+		if m, ok := topic.getRetained(); ok {
+			retained = append(retained, m)
+		}
+	}
+
+	c.lock.Lock()
+	format := c.wireFormat
+	c.lock.Unlock()
+
+	// Named events: the retained values are sent as events of their own
+	if format == WireNamedEvents {
+		jsonData, err := json.Marshal(fulldata)
+		if err != nil {
+			return err
+		}
+		onEvent(c.frameEvent(SysEventName, string(jsonData)))
+
+		for _, m := range retained {
+			onEvent(c.frameMessage(m))
+		}
+		return nil
+	}
+
+	// Append retained values of subscribed topics
+	for _, m := range retained {
+		fulldata.Updates = append(fulldata.Updates, eventDataUpdates{
+			Topic: m.topic,
+			Data:  m.payload,
+		})
+	}
+
 	// Marshal the data
 	jsonData, err := json.Marshal(fulldata)
 	if err != nil {
 		return err
 	}
 
-	onEvent("data: " + string(jsonData) + "\n\n")
+	onEvent(c.frame(string(jsonData)))
 
 	// Send JSON data to the client
 	return err
@@ -468,44 +1171,119 @@ func (c *Client) sendInitMSG(onEvent OnEventFunc) error {
 // 4. Send message to client if new data is published over the stream
 // 5. Stop the client if the stop channel is closed
 func (c *Client) Start(ctx context.Context, onEvent OnEventFunc) error {
-	// Set status to Receving and create stop channel
-	if c.GetStatus() == Receving {
-		return fmt.Errorf("[C:%s]: Client is already receiving", c.GetID())
+	return c.Resume(ctx, "", onEvent)
+}
+
+// Resume starts the client like Start and re-delivers the updates the browser missed.
+// lastEventID is the Last-Event-ID the browser sent when it reconnected.
+// If it is empty, no updates are re-delivered.
+// 0. Check if client is already receiving
+// 1. Set status to Receving and create stop channel
+// 2. Send init message to client
+// 3. Re-deliver missed updates of subscribed topics
+// 4. Keep the connection open
+// 5. Send message to client if new data is published over the stream
+// 6. Write a heartbeat if no data was sent for the heartbeat interval
+// 7. Stop the client if the stop channel or the context is closed
+func (c *Client) Resume(ctx context.Context, lastEventID string, onEvent OnEventFunc) error {
+	return c.resume(ctx, lastEventID, c.sSEPubSubService.GetWireFormat(), onEvent)
+}
+
+// Resume the client with the given wire format
+func (c *Client) resume(ctx context.Context, lastEventID string, wireFormat WireFormat, onEvent OnEventFunc) error {
+	// Check if client is already receiving. The new stream takes over if takeover is enabled.
+	switch c.GetStatus() {
+	case Receving:
+		if !c.sSEPubSubService.GetTakeover() {
+			return fmt.Errorf("[C:%s]: %w", c.GetID(), ErrAlreadyReceiving)
+		}
+		c.logger().Info("Client stream taken over", logKeyClientID, c.GetID())
+		c.stop()
+	case Polling:
+		// A long-polling client switches to the event stream
+		c.stop()
 	}
 
 	// Set status to Receving and create stop channel
 	c.lock.Lock()
 	c.stopchan = make(chan struct{})
+	stopchan := c.stopchan
 	c.status = Receving
-	c.stream = make(chan string)
+	c.wireFormat = wireFormat
+	c.streamGen++
+	gen := c.streamGen
 	c.lock.Unlock()
 
-	// Stop the client at the end
-	defer func() {
+	// Register the stream, so Shutdown waits for it
+	if err := c.sSEPubSubService.addStream(c); err != nil {
 		c.stop()
+		return fmt.Errorf("[C:%s]: %w", c.GetID(), err)
+	}
+	defer c.sSEPubSubService.doneStream()
+
+	// Stop the client at the end, unless the stream was taken over
+	defer func() {
+		if c.stopStream(gen) {
+			c.sSEPubSubService.emitOnClientDisconnected(c)
+		}
 	}()
+	c.sSEPubSubService.emitOnClientConnected(c)
+
+	// Tell the browser how long to wait before it reconnects
+	if retry := c.sSEPubSubService.GetRetry(); retry > 0 {
+		onEvent(sseRetry(retry))
+	}
 
 	if err := c.sendInitMSG(onEvent); err != nil {
-		log.Errorf("[C:%s]: Error sending init message to client: %s", c.GetID(), err)
+		c.logger().Error("Error sending init message to client", logKeyClientID, c.GetID(), logKeyError, err)
 		return err
 	}
 
+	// Re-deliver missed updates of subscribed topics
+	if lastEventID != "" {
+		c.metrics().addReconnect()
+		if err := c.replay(lastEventID, onEvent); err != nil {
+			c.logger().Error("Error replaying missed updates", logKeyClientID, c.GetID(), logKeyError, err)
+		}
+	}
+
+	// Send the messages which were queued before the stream started, e.g. sys messages.
+	// Updates which were already replayed are skipped.
+	c.deliverStream(onEvent)
+
+	// Write a heartbeat if no messages were sent for the heartbeat interval
+	heartbeat := c.sSEPubSubService.GetHeartbeat()
+	heartbeatTimer := heartbeat.newTimer()
+	defer heartbeatTimer.stop()
+
 	// Keep the connection open until it's closed by the client
 loop:
 	for {
 		select {
-		case msg, ok := <-c.stream:
-			if !ok {
-				log.Infof("[C:%s] Client stopped receiving", c.GetID())
+		case <-c.stream.ready:
+			// The messages belong to the stream which took over
+			if !c.isStream(gen) {
+				c.stream.signal()
 				break loop
 			}
-			log.Infof("[C:%s] Sending message to client: %s", c.GetID(), msg)
-			onEvent(msg)
+			c.deliverStream(onEvent)
+			heartbeatTimer.reset()
+		case <-heartbeatTimer.C():
+			onEvent(heartbeat.frame(wireFormat))
+			heartbeatTimer.reset()
 		case <-ctx.Done():
-			log.Infof("[C:%s] Client stopped receiving", c.GetID())
+			c.logger().Debug("Client stopped receiving", logKeyClientID, c.GetID())
 			break loop
-		case <-c.stopchan:
-			log.Infof("[C:%s] Client stopped receiving", c.GetID())
+		case <-stopchan:
+			// Flush the pending messages, e.g. the shutdown message
+			if c.sSEPubSubService.isClosed() {
+				// EventSource ignores the shutdown message, the retry directive makes it wait for the reconnect hint
+				if reconnect := c.sSEPubSubService.GetShutdownOptions().Reconnect; reconnect > 0 {
+					onEvent(sseRetry(reconnect))
+				}
+				c.deliverStream(onEvent)
+			}
+			c.logger().Debug("Client stopped receiving", logKeyClientID, c.GetID())
 			break loop
 		}
 	}
@@ -1,6 +1,7 @@
 package pubsubsse
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -12,7 +13,7 @@ import (
 // +GetPublicTopicByName(name string): *topic, bool
 
 // +NewPrivateTopic(name string): *topic
-// +RemovePrivateTopic(t *topic)
+// +RemovePrivateTopic(t *topic): error
 // +GetPrivateTopics(): map[string]*topic
 // +GetPrivateTopicByName(name string): *topic, bool
 
@@ -25,6 +26,12 @@ import (
 
 // +Sub(topic *topic): error
 // +Unsub(topic *topic): error
+// +SubPattern(pattern string): error
+// +UnsubPattern(pattern string): error
+// +GetSubscribedPatterns(): []string
+// +SetRoles(roles ...string)
+// +GetRoles(): []string
+// +HasRole(role string): bool
 
 // +OnEvent(f OnEventFunc)
 // +RemoveOnEvent()
@@ -148,13 +155,20 @@ func TestClient_RemovePrivateTopic(t *testing.T) {
 	privTopic := client.NewPrivateTopic("test")
 
 	// Remove topic
-	client.RemovePrivateTopic(privTopic)
+	if err := client.RemovePrivateTopic(privTopic); err != nil {
+		t.Error(err)
+	}
 
 	// Get topic
 	privTopics := client.GetPrivateTopics()
 	if len(privTopics) != 0 {
 		t.Errorf("%d != 0", len(privTopics))
 	}
+
+	// Remove it again
+	if err := client.RemovePrivateTopic(privTopic); !errors.Is(err, ErrTopicNotFound) {
+		t.Errorf("Expected ErrTopicNotFound, got %v", err)
+	}
 }
 
 // TestClient_GetPrivateTopics tests Client.GetPrivateTopics()
@@ -470,3 +484,109 @@ func TestClient_send(t *testing.T) {
 	t.Error("No Updates received")
 
 }
+
+// -----------------------------
+// Patterns
+// -----------------------------
+
+// TestClient_SubPattern tests Client.SubPattern()
+func TestClient_SubPattern(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	setReceiving(client)
+
+	kitchen := ssePubSub.NewPublicTopic("sensors/kitchen/temperature")
+	humidity := ssePubSub.NewPublicTopic("sensors/kitchen/humidity")
+
+	if err := client.SubPattern("sensors/#/temperature"); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+	if err := client.SubPattern("sensors/+/temperature"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SubPattern("rooms/#"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Topics created after the subscription
+	group := ssePubSub.NewGroup("group")
+	group.AddClient(client)
+	room := group.NewTopic("rooms/1/light")
+	bath := client.NewPrivateTopic("sensors/bath/temperature")
+
+	// Private topic of another client
+	other := ssePubSub.NewClient()
+	otherRoom := other.NewPrivateTopic("rooms/2")
+
+	drainStream(t, client)
+	kitchen.Pub(21)
+	humidity.Pub(50)
+	room.Pub("on")
+	bath.Pub(24)
+	otherRoom.Pub("secret")
+
+	data := drainStream(t, client)
+	for _, name := range []string{"sensors/kitchen/temperature", "rooms/1/light", "sensors/bath/temperature"} {
+		if len(getUpdates(data, name)) != 1 {
+			t.Errorf("Expected update for %s", name)
+		}
+	}
+	for _, name := range []string{"sensors/kitchen/humidity", "rooms/2"} {
+		if len(getUpdates(data, name)) != 0 {
+			t.Errorf("Expected no update for %s", name)
+		}
+	}
+
+	// Pattern matches are not reported as subscribed topics
+	if subscribed := client.GetSubscribedTopics(); len(subscribed) != 0 {
+		t.Errorf("len(subscribed) %d != 0", len(subscribed))
+	}
+	if received := client.getReceivedTopics(); len(received) != 3 {
+		t.Errorf("len(received) %d != 3", len(received))
+	}
+	if kitchen.IsSubscribed(client) {
+		t.Error("Expected pattern match not to be reported as subscribed")
+	}
+	if len(ssePubSub.getPatternClients()) != 1 {
+		t.Error("Expected client in the pattern index")
+	}
+	if otherRoom.IsSubscribed(client) {
+		t.Error("Expected client not to be subscribed to private topic of another client")
+	}
+
+	patterns := client.GetSubscribedPatterns()
+	if len(patterns) != 2 || patterns[0] != "rooms/#" || patterns[1] != "sensors/+/temperature" {
+		t.Errorf("Unexpected patterns %v", patterns)
+	}
+}
+
+// TestClient_UnsubPattern tests Client.UnsubPattern()
+func TestClient_UnsubPattern(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	setReceiving(client)
+
+	topic := ssePubSub.NewPublicTopic("rooms/1")
+
+	if err := client.UnsubPattern("rooms/#"); err == nil {
+		t.Error("Expected error when unsubscribing from a pattern which is not subscribed")
+	}
+	if err := client.SubPattern("rooms/#"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UnsubPattern("rooms/#"); err != nil {
+		t.Fatal(err)
+	}
+
+	drainStream(t, client)
+	topic.Pub("data")
+	if len(getUpdates(drainStream(t, client), "rooms/1")) != 0 {
+		t.Error("Expected no update after unsubscribing from pattern")
+	}
+	if len(client.GetSubscribedPatterns()) != 0 {
+		t.Error("Expected no subscribed patterns")
+	}
+	if len(ssePubSub.getPatternClients()) != 0 {
+		t.Error("Expected client to be removed from the pattern index")
+	}
+}
@@ -0,0 +1,600 @@
+package pubsubsse
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Codec encodes published messages into the data field of an update.
+// The result has to be valid JSON, because it is embedded into the JSON envelope.
+type Codec interface {
+	// Name of the codec, e.g. "json"
+	Name() string
+	// Encode the message
+	Encode(v interface{}) (json.RawMessage, error)
+}
+
+// Get the codec of the service
+func (s *SSEPubSubService) GetCodec() Codec {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.codec
+}
+
+// Set the codec which encodes the messages of all topics without a codec of their own.
+// nil resets it to JSONCodec.
+func (s *SSEPubSubService) SetCodec(c Codec) {
+	if c == nil {
+		c = JSONCodec{}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.codec = c
+}
+
+// Get the codec of the topic. It is the codec of the service if the topic has none of its own.
+func (t *Topic) GetCodec() Codec {
+	t.lock.Lock()
+	codec := t.codec
+	scope := t.scope
+	t.lock.Unlock()
+
+	if codec != nil {
+		return codec
+	}
+	if scope != nil {
+		if s := scope.scopeService(); s != nil {
+			return s.GetCodec()
+		}
+	}
+	return JSONCodec{}
+}
+
+// Set the codec of the topic. nil uses the codec of the service.
+func (t *Topic) SetCodec(c Codec) {
+	t.lock.Lock()
+	t.codec = c
+	t.lock.Unlock()
+
+	t.publishBackplaneOptions()
+}
+
+// Get a built-in codec by its name, e.g. the codec of a topic of another instance
+func builtinCodec(name string) (Codec, bool) {
+	for _, c := range []Codec{JSONCodec{}, RawJSONCodec{}, ProtobufCodec{}, MsgPackCodec{}} {
+		if c.Name() == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// -----------------------------
+// JSON
+// -----------------------------
+
+// JSONCodec encodes messages with encoding/json. It is the default codec.
+// json.RawMessage is passed through without re-marshalling, it is checked to be valid JSON when it is published.
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string { return "json" }
+
+func (JSONCodec) Encode(v interface{}) (json.RawMessage, error) {
+	if raw, ok := v.(json.RawMessage); ok {
+		return raw, nil
+	}
+	return json.Marshal(v)
+}
+
+// RawJSONCodec passes already encoded JSON through.
+// It accepts json.RawMessage, []byte and string. The data is checked to be valid JSON when it is published.
+type RawJSONCodec struct{}
+
+func (RawJSONCodec) Name() string { return "raw_json" }
+
+func (RawJSONCodec) Encode(v interface{}) (json.RawMessage, error) {
+	switch d := v.(type) {
+	case json.RawMessage:
+		return d, nil
+	case []byte:
+		return d, nil
+	case string:
+		return json.RawMessage(d), nil
+	}
+	return nil, fmt.Errorf("raw_json codec can not encode %T", v)
+}
+
+// Encode bytes as base64 JSON string
+func base64JSON(b []byte) json.RawMessage {
+	return json.RawMessage(`"` + base64.StdEncoding.EncodeToString(b) + `"`)
+}
+
+// -----------------------------
+// Protobuf
+// -----------------------------
+
+// ProtoMarshaler is implemented by protobuf messages which can marshal themselves,
+// e.g. the messages generated by gogo/protobuf.
+// The messages of google.golang.org/protobuf have no Marshal method. Publish the result of
+// proto.Marshal(m) as []byte or wrap them, e.g. in a type whose Marshal calls proto.Marshal.
+type ProtoMarshaler interface {
+	Marshal() ([]byte, error)
+}
+
+// ProtobufCodec encodes protobuf messages as base64 string in the data field.
+// It accepts already serialized []byte and messages implementing ProtoMarshaler.
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) Name() string { return "protobuf" }
+
+func (ProtobufCodec) Encode(v interface{}) (json.RawMessage, error) {
+	switch m := v.(type) {
+	case []byte:
+		return base64JSON(m), nil
+	case ProtoMarshaler:
+		b, err := m.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		return base64JSON(b), nil
+	}
+	return nil, fmt.Errorf("protobuf codec can not encode %T", v)
+}
+
+// -----------------------------
+// MessagePack
+// -----------------------------
+
+// MsgPackCodec encodes messages as MessagePack, sent as base64 string in the data field.
+// Already serialized []byte are passed through.
+// Values implementing encoding.TextMarshaler (e.g. time.Time) are encoded as string,
+// values implementing encoding.BinaryMarshaler as binary.
+// Struct fields follow the rules of encoding/json: they are named by their msgpack or json tag,
+// "-" skips a field, omitempty skips empty values and the fields of embedded structs are flattened.
+// Types which can not be encoded, e.g. channels, and cyclic values return an error.
+type MsgPackCodec struct{}
+
+func (MsgPackCodec) Name() string { return "msgpack" }
+
+func (MsgPackCodec) Encode(v interface{}) (json.RawMessage, error) {
+	if b, ok := v.([]byte); ok {
+		return base64JSON(b), nil
+	}
+
+	e := &msgPackEncoder{seen: make(map[msgPackRef]struct{})}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return base64JSON(e.buf.Bytes()), nil
+}
+
+// msgPackEncoder encodes one value. It keeps the references on the current path to detect cycles.
+type msgPackEncoder struct {
+	buf  bytes.Buffer
+	seen map[msgPackRef]struct{}
+}
+
+// Reference of a pointer, map or slice. The length tells apart slices of the same array.
+type msgPackRef struct {
+	ptr uintptr
+	len int
+	typ reflect.Type
+}
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+)
+
+// Encode a value as MessagePack
+func (e *msgPackEncoder) encode(v reflect.Value) error {
+	buf := &e.buf
+	if !v.IsValid() {
+		buf.WriteByte(0xc0)
+		return nil
+	}
+
+	// Values which marshal themselves
+	if ok, err := e.encodeMarshaler(v); ok {
+		return err
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		if v.Kind() == reflect.Pointer {
+			leave, err := e.enter(v, 0)
+			if err != nil {
+				return err
+			}
+			defer leave()
+		}
+		return e.encode(v.Elem())
+
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		encodeMsgPackInt(buf, v.Int())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		encodeMsgPackUint(buf, v.Uint())
+
+	case reflect.Float32:
+		buf.WriteByte(0xca)
+		binary.Write(buf, binary.BigEndian, math.Float32bits(float32(v.Float())))
+
+	case reflect.Float64:
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v.Float()))
+
+	case reflect.String:
+		encodeMsgPackString(buf, v.String())
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			if v.IsNil() {
+				buf.WriteByte(0xc0)
+				return nil
+			}
+			leave, err := e.enter(v, v.Len())
+			if err != nil {
+				return err
+			}
+			defer leave()
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			encodeMsgPackBin(buf, b)
+			return nil
+		}
+		encodeMsgPackLen(buf, v.Len(), 0x90, 0xdc, 0xdd)
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		leave, err := e.enter(v, 0)
+		if err != nil {
+			return err
+		}
+		defer leave()
+
+		// Sort the keys, so the encoding is deterministic
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		encodeMsgPackLen(buf, len(keys), 0x80, 0xde, 0xdf)
+		for _, k := range keys {
+			if err := e.encode(k); err != nil {
+				return err
+			}
+			if err := e.encode(v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Struct:
+		fields := []msgPackField{}
+		for _, f := range msgPackFields(v.Type()) {
+			fv, ok := fieldByIndex(v, f.index)
+			if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			f.value = fv
+			fields = append(fields, f)
+		}
+		encodeMsgPackLen(buf, len(fields), 0x80, 0xde, 0xdf)
+		for _, f := range fields {
+			encodeMsgPackString(buf, f.name)
+			if err := e.encode(f.value); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("msgpack codec can not encode %s", v.Type())
+	}
+	return nil
+}
+
+// Encode a value implementing encoding.TextMarshaler or encoding.BinaryMarshaler.
+// It returns false if the value implements neither.
+func (e *msgPackEncoder) encodeMarshaler(v reflect.Value) (bool, error) {
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return false, nil
+	}
+
+	switch {
+	case v.Type().Implements(textMarshalerType):
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return true, fmt.Errorf("msgpack codec: %s: %w", v.Type(), err)
+		}
+		encodeMsgPackString(&e.buf, string(text))
+		return true, nil
+
+	case v.Type().Implements(binaryMarshalerType):
+		b, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return true, fmt.Errorf("msgpack codec: %s: %w", v.Type(), err)
+		}
+		encodeMsgPackBin(&e.buf, b)
+		return true, nil
+	}
+	return false, nil
+}
+
+// Add a reference to the current path. An error is returned if it is already on it, because the value is cyclic.
+func (e *msgPackEncoder) enter(v reflect.Value, n int) (func(), error) {
+	ref := msgPackRef{ptr: v.Pointer(), len: n, typ: v.Type()}
+	if _, ok := e.seen[ref]; ok {
+		return nil, fmt.Errorf("msgpack codec can not encode the cyclic value of %s", v.Type())
+	}
+	e.seen[ref] = struct{}{}
+	return func() { delete(e.seen, ref) }, nil
+}
+
+// Field of a struct encoded by the msgpack codec
+type msgPackField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	tagged    bool
+	value     reflect.Value
+}
+
+// Encoded fields of the struct types, they are only looked up once per type
+var msgPackFieldCache sync.Map
+
+// Get the encoded fields of a struct type like encoding/json.
+// The fields of embedded structs without a name in their tag are flattened.
+// Of several fields with the same name the least nested one wins.
+func msgPackFields(t reflect.Type) []msgPackField {
+	if fields, ok := msgPackFieldCache.Load(t); ok {
+		return fields.([]msgPackField)
+	}
+	fields := typeMsgPackFields(t)
+	msgPackFieldCache.Store(t, fields)
+	return fields
+}
+
+// Collect the encoded fields of a struct type
+func typeMsgPackFields(t reflect.Type) []msgPackField {
+	type level struct {
+		typ   reflect.Type
+		index []int
+	}
+
+	fields := []msgPackField{}
+	claimed := map[string]bool{}
+	visited := map[reflect.Type]bool{}
+	next := []level{{typ: t}}
+	for len(next) > 0 {
+		current := next
+		next = nil
+		depth := []msgPackField{}
+
+		for _, l := range current {
+			if visited[l.typ] {
+				continue
+			}
+			visited[l.typ] = true
+
+			for i := 0; i < l.typ.NumField(); i++ {
+				f := l.typ.Field(i)
+				tag := f.Tag.Get("msgpack")
+				if tag == "" {
+					tag = f.Tag.Get("json")
+				}
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+				index := append(append([]int{}, l.index...), i)
+
+				ft := f.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+					// Flatten the embedded struct, also if it is not exported, like encoding/json
+					next = append(next, level{typ: ft, index: index})
+					continue
+				}
+				if !f.IsExported() {
+					continue
+				}
+
+				field := msgPackField{name: name, index: index, tagged: name != ""}
+				if name == "" {
+					field.name = f.Name
+				}
+				field.omitEmpty = strings.Contains(","+opts+",", ",omitempty,")
+				depth = append(depth, field)
+			}
+		}
+
+		// Fields of a less nested level hide the fields with the same name.
+		// Several fields with the same name on one level are dropped, unless exactly one of them is tagged.
+		count := map[string]int{}
+		tagged := map[string]int{}
+		for _, f := range depth {
+			count[f.name]++
+			if f.tagged {
+				tagged[f.name]++
+			}
+		}
+		for _, f := range depth {
+			if claimed[f.name] {
+				continue
+			}
+			if count[f.name] == 1 || (tagged[f.name] == 1 && f.tagged) {
+				fields = append(fields, f)
+			}
+		}
+		for _, f := range depth {
+			claimed[f.name] = true
+		}
+	}
+
+	// Keep the order of the fields in the struct
+	sort.SliceStable(fields, func(i, j int) bool {
+		a, b := fields[i].index, fields[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return fields
+}
+
+// Get the field of a struct by its index. It returns false if an embedded pointer on the way is nil.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// Check if a value is empty for omitempty, like encoding/json
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// Write the length of an array or map
+func encodeMsgPackLen(buf *bytes.Buffer, n int, fix, b16, b32 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(b16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(b32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+func encodeMsgPackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0:
+		encodeMsgPackUint(buf, uint64(i))
+	case i >= -32:
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(i))
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
+
+func encodeMsgPackUint(buf *bytes.Buffer, u uint64) {
+	switch {
+	case u <= 0x7f:
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		binary.Write(buf, binary.BigEndian, uint16(u))
+	case u <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		binary.Write(buf, binary.BigEndian, uint32(u))
+	default:
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, u)
+	}
+}
+
+func encodeMsgPackString(buf *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(0xdb)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+	buf.WriteString(s)
+}
+
+func encodeMsgPackBin(buf *bytes.Buffer, b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xc4)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xc5)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(0xc6)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+	buf.Write(b)
+}
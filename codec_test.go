@@ -0,0 +1,301 @@
+package pubsubsse
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Tests for:
+// +SetCodec(c Codec)
+// +GetCodec(): Codec
+// +PubRaw(data []byte): error
+// +JSONCodec, RawJSONCodec, ProtobufCodec, MsgPackCodec
+
+// Protobuf message which marshals itself
+type fakeProto struct {
+	data []byte
+	err  error
+}
+
+func (p *fakeProto) Marshal() ([]byte, error) {
+	return p.data, p.err
+}
+
+// Decode the base64 string of an encoded message
+func decodeBase64JSON(t *testing.T, raw json.RawMessage) []byte {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		t.Fatalf("Expected base64 string, got %s", raw)
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestJSONCodec(t *testing.T) {
+	raw, err := JSONCodec{}.Encode(map[string]int{"a": 1})
+	if err != nil || string(raw) != `{"a":1}` {
+		t.Errorf("Expected {\"a\":1}, got %s %v", raw, err)
+	}
+
+	// Raw messages are passed through
+	raw, err = JSONCodec{}.Encode(json.RawMessage(`{ "b": 2 }`))
+	if err != nil || string(raw) != `{ "b": 2 }` {
+		t.Errorf("Expected raw message to be passed through, got %s %v", raw, err)
+	}
+
+	// Invalid raw messages are refused when they are published
+	topic := NewSSEPubSubService().NewPublicTopic("news")
+	if err := topic.Pub(json.RawMessage(`{`)); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("Expected ErrInvalidPayload for invalid raw message, got %v", err)
+	}
+}
+
+func TestRawJSONCodec(t *testing.T) {
+	for _, v := range []interface{}{json.RawMessage(`[1]`), []byte(`[1]`), `[1]`} {
+		raw, err := RawJSONCodec{}.Encode(v)
+		if err != nil || string(raw) != `[1]` {
+			t.Errorf("Expected [1] for %T, got %s %v", v, raw, err)
+		}
+	}
+
+	if _, err := (RawJSONCodec{}).Encode(1); err == nil {
+		t.Error("Expected error for unsupported type")
+	}
+
+	topic := NewSSEPubSubService().NewPublicTopic("news")
+	topic.SetCodec(RawJSONCodec{})
+	if err := topic.Pub(`{`); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("Expected ErrInvalidPayload for invalid JSON, got %v", err)
+	}
+}
+
+func TestProtobufCodec(t *testing.T) {
+	raw, err := ProtobufCodec{}.Encode(&fakeProto{data: []byte{0x08, 0x96, 0x01}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := decodeBase64JSON(t, raw); !bytes.Equal(b, []byte{0x08, 0x96, 0x01}) {
+		t.Errorf("Unexpected protobuf bytes %x", b)
+	}
+
+	raw, _ = ProtobufCodec{}.Encode([]byte{0x01})
+	if b := decodeBase64JSON(t, raw); !bytes.Equal(b, []byte{0x01}) {
+		t.Errorf("Unexpected protobuf bytes %x", b)
+	}
+
+	if _, err := (ProtobufCodec{}).Encode(&fakeProto{err: errors.New("fail")}); err == nil {
+		t.Error("Expected marshal error")
+	}
+	if _, err := (ProtobufCodec{}).Encode("text"); err == nil {
+		t.Error("Expected error for unsupported type")
+	}
+}
+
+func TestMsgPackCodec(t *testing.T) {
+	type data struct {
+		Name    string  `json:"name"`
+		Count   int     `msgpack:"n"`
+		Skipped bool    `json:"-"`
+		Values  []int16 `json:"values,omitempty"`
+		private int
+	}
+
+	tests := []struct {
+		value    interface{}
+		expected []byte
+	}{
+		{nil, []byte{0xc0}},
+		{true, []byte{0xc3}},
+		{5, []byte{0x05}},
+		{-1, []byte{0xff}},
+		{-100, []byte{0xd0, 0x9c}},
+		{300, []byte{0xcd, 0x01, 0x2c}},
+		{1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{"hi", []byte{0xa2, 'h', 'i'}},
+		{map[string]int{"a": 1}, []byte{0x81, 0xa1, 'a', 0x01}},
+		{[]string{"x"}, []byte{0x91, 0xa1, 'x'}},
+		{data{Name: "a", Count: 2, Values: []int16{-3}}, []byte{0x83, 0xa4, 'n', 'a', 'm', 'e', 0xa1, 'a', 0xa1, 'n', 0x02, 0xa6, 'v', 'a', 'l', 'u', 'e', 's', 0x91, 0xfd}},
+		{[3]byte{1, 2, 3}, []byte{0xc4, 0x03, 1, 2, 3}},
+	}
+
+	for _, test := range tests {
+		raw, err := MsgPackCodec{}.Encode(test.value)
+		if err != nil {
+			t.Errorf("Error encoding %v: %s", test.value, err)
+			continue
+		}
+		if b := decodeBase64JSON(t, raw); !bytes.Equal(b, test.expected) {
+			t.Errorf("Encoding %v: expected %x, got %x", test.value, test.expected, b)
+		}
+	}
+
+	if _, err := (MsgPackCodec{}).Encode(make(chan int)); err == nil {
+		t.Error("Expected error for unsupported type")
+	}
+	if _, err := (MsgPackCodec{}).Encode(struct{ C complex64 }{}); err == nil {
+		t.Error("Expected error for unsupported field type")
+	}
+}
+
+type msgPackBase struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type msgPackBinary struct{}
+
+func (msgPackBinary) MarshalBinary() ([]byte, error) { return []byte{0x01, 0x02}, nil }
+
+func TestMsgPackCodec_Fields(t *testing.T) {
+	type data struct {
+		*msgPackBase
+		Name  string        `json:"name"` // Hides the name of the embedded struct
+		Empty string        `json:"empty,omitempty"`
+		Time  time.Time     `json:"time"`
+		Bin   msgPackBinary `json:"bin"`
+	}
+
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	raw, err := MsgPackCodec{}.Encode(data{msgPackBase: &msgPackBase{ID: 1, Name: "hidden"}, Name: "a", Time: at})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{0x84, 0xa2, 'i', 'd', 0x01, 0xa4, 'n', 'a', 'm', 'e', 0xa1, 'a', 0xa4, 't', 'i', 'm', 'e', 0xb4}
+	expected = append(expected, "2024-01-02T03:04:05Z"...)
+	expected = append(expected, 0xa3, 'b', 'i', 'n', 0xc4, 0x02, 0x01, 0x02)
+	if b := decodeBase64JSON(t, raw); !bytes.Equal(b, expected) {
+		t.Errorf("Expected %x, got %x", expected, b)
+	}
+
+	// A nil embedded struct has no fields
+	raw, err = MsgPackCodec{}.Encode(struct{ *msgPackBase }{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := decodeBase64JSON(t, raw); !bytes.Equal(b, []byte{0x80}) {
+		t.Errorf("Expected empty map, got %x", b)
+	}
+}
+
+func TestMsgPackCodec_Cycle(t *testing.T) {
+	type node struct {
+		Next *node
+	}
+	n := &node{}
+	n.Next = n
+	if _, err := (MsgPackCodec{}).Encode(n); err == nil {
+		t.Error("Expected error for cyclic value")
+	}
+
+	m := map[string]interface{}{}
+	m["self"] = m
+	if _, err := (MsgPackCodec{}).Encode(m); err == nil {
+		t.Error("Expected error for cyclic map")
+	}
+
+	// The same value twice is no cycle
+	shared := &msgPackBase{ID: 1}
+	if _, err := (MsgPackCodec{}).Encode([]*msgPackBase{shared, shared}); err != nil {
+		t.Errorf("Expected shared value to be encoded, got %s", err)
+	}
+}
+
+func TestTopic_SetCodec(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	setReceiving(client)
+	client.Sub(topic)
+	drainStream(t, client)
+
+	if topic.GetCodec().Name() != "json" {
+		t.Errorf("Expected json codec by default, got %s", topic.GetCodec().Name())
+	}
+
+	// Codec of the service
+	ssePubSub.SetCodec(ProtobufCodec{})
+	if topic.GetCodec().Name() != "protobuf" {
+		t.Errorf("Expected codec of the service, got %s", topic.GetCodec().Name())
+	}
+
+	// Codec of the topic
+	topic.SetCodec(RawJSONCodec{})
+	if err := topic.Pub(`{"raw":true}`); err != nil {
+		t.Fatal(err)
+	}
+	updates := getUpdates(drainStream(t, client), "news")
+	if len(updates) != 1 {
+		t.Fatalf("Expected 1 update, got %d", len(updates))
+	}
+	if data, ok := updates[0].Data.(map[string]interface{}); !ok || data["raw"] != true {
+		t.Errorf("Expected raw JSON to be passed through, got %v", updates[0].Data)
+	}
+
+	ssePubSub.SetCodec(nil)
+	topic.SetCodec(nil)
+	if topic.GetCodec().Name() != "json" {
+		t.Errorf("Expected json codec after reset, got %s", topic.GetCodec().Name())
+	}
+}
+
+func TestTopic_PubRaw(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetCodec(MsgPackCodec{}) // Not used by PubRaw
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	setReceiving(client)
+	client.Sub(topic)
+	drainStream(t, client)
+
+	if err := topic.PubRaw([]byte(`[1,2,3]`)); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := client.stream.popAll()
+	if len(msgs) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(msgs))
+	}
+	expected := `{"sys":null,"updates":[{"topic":"news","data":[1,2,3]}]}`
+	if msgs[0].data != expected {
+		t.Errorf("Expected %s, got %s", expected, msgs[0].data)
+	}
+
+	// Invalid JSON would break the envelope for every subscriber
+	if err := topic.PubRaw([]byte(`{"a":`)); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("Expected ErrInvalidPayload for invalid JSON, got %v", err)
+	}
+	if len(client.stream.popAll()) != 0 {
+		t.Error("Expected invalid JSON not to be published")
+	}
+}
+
+func TestBackplane_Codec(t *testing.T) {
+	s1, s2 := newBackplaneServices(t)
+	s1.SetCodec(MsgPackCodec{})
+	s2.SetCodec(MsgPackCodec{})
+
+	topic := s1.NewPublicTopic("news")
+	eventually(t, "Topic not created on the other instance", func() bool {
+		_, ok := s2.GetPublicTopicByName("news")
+		return ok
+	})
+	remote, _ := s2.GetPublicTopicByName("news")
+
+	topic.Pub("hi")
+
+	// The encoded message is not encoded again
+	eventually(t, "Update not received", func() bool {
+		return len(remote.getHistorySince(0)) == 1
+	})
+	if b := decodeBase64JSON(t, remote.getHistorySince(0)[0].payload); !bytes.Equal(b, []byte{0xa2, 'h', 'i'}) {
+		t.Errorf("Expected msgpack string, got %x", b)
+	}
+}
@@ -0,0 +1,177 @@
+package pubsubsse
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors returned by the service. They are wrapped with details, use errors.Is to check for them.
+var (
+	// ErrClientNotFound is returned if there is no client with the ID.
+	ErrClientNotFound = errors.New("client not found")
+	// ErrTopicNotFound is returned if the topic does not exist or the client can not see it.
+	ErrTopicNotFound = errors.New("topic not found")
+	// ErrNotSubscribed is returned if the client is not subscribed to the topic or pattern.
+	ErrNotSubscribed = errors.New("not subscribed")
+	// ErrAlreadyReceiving is returned if the client already receives over another connection.
+	ErrAlreadyReceiving = errors.New("client is already receiving")
+	// ErrNotReceiving is returned if a message is sent to a client which is not receiving.
+	ErrNotReceiving = errors.New("client is not receiving")
+	// ErrStreamFull is returned if a message is dropped because the stream of the client is full.
+	ErrStreamFull = errors.New("stream is full")
+	// ErrInvalidTopic is returned if a topic name is not valid, e.g. empty.
+	ErrInvalidTopic = errors.New("invalid topic")
+	// ErrInvalidPattern is returned if a topic pattern is not valid.
+	ErrInvalidPattern = errors.New("invalid pattern")
+	// ErrInvalidRequest is returned if the parameters of an HTTP request are not valid.
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrGroupNotFound is returned if the group does not exist in the service.
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrAlreadyMember is returned if the client is already a member of the group.
+	ErrAlreadyMember = errors.New("client is already a member of the group")
+	// ErrNotMember is returned if the client is not a member of the group.
+	ErrNotMember = errors.New("client is not a member of the group")
+	// ErrInvalidClientID is returned if a client ID supplied by the application is not valid, e.g. empty.
+	ErrInvalidClientID = errors.New("invalid client id")
+	// ErrServiceClosed is returned if a client or stream is started after the service was shut down.
+	ErrServiceClosed = errors.New("service is shut down")
+	// ErrInvalidEventName is returned if an SSE event name contains a line break, which would break the frame.
+	ErrInvalidEventName = errors.New("invalid event name")
+	// ErrInvalidPayload is returned if the encoded data of a message is not valid JSON.
+	ErrInvalidPayload = errors.New("invalid payload")
+
+	errRouteNotFound    = errors.New("not found")
+	errMethodNotAllowed = errors.New("method not allowed")
+)
+
+// DetailError is a client error with a detail which may be shown to the client, e.g. which parameter is invalid.
+// The message of the error response is Err followed by Detail. Other details of the error, e.g. client IDs, are not exposed.
+// Authorizers can return it to tell the client why it was refused.
+type DetailError struct {
+	Err    error
+	Detail string
+}
+
+func (e *DetailError) Error() string {
+	if e.Detail == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + e.Detail
+}
+
+func (e *DetailError) Unwrap() error {
+	return e.Err
+}
+
+// Create a DetailError with a formatted detail
+func detailError(err error, format string, args ...interface{}) error {
+	return &DetailError{Err: err, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Error codes of the JSON error responses
+const (
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeClientNotFound   = "client_not_found"
+	CodeTopicNotFound    = "topic_not_found"
+	CodeNotSubscribed    = "not_subscribed"
+	CodeAlreadyReceiving = "already_receiving"
+	CodeInvalidTopic     = "invalid_topic"
+	CodeInvalidPattern   = "invalid_pattern"
+	CodeInvalidRequest   = "invalid_request"
+	CodeGroupNotFound    = "group_not_found"
+	CodeAlreadyMember    = "already_member"
+	CodeNotMember        = "not_member"
+	CodeServiceClosed    = "service_closed"
+	CodeInvalidClientID  = "invalid_client_id"
+	CodeInvalidPayload   = "invalid_payload"
+	CodeInvalidEventName = "invalid_event_name"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeInternal         = "internal_error"
+)
+
+// ErrorResponse is the JSON body of all error responses of the HTTP handlers:
+//
+//	{"ok": false, "error": {"code": "client_not_found", "message": "client not found"}}
+//
+// Code is machine-readable (one of the Code constants), Message is meant for humans.
+type ErrorResponse struct {
+	OK    bool        `json:"ok"`
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes the error of an ErrorResponse.
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Mapping of the errors to status codes and error codes
+var errorStatus = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{ErrUnauthorized, http.StatusUnauthorized, CodeUnauthorized},
+	{ErrForbidden, http.StatusForbidden, CodeForbidden},
+	{ErrClientNotFound, http.StatusNotFound, CodeClientNotFound},
+	{ErrTopicNotFound, http.StatusNotFound, CodeTopicNotFound},
+	{ErrNotSubscribed, http.StatusConflict, CodeNotSubscribed},
+	{ErrAlreadyReceiving, http.StatusConflict, CodeAlreadyReceiving},
+	{ErrInvalidTopic, http.StatusBadRequest, CodeInvalidTopic},
+	{ErrInvalidPattern, http.StatusBadRequest, CodeInvalidPattern},
+	{ErrInvalidRequest, http.StatusBadRequest, CodeInvalidRequest},
+	{ErrGroupNotFound, http.StatusNotFound, CodeGroupNotFound},
+	{ErrAlreadyMember, http.StatusConflict, CodeAlreadyMember},
+	{ErrNotMember, http.StatusConflict, CodeNotMember},
+	{ErrServiceClosed, http.StatusServiceUnavailable, CodeServiceClosed},
+	{ErrInvalidClientID, http.StatusBadRequest, CodeInvalidClientID},
+	{ErrInvalidPayload, http.StatusBadRequest, CodeInvalidPayload},
+	{ErrInvalidEventName, http.StatusBadRequest, CodeInvalidEventName},
+	{errRouteNotFound, http.StatusNotFound, CodeNotFound},
+	{errMethodNotAllowed, http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+}
+
+// Get the status code and the error detail of an error.
+// The message is the error of the status, followed by the detail of a DetailError for client errors (4xx),
+// e.g. which parameter is invalid. Unknown errors are internal errors, their message is not exposed.
+func errorDetail(err error) (int, ErrorDetail) {
+	for _, e := range errorStatus {
+		if errors.Is(err, e.err) {
+			message := e.err.Error()
+			var detail *DetailError
+			if e.status < http.StatusInternalServerError && errors.As(err, &detail) && errors.Is(detail, e.err) {
+				message = detail.Error()
+			}
+			return e.status, ErrorDetail{Code: e.code, Message: message}
+		}
+	}
+	return http.StatusInternalServerError, ErrorDetail{Code: CodeInternal, Message: "internal server error"}
+}
+
+// Write the JSON error response of the error
+func writeError(s *SSEPubSubService, w http.ResponseWriter, err error) {
+	status, detail := errorDetail(err)
+	if status == http.StatusInternalServerError {
+		s.GetLogger().Error("Internal server error", logKeyError, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&ErrorResponse{OK: false, Error: detail})
+}
+
+// Write a JSON success response. The fields are added to {"ok": true}.
+func writeOK(w http.ResponseWriter, fields map[string]string) {
+	resp := map[string]interface{}{"ok": true}
+	for k, v := range fields {
+		resp[k] = v
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,126 @@
+package pubsubsse
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// Tests for:
+// -errorDetail(err error): int, ErrorDetail
+// -writeError(s *SSEPubSubService, w ResponseWriter, err error)
+// +ErrClientNotFound, ErrTopicNotFound, ErrNotSubscribed, ErrAlreadyReceiving, ...
+
+// JSON response of the HTTP handlers
+type apiResponse struct {
+	OK          bool         `json:"ok"`
+	ClientID    string       `json:"client_id"`
+	ClientToken string       `json:"client_token"`
+	TopicName   string       `json:"topic_name"`
+	Error       *ErrorDetail `json:"error"`
+}
+
+// Get the error code of the response
+func (r apiResponse) errorCode() string {
+	if r.Error == nil {
+		return ""
+	}
+	return r.Error.Code
+}
+
+func TestErrorDetail(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	topic := ssePubSub.NewPublicTopic("news")
+
+	err := client.Unsub(topic)
+	if !errors.Is(err, ErrNotSubscribed) {
+		t.Errorf("Expected ErrNotSubscribed, got %v", err)
+	}
+	status, detail := errorDetail(err)
+	// The internal details of the error, e.g. the client ID, are not exposed
+	if status != http.StatusConflict || detail.Code != CodeNotSubscribed || detail.Message != "not subscribed" {
+		t.Errorf("Unexpected error detail %d %v", status, detail)
+	}
+
+	// The detail of a DetailError is exposed
+	_, err = ssePubSub.CreatePublicTopic("a/+")
+	status, detail = errorDetail(fmt.Errorf("[C:%s]: %w", client.GetID(), err))
+	if status != http.StatusBadRequest || detail.Message != `invalid topic: topic a/+ contains the character '+'` {
+		t.Errorf("Unexpected error detail %d %v", status, detail)
+	}
+
+	// Invalid event names are client errors
+	if err := topic.SetEventName("a\nb"); !errors.Is(err, ErrInvalidEventName) {
+		t.Errorf("Expected ErrInvalidEventName, got %v", err)
+	} else if status, detail := errorDetail(err); status != http.StatusBadRequest || detail.Code != CodeInvalidEventName {
+		t.Errorf("Unexpected error detail %d %v", status, detail)
+	}
+
+	if err := client.SubPattern("a/#/b"); !errors.Is(err, ErrInvalidPattern) {
+		t.Errorf("Expected ErrInvalidPattern, got %v", err)
+	}
+	if err := client.Sub(NewSSEPubSubService().NewPublicTopic("other")); !errors.Is(err, ErrTopicNotFound) {
+		t.Errorf("Expected ErrTopicNotFound, got %v", err)
+	}
+
+	// Invalid payloads are client errors
+	if err := topic.PubRaw([]byte(`{`)); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("Expected ErrInvalidPayload, got %v", err)
+	} else if status, detail := errorDetail(err); status != http.StatusBadRequest || detail.Code != CodeInvalidPayload {
+		t.Errorf("Unexpected error detail %d %v", status, detail)
+	}
+
+	// Unknown errors are not exposed
+	status, detail = errorDetail(errors.New("secret"))
+	if status != http.StatusInternalServerError || detail.Code != CodeInternal || detail.Message == "secret" {
+		t.Errorf("Unexpected error detail %d %v", status, detail)
+	}
+}
+
+func TestHandler_ErrorStatus(t *testing.T) {
+	s := NewSSEPubSubService()
+	client := s.NewClient()
+	id := client.GetID()
+	topic := s.NewPublicTopic("news")
+	topic.SetACL(&TopicACL{})
+	s.NewPublicTopic("open")
+
+	tests := []struct {
+		name    string
+		handler func(*SSEPubSubService, http.ResponseWriter, *http.Request)
+		url     string
+		status  int
+		code    string
+	}{
+		{"empty topic", AddPublicTopic, "/add/topic/public?topic=", http.StatusBadRequest, CodeInvalidTopic},
+		{"unknown client", Subscribe, "/sub?client_id=unknown&topic=news", http.StatusNotFound, CodeClientNotFound},
+		{"unknown topic", Subscribe, "/sub?client_id=" + id + "&topic=unknown", http.StatusNotFound, CodeTopicNotFound},
+		{"hidden topic", Subscribe, "/sub?client_id=" + id + "&topic=news", http.StatusNotFound, CodeTopicNotFound},
+		{"invalid pattern", Subscribe, "/sub?client_id=" + id + "&topic=a/%23/b", http.StatusBadRequest, CodeInvalidPattern},
+		{"not subscribed", Unsubscribe, "/unsub?client_id=" + id + "&topic=open", http.StatusConflict, CodeNotSubscribed},
+		{"pattern not subscribed", Unsubscribe, "/unsub?client_id=" + id + "&topic=a/%23", http.StatusConflict, CodeNotSubscribed},
+	}
+
+	for _, test := range tests {
+		code, body := doRequest(s, test.handler, test.url, nil)
+		if code != test.status || body.OK || body.errorCode() != test.code {
+			t.Errorf("%s: expected %d %s, got %d %+v", test.name, test.status, test.code, code, body.Error)
+		}
+	}
+
+	// Already receiving
+	_, cancel := resumeClient(client, "")
+	defer cancel()
+	code, body := doRequest(s, Event, "/event?client_id="+id, nil)
+	if code != http.StatusConflict || body.errorCode() != CodeAlreadyReceiving {
+		t.Errorf("Expected 409 already_receiving, got %d %+v", code, body.Error)
+	}
+
+	// Success
+	code, body = doRequest(s, Subscribe, "/sub?client_id="+id+"&topic=open", nil)
+	if code != http.StatusOK || !body.OK || body.Error != nil {
+		t.Errorf("Expected ok, got %d %+v", code, body)
+	}
+}
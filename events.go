@@ -0,0 +1,500 @@
+package pubsubsse
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// EventDispatch is how the event handlers are called.
+type EventDispatch int
+
+const (
+	// DispatchAsync calls every handler in its own goroutine. It is the default.
+	DispatchAsync EventDispatch = iota
+	// DispatchSync calls the handlers one after another, in the order they were added,
+	// in the goroutine which caused the event. No lock of the service is held,
+	// so handlers may call the service, but they delay the operation which caused the event.
+	DispatchSync
+)
+
+// SubscriptionEvent is emitted when a client subscribes or unsubscribes a topic or pattern.
+type SubscriptionEvent struct {
+	Client *Client
+	// Topic is the subscribed topic, nil for pattern subscriptions.
+	Topic *Topic
+	// Pattern is the subscribed pattern, empty for topic subscriptions.
+	Pattern string
+}
+
+// TopicEvent is emitted when a topic is created or removed.
+type TopicEvent struct {
+	Topic *Topic
+	// Type is the type of the topic: public, private or group.
+	Type string
+	// Client is the owner of a private topic.
+	Client *Client
+	// Group is the group of a group topic.
+	Group *Group
+}
+
+// GroupEvent is emitted when a client joins or leaves a group.
+type GroupEvent struct {
+	Group  *Group
+	Client *Client
+}
+
+// PublishEvent is emitted when an update is published to the subscribers of a topic,
+// including updates received from other instances over the backplane.
+type PublishEvent struct {
+	Topic *Topic
+	// Seq is the sequence number of the update in the topic.
+	Seq uint64
+	// Event is the SSE event name of the update.
+	Event string
+	// Data is the encoded data of the update. It must not be modified.
+	Data json.RawMessage
+}
+
+// Handlers of an event, in the order they were added
+type eventHandlers[T any] struct {
+	lock     sync.Mutex
+	ids      []string
+	handlers map[string]func(T)
+}
+
+// Add a handler and return its ID
+func (e *eventHandlers[T]) add(f func(T)) string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.handlers == nil {
+		e.handlers = make(map[string]func(T))
+	}
+	id := uuid.New().String()
+	e.ids = append(e.ids, id)
+	e.handlers[id] = f
+	return id
+}
+
+// Remove the handler with the ID
+func (e *eventHandlers[T]) remove(id string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if _, ok := e.handlers[id]; !ok {
+		return
+	}
+	delete(e.handlers, id)
+	for i, hid := range e.ids {
+		if hid == id {
+			e.ids = append(e.ids[:i:i], e.ids[i+1:]...)
+			break
+		}
+	}
+}
+
+// Call the handlers with the event. The handlers are copied, so no lock is held while they run.
+func (e *eventHandlers[T]) emit(dispatch EventDispatch, v T) {
+	e.lock.Lock()
+	if len(e.ids) == 0 {
+		e.lock.Unlock()
+		return
+	}
+	handlers := make([]func(T), 0, len(e.ids))
+	for _, id := range e.ids {
+		handlers = append(handlers, e.handlers[id])
+	}
+	e.lock.Unlock()
+
+	for _, f := range handlers {
+		if dispatch == DispatchSync {
+			f(v)
+		} else {
+			go f(v)
+		}
+	}
+}
+
+// Handlers of all events of a service and how they are called
+type serviceEvents struct {
+	dispatch     EventDispatch
+	dispatchLock sync.RWMutex
+
+	newClient          eventHandlers[*Client]
+	clientExpired      eventHandlers[*Client]
+	clientRemoved      eventHandlers[*Client]
+	clientConnected    eventHandlers[*Client]
+	clientDisconnected eventHandlers[*Client]
+	subscribe          eventHandlers[SubscriptionEvent]
+	unsubscribe        eventHandlers[SubscriptionEvent]
+	topicCreated       eventHandlers[TopicEvent]
+	topicRemoved       eventHandlers[TopicEvent]
+	// Handlers of the topic events of one type
+	publicTopicCreated  eventHandlers[TopicEvent]
+	publicTopicRemoved  eventHandlers[TopicEvent]
+	privateTopicCreated eventHandlers[TopicEvent]
+	privateTopicRemoved eventHandlers[TopicEvent]
+	groupTopicCreated   eventHandlers[TopicEvent]
+	groupTopicRemoved   eventHandlers[TopicEvent]
+	groupJoin           eventHandlers[GroupEvent]
+	groupLeave          eventHandlers[GroupEvent]
+	publish             eventHandlers[PublishEvent]
+}
+
+// Get how the event handlers are called
+func (s *SSEPubSubService) GetEventDispatch() EventDispatch {
+	s.events.dispatchLock.RLock()
+	defer s.events.dispatchLock.RUnlock()
+
+	return s.events.dispatch
+}
+
+// Set how the event handlers are called (DispatchAsync or DispatchSync)
+func (s *SSEPubSubService) SetEventDispatch(d EventDispatch) {
+	s.events.dispatchLock.Lock()
+	defer s.events.dispatchLock.Unlock()
+
+	s.events.dispatch = d
+}
+
+// Build the event of a topic
+func newTopicEvent(t *Topic) TopicEvent {
+	e := TopicEvent{Topic: t, Type: t.GetType()}
+	switch scope := t.getScope().(type) {
+	case *Client:
+		e.Client = scope
+	case *Group:
+		e.Group = scope
+	}
+	return e
+}
+
+// Get the handlers of the created and removed events of a topic type
+func (e *serviceEvents) topicHandlers(ttype string) (created, removed *eventHandlers[TopicEvent]) {
+	switch topicType(ttype) {
+	case TPublic:
+		return &e.publicTopicCreated, &e.publicTopicRemoved
+	case TPrivate:
+		return &e.privateTopicCreated, &e.privateTopicRemoved
+	case TGroup:
+		return &e.groupTopicCreated, &e.groupTopicRemoved
+	}
+	return nil, nil
+}
+
+// Get the service of the topic. nil if the topic has no service.
+func (t *Topic) service() *SSEPubSubService {
+	scope := t.getScope()
+	if scope == nil {
+		return nil
+	}
+	return scope.scopeService()
+}
+
+// -----------------------------
+// Client events
+// -----------------------------
+
+// Event: When client is created
+func (s *SSEPubSubService) OnNewClient(f funcClient) string {
+	return s.events.newClient.add(f)
+}
+
+// Remove Event: When client is created
+func (s *SSEPubSubService) RemoveOnNewClient(id string) {
+	s.events.newClient.remove(id)
+}
+
+// Emit Event: When client is created
+func (s *SSEPubSubService) emitOnNewClient(c *Client) {
+	if s == nil {
+		return
+	}
+	s.events.newClient.emit(s.GetEventDispatch(), c)
+}
+
+// Event: When client expired and was removed.
+// The handlers are always called asynchronously, also with DispatchSync.
+func (s *SSEPubSubService) OnClientExpired(f funcClient) string {
+	return s.events.clientExpired.add(f)
+}
+
+// Remove Event: When client expired and was removed
+func (s *SSEPubSubService) RemoveOnClientExpired(id string) {
+	s.events.clientExpired.remove(id)
+}
+
+// Emit Event: When client expired and was removed.
+// It is always dispatched asynchronously, because it is emitted by the janitor, which StopJanitor waits for.
+func (s *SSEPubSubService) emitOnClientExpired(c *Client) {
+	if s == nil {
+		return
+	}
+	s.events.clientExpired.emit(DispatchAsync, c)
+}
+
+// Event: When client was removed, e.g. with RemoveClient or because it expired
+func (s *SSEPubSubService) OnClientRemoved(f funcClient) string {
+	return s.events.clientRemoved.add(f)
+}
+
+// Remove Event: When client was removed
+func (s *SSEPubSubService) RemoveOnClientRemoved(id string) {
+	s.events.clientRemoved.remove(id)
+}
+
+// Emit Event: When client was removed
+func (s *SSEPubSubService) emitOnClientRemoved(c *Client) {
+	if s == nil {
+		return
+	}
+	s.events.clientRemoved.emit(s.GetEventDispatch(), c)
+}
+
+// Event: When the event stream of a client started (Start, Event or WebSocket)
+func (s *SSEPubSubService) OnClientConnected(f funcClient) string {
+	return s.events.clientConnected.add(f)
+}
+
+// Remove Event: When the event stream of a client started
+func (s *SSEPubSubService) RemoveOnClientConnected(id string) {
+	s.events.clientConnected.remove(id)
+}
+
+// Emit Event: When the event stream of a client started
+func (s *SSEPubSubService) emitOnClientConnected(c *Client) {
+	if s == nil {
+		return
+	}
+	s.events.clientConnected.emit(s.GetEventDispatch(), c)
+}
+
+// Event: When the event stream of a client stopped
+func (s *SSEPubSubService) OnClientDisconnected(f funcClient) string {
+	return s.events.clientDisconnected.add(f)
+}
+
+// Remove Event: When the event stream of a client stopped
+func (s *SSEPubSubService) RemoveOnClientDisconnected(id string) {
+	s.events.clientDisconnected.remove(id)
+}
+
+// Emit Event: When the event stream of a client stopped
+func (s *SSEPubSubService) emitOnClientDisconnected(c *Client) {
+	if s == nil {
+		return
+	}
+	s.events.clientDisconnected.emit(s.GetEventDispatch(), c)
+}
+
+// -----------------------------
+// Subscription events
+// -----------------------------
+
+// Event: When client subscribed a topic or pattern
+func (s *SSEPubSubService) OnSubscribe(f func(SubscriptionEvent)) string {
+	return s.events.subscribe.add(f)
+}
+
+// Remove Event: When client subscribed a topic or pattern
+func (s *SSEPubSubService) RemoveOnSubscribe(id string) {
+	s.events.subscribe.remove(id)
+}
+
+// Emit Event: When client subscribed a topic or pattern
+func (s *SSEPubSubService) emitOnSubscribe(e SubscriptionEvent) {
+	if s == nil {
+		return
+	}
+	s.events.subscribe.emit(s.GetEventDispatch(), e)
+}
+
+// Event: When client unsubscribed a topic or pattern
+func (s *SSEPubSubService) OnUnsubscribe(f func(SubscriptionEvent)) string {
+	return s.events.unsubscribe.add(f)
+}
+
+// Remove Event: When client unsubscribed a topic or pattern
+func (s *SSEPubSubService) RemoveOnUnsubscribe(id string) {
+	s.events.unsubscribe.remove(id)
+}
+
+// Emit Event: When client unsubscribed a topic or pattern
+func (s *SSEPubSubService) emitOnUnsubscribe(e SubscriptionEvent) {
+	if s == nil {
+		return
+	}
+	s.events.unsubscribe.emit(s.GetEventDispatch(), e)
+}
+
+// -----------------------------
+// Topic and group events
+// -----------------------------
+
+// Event: When a public, private or group topic was created.
+// Use OnPublicTopicCreated, OnPrivateTopicCreated or OnGroupTopicCreated for the topics of one type.
+func (s *SSEPubSubService) OnTopicCreated(f func(TopicEvent)) string {
+	return s.events.topicCreated.add(f)
+}
+
+// Remove Event: When a topic was created
+func (s *SSEPubSubService) RemoveOnTopicCreated(id string) {
+	s.events.topicCreated.remove(id)
+}
+
+// Emit Event: When a topic was created
+func (s *SSEPubSubService) emitOnTopicCreated(t *Topic) {
+	if s == nil {
+		return
+	}
+	e := newTopicEvent(t)
+	dispatch := s.GetEventDispatch()
+	s.events.topicCreated.emit(dispatch, e)
+	if created, _ := s.events.topicHandlers(e.Type); created != nil {
+		created.emit(dispatch, e)
+	}
+}
+
+// Event: When a public, private or group topic was removed.
+// Use OnPublicTopicRemoved, OnPrivateTopicRemoved or OnGroupTopicRemoved for the topics of one type.
+func (s *SSEPubSubService) OnTopicRemoved(f func(TopicEvent)) string {
+	return s.events.topicRemoved.add(f)
+}
+
+// Remove Event: When a topic was removed
+func (s *SSEPubSubService) RemoveOnTopicRemoved(id string) {
+	s.events.topicRemoved.remove(id)
+}
+
+// Emit Event: When a topic was removed
+func (s *SSEPubSubService) emitOnTopicRemoved(t *Topic) {
+	if s == nil {
+		return
+	}
+	e := newTopicEvent(t)
+	dispatch := s.GetEventDispatch()
+	s.events.topicRemoved.emit(dispatch, e)
+	if _, removed := s.events.topicHandlers(e.Type); removed != nil {
+		removed.emit(dispatch, e)
+	}
+}
+
+// Event: When a public topic was created
+func (s *SSEPubSubService) OnPublicTopicCreated(f func(TopicEvent)) string {
+	return s.events.publicTopicCreated.add(f)
+}
+
+// Remove Event: When a public topic was created
+func (s *SSEPubSubService) RemoveOnPublicTopicCreated(id string) {
+	s.events.publicTopicCreated.remove(id)
+}
+
+// Event: When a public topic was removed
+func (s *SSEPubSubService) OnPublicTopicRemoved(f func(TopicEvent)) string {
+	return s.events.publicTopicRemoved.add(f)
+}
+
+// Remove Event: When a public topic was removed
+func (s *SSEPubSubService) RemoveOnPublicTopicRemoved(id string) {
+	s.events.publicTopicRemoved.remove(id)
+}
+
+// Event: When a private topic was created. TopicEvent.Client is the owner of the topic.
+func (s *SSEPubSubService) OnPrivateTopicCreated(f func(TopicEvent)) string {
+	return s.events.privateTopicCreated.add(f)
+}
+
+// Remove Event: When a private topic was created
+func (s *SSEPubSubService) RemoveOnPrivateTopicCreated(id string) {
+	s.events.privateTopicCreated.remove(id)
+}
+
+// Event: When a private topic was removed. TopicEvent.Client is the owner of the topic.
+func (s *SSEPubSubService) OnPrivateTopicRemoved(f func(TopicEvent)) string {
+	return s.events.privateTopicRemoved.add(f)
+}
+
+// Remove Event: When a private topic was removed
+func (s *SSEPubSubService) RemoveOnPrivateTopicRemoved(id string) {
+	s.events.privateTopicRemoved.remove(id)
+}
+
+// Event: When a group topic was created. TopicEvent.Group is the group of the topic.
+func (s *SSEPubSubService) OnGroupTopicCreated(f func(TopicEvent)) string {
+	return s.events.groupTopicCreated.add(f)
+}
+
+// Remove Event: When a group topic was created
+func (s *SSEPubSubService) RemoveOnGroupTopicCreated(id string) {
+	s.events.groupTopicCreated.remove(id)
+}
+
+// Event: When a group topic was removed. TopicEvent.Group is the group of the topic.
+func (s *SSEPubSubService) OnGroupTopicRemoved(f func(TopicEvent)) string {
+	return s.events.groupTopicRemoved.add(f)
+}
+
+// Remove Event: When a group topic was removed
+func (s *SSEPubSubService) RemoveOnGroupTopicRemoved(id string) {
+	s.events.groupTopicRemoved.remove(id)
+}
+
+// Event: When client joined a group
+func (s *SSEPubSubService) OnGroupJoin(f func(GroupEvent)) string {
+	return s.events.groupJoin.add(f)
+}
+
+// Remove Event: When client joined a group
+func (s *SSEPubSubService) RemoveOnGroupJoin(id string) {
+	s.events.groupJoin.remove(id)
+}
+
+// Emit Event: When client joined a group
+func (s *SSEPubSubService) emitOnGroupJoin(e GroupEvent) {
+	if s == nil {
+		return
+	}
+	s.events.groupJoin.emit(s.GetEventDispatch(), e)
+}
+
+// Event: When client left a group
+func (s *SSEPubSubService) OnGroupLeave(f func(GroupEvent)) string {
+	return s.events.groupLeave.add(f)
+}
+
+// Remove Event: When client left a group
+func (s *SSEPubSubService) RemoveOnGroupLeave(id string) {
+	s.events.groupLeave.remove(id)
+}
+
+// Emit Event: When client left a group
+func (s *SSEPubSubService) emitOnGroupLeave(e GroupEvent) {
+	if s == nil {
+		return
+	}
+	s.events.groupLeave.emit(s.GetEventDispatch(), e)
+}
+
+// -----------------------------
+// Publish events
+// -----------------------------
+
+// Event: When an update was published to the subscribers of a topic
+func (s *SSEPubSubService) OnPublish(f func(PublishEvent)) string {
+	return s.events.publish.add(f)
+}
+
+// Remove Event: When an update was published
+func (s *SSEPubSubService) RemoveOnPublish(id string) {
+	s.events.publish.remove(id)
+}
+
+// Emit Event: When an update was published
+func (s *SSEPubSubService) emitOnPublish(e PublishEvent) {
+	if s == nil {
+		return
+	}
+	s.events.publish.emit(s.GetEventDispatch(), e)
+}
@@ -0,0 +1,272 @@
+package pubsubsse
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Tests for:
+// +SetEventDispatch(d EventDispatch)
+// +OnClientRemoved(f funcClient): string
+// +OnClientConnected(f funcClient): string
+// +OnClientDisconnected(f funcClient): string
+// +OnSubscribe(f func(SubscriptionEvent)): string
+// +OnUnsubscribe(f func(SubscriptionEvent)): string
+// +OnTopicCreated(f func(TopicEvent)): string
+// +OnTopicRemoved(f func(TopicEvent)): string
+// +OnPublicTopicCreated(f func(TopicEvent)): string, OnPrivateTopicCreated, OnGroupTopicCreated
+// +OnPublicTopicRemoved(f func(TopicEvent)): string, OnPrivateTopicRemoved, OnGroupTopicRemoved
+// +OnGroupJoin(f func(GroupEvent)): string
+// +OnGroupLeave(f func(GroupEvent)): string
+// +OnPublish(f func(PublishEvent)): string
+
+// Records the names of the emitted events in order
+type eventRecorder struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (r *eventRecorder) add(e string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *eventRecorder) get() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string{}, r.events...)
+}
+
+func TestSSEPubSubService_Events(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetEventDispatch(DispatchSync)
+	r := &eventRecorder{}
+
+	ssePubSub.OnNewClient(func(c *Client) { r.add("new") })
+	ssePubSub.OnClientRemoved(func(c *Client) { r.add("removed") })
+	ssePubSub.OnClientConnected(func(c *Client) { r.add("connected") })
+	ssePubSub.OnClientDisconnected(func(c *Client) { r.add("disconnected") })
+	ssePubSub.OnSubscribe(func(e SubscriptionEvent) {
+		if e.Topic != nil {
+			r.add("sub " + e.Topic.GetName())
+		} else {
+			r.add("sub " + e.Pattern)
+		}
+	})
+	ssePubSub.OnUnsubscribe(func(e SubscriptionEvent) {
+		if e.Topic != nil {
+			r.add("unsub " + e.Topic.GetName())
+		} else {
+			r.add("unsub " + e.Pattern)
+		}
+	})
+	ssePubSub.OnTopicCreated(func(e TopicEvent) { r.add("created " + e.Type + " " + e.Topic.GetName()) })
+	ssePubSub.OnTopicRemoved(func(e TopicEvent) { r.add("removed " + e.Type + " " + e.Topic.GetName()) })
+	ssePubSub.OnGroupJoin(func(e GroupEvent) { r.add("join " + e.Group.GetName()) })
+	ssePubSub.OnGroupLeave(func(e GroupEvent) { r.add("leave " + e.Group.GetName()) })
+	ssePubSub.OnPublish(func(e PublishEvent) { r.add("pub " + e.Topic.GetName() + " " + string(e.Data)) })
+
+	topic := ssePubSub.NewPublicTopic("news")
+	ssePubSub.NewPublicTopic("news") // Already exists
+	client := ssePubSub.NewClient()
+	client.Sub(topic)
+	client.SubPattern("news/*")
+	topic.Pub("a")
+	client.UnsubPattern("news/*")
+	client.NewPrivateTopic("private")
+
+	g := ssePubSub.NewGroup("g")
+	g.AddClient(client)
+	g.NewTopic("room")
+
+	_, cancel := resumeClient(client, "")
+	cancel()
+
+	ssePubSub.RemovePublicTopic(topic)
+	ssePubSub.RemoveClient(client)
+
+	expected := []string{
+		"created public news",
+		"new",
+		"sub news",
+		"sub news/*",
+		`pub news "a"`,
+		"unsub news/*",
+		"created private private",
+		"join g",
+		"created group room",
+		"connected",
+		"disconnected",
+		"unsub news",
+		"removed public news",
+		"leave g",
+		"removed private private",
+		"removed",
+	}
+	events := r.get()
+	if len(events) != len(expected) {
+		t.Fatalf("Expected events %v, got %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Expected event %d to be %q, got %q", i, expected[i], events[i])
+		}
+	}
+}
+
+func TestSSEPubSubService_Events_TopicEvent(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetEventDispatch(DispatchSync)
+
+	var events []TopicEvent
+	ssePubSub.OnTopicCreated(func(e TopicEvent) { events = append(events, e) })
+
+	client := ssePubSub.NewClient()
+	client.NewPrivateTopic("private")
+	g := ssePubSub.NewGroup("g")
+	g.NewTopic("room")
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if events[0].Type != string(TPrivate) || events[0].Client != client || events[0].Group != nil {
+		t.Errorf("Unexpected private topic event %+v", events[0])
+	}
+	if events[1].Type != string(TGroup) || events[1].Group != g || events[1].Client != nil {
+		t.Errorf("Unexpected group topic event %+v", events[1])
+	}
+}
+
+func TestSSEPubSubService_Events_TopicType(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetEventDispatch(DispatchSync)
+	r := &eventRecorder{}
+
+	ssePubSub.OnPublicTopicCreated(func(e TopicEvent) { r.add("created public " + e.Topic.GetName()) })
+	ssePubSub.OnPublicTopicRemoved(func(e TopicEvent) { r.add("removed public " + e.Topic.GetName()) })
+	ssePubSub.OnPrivateTopicCreated(func(e TopicEvent) { r.add("created private " + e.Client.GetID()) })
+	ssePubSub.OnPrivateTopicRemoved(func(e TopicEvent) { r.add("removed private " + e.Client.GetID()) })
+	ssePubSub.OnGroupTopicCreated(func(e TopicEvent) { r.add("created group " + e.Group.GetName()) })
+	id := ssePubSub.OnGroupTopicRemoved(func(e TopicEvent) { r.add("removed group " + e.Group.GetName()) })
+	ssePubSub.RemoveOnGroupTopicRemoved(id)
+
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	private := client.NewPrivateTopic("private")
+	g := ssePubSub.NewGroup("g")
+	room := g.NewTopic("room")
+
+	ssePubSub.RemovePublicTopic(topic)
+	client.RemovePrivateTopic(private)
+	g.RemoveTopic(room)
+
+	expected := []string{
+		"created public news",
+		"created private " + client.GetID(),
+		"created group g",
+		"removed public news",
+		"removed private " + client.GetID(),
+	}
+	events := r.get()
+	if len(events) != len(expected) {
+		t.Fatalf("Expected events %v, got %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Expected event %d to be %q, got %q", i, expected[i], events[i])
+		}
+	}
+}
+
+func TestSSEPubSubService_Events_Async(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	if ssePubSub.GetEventDispatch() != DispatchAsync {
+		t.Error("Expected async dispatch by default")
+	}
+
+	// The handler may call the service, because no lock is held
+	subscribed := make(chan *Client, 1)
+	ssePubSub.OnSubscribe(func(e SubscriptionEvent) {
+		ssePubSub.GetClients()
+		subscribed <- e.Client
+	})
+
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	client.Sub(topic)
+
+	select {
+	case c := <-subscribed:
+		if c != client {
+			t.Errorf("Expected client %s, got %s", client.GetID(), c.GetID())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Handler was not called")
+	}
+}
+
+func TestSSEPubSubService_Events_Sync(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetEventDispatch(DispatchSync)
+
+	// Handlers are called in the order they were added, before Sub returns
+	order := []int{}
+	ssePubSub.OnSubscribe(func(e SubscriptionEvent) { order = append(order, 1) })
+	ssePubSub.OnSubscribe(func(e SubscriptionEvent) {
+		e.Client.GetSubscribedTopics()
+		order = append(order, 2)
+	})
+
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	client.Sub(topic)
+
+	if len(order) != 2 || order[0] != 1 || order[1] != 2 {
+		t.Errorf("Expected handlers to be called in order, got %v", order)
+	}
+}
+
+func TestSSEPubSubService_RemoveOnPublish(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetEventDispatch(DispatchSync)
+
+	called := 0
+	id := ssePubSub.OnPublish(func(e PublishEvent) { called++ })
+	other := ssePubSub.OnPublish(func(e PublishEvent) {})
+	topic := ssePubSub.NewPublicTopic("news")
+
+	topic.Pub("a")
+	ssePubSub.RemoveOnPublish(id)
+	ssePubSub.RemoveOnPublish(id) // Already removed
+	topic.Pub("b")
+	ssePubSub.RemoveOnPublish(other)
+
+	if called != 1 {
+		t.Errorf("Expected handler to be called once, got %d", called)
+	}
+}
+
+func TestSSEPubSubService_Events_Backplane(t *testing.T) {
+	hub := NewInProcessHub()
+	a := NewSSEPubSubService()
+	b := NewSSEPubSubService()
+	a.SetBackplane(hub.NewBackplane())
+	b.SetBackplane(hub.NewBackplane())
+
+	published := make(chan PublishEvent, 1)
+	b.OnPublish(func(e PublishEvent) { published <- e })
+
+	b.NewPublicTopic("news")
+	a.NewPublicTopic("news").Pub("a")
+
+	select {
+	case e := <-published:
+		if e.Topic.GetName() != "news" || string(e.Data) != `"a"` {
+			t.Errorf("Unexpected publish event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Update from the backplane was not emitted")
+	}
+}
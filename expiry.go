@@ -0,0 +1,124 @@
+package pubsubsse
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultJanitorInterval is the interval the janitor checks for expired clients by default.
+const DefaultJanitorInterval = 10 * time.Second
+
+// errClientNotIdle is returned if an expired client started receiving again before it was removed
+var errClientNotIdle = errors.New("client is not idle")
+
+// Get the time the client is not receiving anymore.
+// It is 0 while the client is receiving or waiting in a poll.
+// A long-polling client is idle between its polls.
+func (c *Client) GetIdleTime() time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.status == Receving || c.polls > 0 {
+		return 0
+	}
+	return time.Since(c.lastSeen)
+}
+
+// Get the idle TTL of clients. 0 means clients never expire.
+func (s *SSEPubSubService) GetClientTTL() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.clientTTL
+}
+
+// Set the idle TTL of clients.
+// A client which has not been receiving for longer than the TTL is removed by the janitor.
+// 0 disables the expiry.
+func (s *SSEPubSubService) SetClientTTL(ttl time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.clientTTL = ttl
+}
+
+// Start the janitor which removes expired clients.
+// It checks all clients every interval (DefaultJanitorInterval if interval <= 0).
+// Starting a running janitor does nothing.
+func (s *SSEPubSubService) StartJanitor(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultJanitorInterval
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.janitorStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	s.janitorStop = stop
+	s.janitorDone = done
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.expireClients()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the janitor and wait until it stopped
+func (s *SSEPubSubService) StopJanitor() {
+	s.lock.Lock()
+	stop := s.janitorStop
+	done := s.janitorDone
+	s.janitorStop = nil
+	s.janitorDone = nil
+	s.lock.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// Remove all clients which are idle for longer than the TTL
+// 1. Remove client like RemoveClient, if it is still idle
+// 2. Emit OnClientExpired
+//
+// OnClientExpired is always dispatched asynchronously, so its handlers may call StopJanitor or Shutdown.
+// The other events of the removal, e.g. OnClientRemoved, are emitted by the janitor.
+// With DispatchSync their handlers must not call StopJanitor or Shutdown, which wait for the janitor.
+func (s *SSEPubSubService) expireClients() {
+	ttl := s.GetClientTTL()
+	if ttl <= 0 {
+		return
+	}
+
+	for _, c := range s.GetClients() {
+		if c.GetStatus() == Receving || c.GetIdleTime() <= ttl {
+			continue
+		}
+
+		if err := s.removeClient(c, ttl); err != nil {
+			if !errors.Is(err, errClientNotIdle) {
+				s.GetLogger().Error("Error removing expired client", logKeyClientID, c.GetID(), logKeyError, err)
+			}
+			continue
+		}
+		s.GetLogger().Info("Client expired", logKeyClientID, c.GetID())
+		s.emitOnClientExpired(c)
+	}
+}
@@ -0,0 +1,170 @@
+package pubsubsse
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Tests for:
+// +SetClientTTL(ttl Duration)
+// +GetClientTTL(): Duration
+// +StartJanitor(interval Duration)
+// +StopJanitor()
+// +OnClientExpired(f funcClient): string
+// +RemoveOnClientExpired(id string)
+// +GetIdleTime(): Duration
+
+func TestClient_GetIdleTime(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+
+	time.Sleep(5 * time.Millisecond)
+	if client.GetIdleTime() < 5*time.Millisecond {
+		t.Errorf("Expected idle time since creation, got %s", client.GetIdleTime())
+	}
+
+	_, cancel := resumeClient(client, "")
+	if client.GetIdleTime() != 0 {
+		t.Errorf("Expected no idle time while receiving, got %s", client.GetIdleTime())
+	}
+
+	cancel()
+	if client.GetIdleTime() > 5*time.Millisecond {
+		t.Errorf("Expected idle time to restart after the stream stopped, got %s", client.GetIdleTime())
+	}
+}
+
+func TestSSEPubSubService_Janitor(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetClientTTL(20 * time.Millisecond)
+	if ssePubSub.GetClientTTL() != 20*time.Millisecond {
+		t.Errorf("Expected TTL 20ms, got %s", ssePubSub.GetClientTTL())
+	}
+
+	expired := make(chan *Client, 2)
+	ssePubSub.OnClientExpired(func(c *Client) { expired <- c })
+
+	idle := ssePubSub.NewClient()
+	idle.NewPrivateTopic("private")
+	g := ssePubSub.NewGroup("group")
+	g.AddClient(idle)
+
+	// A receiving client never expires
+	active := ssePubSub.NewClient()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go active.Start(ctx, func(string) {})
+
+	ssePubSub.StartJanitor(5 * time.Millisecond)
+	ssePubSub.StartJanitor(5 * time.Millisecond) // Already running
+	defer ssePubSub.StopJanitor()
+
+	select {
+	case c := <-expired:
+		if c != idle {
+			t.Errorf("Expected idle client to expire, got %s", c.GetID())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Client did not expire")
+	}
+
+	if _, ok := ssePubSub.GetClientByID(idle.GetID()); ok {
+		t.Error("Expired client was not removed")
+	}
+	if len(g.GetClients()) != 0 {
+		t.Error("Expired client was not removed from its group")
+	}
+	if _, ok := ssePubSub.GetClientByID(active.GetID()); !ok {
+		t.Error("Receiving client was removed")
+	}
+}
+
+func TestSSEPubSubService_StopJanitor(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetClientTTL(time.Millisecond)
+	ssePubSub.StopJanitor() // Not running
+
+	ssePubSub.StartJanitor(time.Millisecond)
+	ssePubSub.StopJanitor()
+
+	client := ssePubSub.NewClient()
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := ssePubSub.GetClientByID(client.GetID()); !ok {
+		t.Error("Client was removed after the janitor stopped")
+	}
+}
+
+// TestSSEPubSubService_Janitor_Reconnect tests that a client which reconnects after it was found idle is not removed.
+func TestSSEPubSubService_Janitor_Reconnect(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetClientTTL(time.Millisecond)
+
+	client := ssePubSub.NewClient()
+	time.Sleep(5 * time.Millisecond)
+
+	// The client reconnects before it is removed
+	_, cancel := resumeClient(client, "")
+	defer cancel()
+	if err := ssePubSub.removeClient(client, ssePubSub.GetClientTTL()); !errors.Is(err, errClientNotIdle) {
+		t.Errorf("Expected errClientNotIdle, got %v", err)
+	}
+	if _, ok := ssePubSub.GetClientByID(client.GetID()); !ok {
+		t.Error("Reconnected client was removed")
+	}
+
+	// An expired client can not start receiving anymore
+	idle := ssePubSub.NewClient()
+	time.Sleep(5 * time.Millisecond)
+	if err := ssePubSub.removeClient(idle, ssePubSub.GetClientTTL()); err != nil {
+		t.Fatal(err)
+	}
+	if err := idle.Start(context.Background(), func(string) {}); !errors.Is(err, ErrClientNotFound) {
+		t.Errorf("Expected ErrClientNotFound, got %v", err)
+	}
+}
+
+// TestSSEPubSubService_Janitor_ShutdownOnExpired tests that a handler of OnClientExpired can shut the service down.
+func TestSSEPubSubService_Janitor_ShutdownOnExpired(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetEventDispatch(DispatchSync)
+	ssePubSub.SetClientTTL(time.Millisecond)
+
+	done := make(chan error, 1)
+	ssePubSub.OnClientExpired(func(c *Client) { done <- ssePubSub.Shutdown(context.Background()) })
+
+	ssePubSub.NewClient()
+	ssePubSub.StartJanitor(time.Millisecond)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown in OnClientExpired did not return")
+	}
+}
+
+func TestSSEPubSubService_RemoveOnClientExpired(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetClientTTL(time.Millisecond)
+
+	called := make(chan struct{}, 1)
+	id := ssePubSub.OnClientExpired(func(c *Client) { called <- struct{}{} })
+	ssePubSub.RemoveOnClientExpired(id)
+
+	ssePubSub.NewClient()
+	time.Sleep(5 * time.Millisecond)
+	ssePubSub.expireClients()
+
+	if len(ssePubSub.GetClients()) != 0 {
+		t.Error("Client did not expire")
+	}
+	select {
+	case <-called:
+		t.Error("Removed event was called")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
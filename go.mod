@@ -2,9 +2,4 @@ module github.com/bigbluebutton-bot/pubsub-sse
 
 go 1.20
 
-require (
-	github.com/apex/log v1.9.0
-	github.com/google/uuid v1.4.0
-)
-
-require github.com/pkg/errors v0.8.1 // indirect
+require github.com/google/uuid v1.4.0
@@ -1,9 +1,9 @@
 package pubsubsse
 
 import (
+	"fmt"
 	"sync"
 
-	"github.com/apex/log"
 	"github.com/google/uuid"
 )
 
@@ -15,6 +15,9 @@ type Group struct {
 
 	lock *sync.Mutex
 
+	// service is the sSEPubSubService the group belongs to
+	service *SSEPubSubService
+
 	// Topics is a map of topic names to topics.
 	topics map[string]*Topic
 
@@ -65,8 +68,13 @@ func (g *Group) GetTopics() map[string]*Topic {
 	return newmap
 }
 
-// Get topic by name
+// Get topic by name. The name is canonicalized, so "/news/" finds "news".
 func (g *Group) GetTopicByName(name string) (*Topic, bool) {
+	return g.topicByName(lookupTopicName(g, name))
+}
+
+// Get topic by its canonical name
+func (g *Group) topicByName(name string) (*Topic, bool) {
 	g.lock.Lock()
 	defer g.lock.Unlock()
 
@@ -74,6 +82,49 @@ func (g *Group) GetTopicByName(name string) (*Topic, bool) {
 	return t, ok
 }
 
+// Resolve a group topic by name for the subscription hierarchy
+func (g *Group) scopeTopicByName(name string) (*Topic, bool) {
+	return g.topicByName(name)
+}
+
+// Get all group topics for the subscription hierarchy
+func (g *Group) scopeTopics() map[string]*Topic {
+	return g.GetTopics()
+}
+
+// Group topics belong to the sSEPubSubService of the group
+func (g *Group) scopeService() *SSEPubSubService {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.service
+}
+
+// Inform the other instances about a change of the group
+func (g *Group) publishBackplane(msg *BackplaneMessage) {
+	s := g.scopeService()
+	if s == nil {
+		return
+	}
+
+	msg.Group = g.GetName()
+	s.publishBackplane(msg)
+}
+
+// All clients of the group can see its topics
+func (g *Group) scopeClients() map[string]*Client {
+	return g.GetClients()
+}
+
+// Check if the client is a member of the group
+func (g *Group) scopeHasClient(c *Client) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	member, ok := g.clients[c.GetID()]
+	return ok && member == c
+}
+
 // GetClients returns a map of clients.
 func (g *Group) GetClients() map[string]*Client {
 	g.lock.Lock()
@@ -98,18 +149,45 @@ func (g *Group) GetClientByID(id string) (*Client, bool) {
 	return c, ok
 }
 
-// AddTopic adds a topic to the group.
+// NewTopic adds a topic to the group.
+// It returns nil if the name is invalid. Use CreateTopic to get the error.
+func (g *Group) NewTopic(name string) *Topic {
+	t, err := g.CreateTopic(name)
+	if err != nil {
+		g.logger().Error("Error creating topic of group", logKeyGroup, g.GetName(), logKeyTopic, name, logKeyError, err)
+	}
+	return t
+}
+
+// CreateTopic adds a topic to the group.
+// 0. Canonicalize the name, return an error wrapping ErrInvalidTopic if it is invalid
 // 1. Check if topic already exists, return it if it does
 // 2. Add the topic to the group
 // 3. Inform all clients about the new topic
-func (g *Group) NewTopic(name string) *Topic {
+// 4. Inform the other instances about the new topic
+func (g *Group) CreateTopic(name string) (*Topic, error) {
+	name, err := canonicalTopicName(g, name)
+	if err != nil {
+		return nil, err
+	}
+	return g.newTopic(name, nil), nil
+}
+
+// Create a group topic.
+// remote are the options of a topic of another instance. Without them the topic is created
+// by this instance and the other instances are informed over the backplane.
+func (g *Group) newTopic(name string, remote *BackplaneTopicOptions) *Topic {
 	// Check if the topic already exists and return it if it does
-	if t, ok := g.GetTopicByName(name); ok {
+	if t, ok := g.topicByName(name); ok {
 		return t
 	}
 
 	// Create the topic
 	t := newTopic(name, TGroup)
+	t.setScope(g)
+	if remote != nil {
+		t.setBackplaneOptions(remote)
+	}
 	g.lock.Lock()
 	g.topics[name] = t
 	g.lock.Unlock()
@@ -117,10 +195,18 @@ func (g *Group) NewTopic(name string) *Topic {
 	// Inform all clients about the new topic
 	for _, c := range g.GetClients() {
 		if err := c.sendTopicList(); err != nil {
-			log.Errorf("[C:%s]: Error sending new topic to client: %s", c.id, err)
+			g.logger().Error("Error sending new topic to client", logKeyClientID, c.id, logKeyGroup, g.GetName(), logKeyError, err)
 		}
 	}
 
+	// Inform the other instances about the new topic
+	if remote == nil {
+		g.publishBackplane(&BackplaneMessage{Event: BackplaneTopicCreated, TopicType: string(TGroup), Topic: t.GetName(), Options: t.backplaneOptions()})
+	}
+
+	// Emit event
+	g.service.emitOnTopicCreated(t)
+
 	return t
 }
 
@@ -130,10 +216,18 @@ func (g *Group) NewTopic(name string) *Topic {
 // 2. Unsuscribe all clients from the topic
 // 3. Remove topic from the group
 // 4. Inform all clients about the removed topic
-func (g *Group) RemoveTopic(t *Topic) {
+// 5. Inform the other instances about the removed topic
+//
+// ErrTopicNotFound is returned if the topic is not a topic of the group.
+func (g *Group) RemoveTopic(t *Topic) error {
+	return g.removeTopic(t, true)
+}
+
+// Remove a group topic and inform the other instances over the backplane if propagate is true
+func (g *Group) removeTopic(t *Topic, propagate bool) error {
 	// Check if topic is a group topic
 	if t.GetType() != string(TGroup) {
-		log.Errorf("topic is not a group topic")
+		return fmt.Errorf("%w: topic %s is not a group topic", ErrTopicNotFound, t.GetName())
 	}
 
 	// Check if topic exists in sSEPubSubService
@@ -146,14 +240,13 @@ func (g *Group) RemoveTopic(t *Topic) {
 		return false
 	}
 	if !checkIfExist() {
-		log.Errorf("Topic %s does not exist in group", t.GetName())
-		return
+		return fmt.Errorf("%w: topic %s does not exist in group %s", ErrTopicNotFound, t.GetName(), g.GetName())
 	}
 
 	// Unsuscribe all clients from the topic
 	for _, c := range t.GetClients() {
 		if err := c.Unsub(t); err != nil {
-			log.Errorf("[C:%s]: Error unsuscribing client from topic: %s", c.id, err)
+			g.logger().Error("Error unsubscribing client from topic", logKeyClientID, c.id, logKeyGroup, g.GetName(), logKeyTopic, t.GetName(), logKeyError, err)
 		}
 	}
 
@@ -165,20 +258,37 @@ func (g *Group) RemoveTopic(t *Topic) {
 	// Inform all clients about the removed topic
 	for _, c := range g.GetClients() {
 		if err := c.sendTopicList(); err != nil {
-			log.Errorf("[C:%s]: Error sending new topic to client: %s", c.id, err)
+			g.logger().Error("Error sending new topic to client", logKeyClientID, c.id, logKeyGroup, g.GetName(), logKeyError, err)
 		}
 	}
+
+	// Inform the other instances about the removed topic
+	if propagate {
+		g.publishBackplane(&BackplaneMessage{Event: BackplaneTopicRemoved, TopicType: string(TGroup), Topic: t.GetName()})
+	}
+
+	// Emit event
+	g.service.emitOnTopicRemoved(t)
+
+	return nil
 }
 
 // AddClient adds a client to the group.
 // 0. Check if client already exists in the group
 // 1. Add client to the group
 // 2. Add group to client
-func (g *Group) AddClient(c *Client) {
+// 3. Inform the other instances about the new member
+//
+// ErrAlreadyMember is returned if the client is already a member of the group.
+func (g *Group) AddClient(c *Client) error {
+	return g.addClient(c, true)
+}
+
+// Add a client to the group and inform the other instances over the backplane if propagate is true
+func (g *Group) addClient(c *Client, propagate bool) error {
 	// Check if client already exists in the group
 	if _, ok := g.GetClientByID(c.GetID()); ok {
-		log.Errorf("Client already exists in group")
-		return
+		return fmt.Errorf("%w: client %s, group %s", ErrAlreadyMember, c.GetID(), g.GetName())
 	}
 
 	// Add client to the group
@@ -191,8 +301,18 @@ func (g *Group) AddClient(c *Client) {
 
 	// Inform client about the new topic
 	if err := c.sendTopicList(); err != nil {
-		log.Errorf("[C:%s]: Error sending new topic to client: %s", c.id, err)
+		g.logger().Error("Error sending new topic to client", logKeyClientID, c.id, logKeyGroup, g.GetName(), logKeyError, err)
 	}
+
+	// Inform the other instances about the new member
+	if propagate {
+		g.publishBackplane(&BackplaneMessage{Event: BackplaneGroupJoin, Client: c.GetID()})
+	}
+
+	// Emit event
+	g.service.emitOnGroupJoin(GroupEvent{Group: g, Client: c})
+
+	return nil
 }
 
 // RemoveClient removes a client from the group.
@@ -201,17 +321,24 @@ func (g *Group) AddClient(c *Client) {
 // 2. Remove client from the group
 // 3. Remove group from client
 // 4. Inform client about the removed topic
-func (g *Group) RemoveClient(c *Client) {
+// 5. Inform the other instances about the removed member
+//
+// ErrNotMember is returned if the client is not a member of the group.
+func (g *Group) RemoveClient(c *Client) error {
+	return g.removeClient(c, true)
+}
+
+// Remove a client from the group and inform the other instances over the backplane if propagate is true
+func (g *Group) removeClient(c *Client, propagate bool) error {
 	// Check if client exists in the group
 	if _, ok := g.GetClientByID(c.GetID()); !ok {
-		log.Errorf("Client does not exist in group")
-		return
+		return fmt.Errorf("%w: client %s, group %s", ErrNotMember, c.GetID(), g.GetName())
 	}
 
 	// Unsubscribe client from all group topics
 	for _, t := range g.GetTopics() {
 		if err := c.Unsub(t); err != nil {
-			log.Errorf("[C:%s]: Error unsuscribing client from topic: %s", c.id, err)
+			g.logger().Error("Error unsubscribing client from topic", logKeyClientID, c.id, logKeyGroup, g.GetName(), logKeyTopic, t.GetName(), logKeyError, err)
 		}
 	}
 
@@ -225,6 +352,16 @@ func (g *Group) RemoveClient(c *Client) {
 
 	// Inform client about the removed topic
 	if err := c.sendTopicList(); err != nil {
-		log.Errorf("[C:%s]: Error sending new topic to client: %s", c.id, err)
+		g.logger().Error("Error sending new topic to client", logKeyClientID, c.id, logKeyGroup, g.GetName(), logKeyError, err)
 	}
+
+	// Inform the other instances about the removed member
+	if propagate {
+		g.publishBackplane(&BackplaneMessage{Event: BackplaneGroupLeave, Client: c.GetID()})
+	}
+
+	// Emit event
+	g.service.emitOnGroupLeave(GroupEvent{Group: g, Client: c})
+
+	return nil
 }
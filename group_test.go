@@ -1,6 +1,7 @@
 package pubsubsse
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -12,9 +13,9 @@ import (
 // +GetClients(): map[string]*client
 // +GetClientByID(id string): *client, bool
 // +NewTopic(name string): *topic
-// +RemoveTopic(t *topic)
-// +AddClient(c *client)
-// +RemoveClient(c *client)
+// +RemoveTopic(t *topic): error
+// +AddClient(c *client): error
+// +RemoveClient(c *client): error
 
 // TestGroup_NewGroup tests the NewGroup function
 func TestGroup_NewGroup(t *testing.T) {
@@ -143,10 +144,18 @@ func TestGroup_RemoveTopic(t *testing.T) {
 		t.Error("NewTopic did not add the topic")
 	}
 
-	g.RemoveTopic(topic)
+	if err := g.RemoveTopic(topic); err != nil {
+		t.Errorf("RemoveTopic returned an error: %s", err)
+	}
 	if len(g.GetTopics()) > 0 {
 		t.Error("RemoveTopic did not remove the topic")
 	}
+	if err := g.RemoveTopic(topic); !errors.Is(err, ErrTopicNotFound) {
+		t.Errorf("Expected ErrTopicNotFound, got %v", err)
+	}
+	if err := g.RemoveTopic(ssePubSub.NewPublicTopic("test")); !errors.Is(err, ErrTopicNotFound) {
+		t.Errorf("Expected ErrTopicNotFound for a public topic, got %v", err)
+	}
 }
 
 // TestGroup_AddClient tests the AddClient function
@@ -158,10 +167,15 @@ func TestGroup_AddClient(t *testing.T) {
 	}
 
 	client := ssePubSub.NewClient()
-	g.AddClient(client)
+	if err := g.AddClient(client); err != nil {
+		t.Errorf("AddClient returned an error: %s", err)
+	}
 	if len(g.GetClients()) != 1 {
 		t.Error("AddClient did not add the client")
 	}
+	if err := g.AddClient(client); !errors.Is(err, ErrAlreadyMember) {
+		t.Errorf("Expected ErrAlreadyMember, got %v", err)
+	}
 }
 
 // TestGroup_RemoveClient tests the RemoveClient function
@@ -174,8 +188,13 @@ func TestGroup_RemoveClient(t *testing.T) {
 		t.Error("AddClient did not add the client")
 	}
 
-	g.RemoveClient(client)
+	if err := g.RemoveClient(client); err != nil {
+		t.Errorf("RemoveClient returned an error: %s", err)
+	}
 	if len(g.GetClients()) > 0 {
 		t.Error("RemoveClient did not remove the client")
 	}
+	if err := g.RemoveClient(client); !errors.Is(err, ErrNotMember) {
+		t.Errorf("Expected ErrNotMember, got %v", err)
+	}
 }
\ No newline at end of file
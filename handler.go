@@ -1,23 +1,42 @@
 package pubsubsse
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
-
-	"github.com/apex/log"
 )
 
 // AddClient handles HTTP requests for adding a new client.
 func AddClient(s *SSEPubSubService, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	if !authorize(s, w, r, &AuthRequest{Action: ActionCreateClient}) {
+		return
+	}
+
 	// Create a new client
-	c := s.NewClient()
+	c, err := s.CreateClient()
+	if err != nil {
+		writeError(s, w, err)
+		return
+	}
 
-	// Send the client ID
+	// Issue a client token if the authorizer binds tokens to clients
+	token, err := issueClientToken(s, c.GetID())
+	if err != nil {
+		s.GetLogger().Error("Error issuing client token", logKeyClientID, c.GetID(), logKeyError, err)
+		s.RemoveClient(c)
+		writeError(s, w, err)
+		return
+	}
 
-	json.NewEncoder(w).Encode(map[string]string{"ok": "true", "client_id": c.GetID()})
+	// Send the client ID
+	resp := map[string]string{"client_id": c.GetID()}
+	if token != "" {
+		resp["client_token"] = token
+	}
+	writeOK(w, resp)
 }
 
 // AddPublicTopic handles HTTP requests for adding a new public topic.
@@ -25,13 +44,20 @@ func AddPublicTopic(s *SSEPubSubService, w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Type", "application/json")
 
 	// GET clientID and topic from request body
-	topic := r.URL.Query().Get("topic")
+	topic := lookupTopicName(s, r.URL.Query().Get("topic"))
+
+	if !authorize(s, w, r, &AuthRequest{Action: ActionCreateTopic, Topic: topic, TopicType: string(TPublic)}) {
+		return
+	}
 
 	// Create a new public topic
-	t := s.NewPublicTopic(topic)
+	t, err := s.CreatePublicTopic(topic)
+	if err != nil {
+		writeError(s, w, err)
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"ok": "true", "topic_name": t.GetName()})
+	writeOK(w, map[string]string{"topic_name": t.GetName()})
 }
 
 // AddPrivateTopic handles HTTP requests for adding a new private topic.
@@ -40,117 +66,206 @@ func AddPrivateTopic(s *SSEPubSubService, w http.ResponseWriter, r *http.Request
 
 	// GET clientID and topic from request body
 	clientID := r.URL.Query().Get("client_id")
-	topic := r.URL.Query().Get("topic")
+	topic := lookupTopicName(s, r.URL.Query().Get("topic"))
+
+	if !authorize(s, w, r, &AuthRequest{Action: ActionCreateTopic, ClientID: clientID, Topic: topic, TopicType: string(TPrivate)}) {
+		return
+	}
 
 	// Get the client
 	client, ok := s.GetClientByID(clientID)
 	if !ok {
-		w.WriteHeader(http.StatusBadRequest)
-
-		json.NewEncoder(w).Encode(map[string]string{"ok": "false", "error": "client not found"})
+		writeError(s, w, ErrClientNotFound)
 		return
 	}
 
 	// Create a new private topic
-	t := client.NewPrivateTopic(topic)
+	t, err := client.CreatePrivateTopic(topic)
+	if err != nil {
+		writeError(s, w, err)
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"ok": "true", "topic_name": t.GetName()})
+	writeOK(w, map[string]string{"topic_name": t.GetName()})
 }
 
-// Subscribe handles HTTP requests for client subscriptions.
-func Subscribe(s *SSEPubSubService, w http.ResponseWriter, r *http.Request) {
+// RemoveClient handles HTTP requests for removing a client.
+func RemoveClient(s *SSEPubSubService, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// GET clientID and topic from request body
+	// GET clientID from request body
 	clientID := r.URL.Query().Get("client_id")
-	topic := r.URL.Query().Get("topic")
+
+	if !authorize(s, w, r, &AuthRequest{Action: ActionRemoveClient, ClientID: clientID}) {
+		return
+	}
 
 	// Get the client
 	client, ok := s.GetClientByID(clientID)
 	if !ok {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(s, w, ErrClientNotFound)
+		return
+	}
+
+	// Remove the client
+	if err := s.RemoveClient(client); err != nil {
+		writeError(s, w, err)
+		return
+	}
+
+	writeOK(w, nil)
+}
 
-		json.NewEncoder(w).Encode(map[string]string{"ok": "false", "error": "client not found"})
+// RemovePublicTopic handles HTTP requests for removing a public topic.
+func RemovePublicTopic(s *SSEPubSubService, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// GET topic from request body
+	topic := lookupTopicName(s, r.URL.Query().Get("topic"))
+
+	if !authorize(s, w, r, &AuthRequest{Action: ActionRemoveTopic, Topic: topic, TopicType: string(TPublic)}) {
 		return
 	}
 
 	// Get the topic
-	t, ok := client.GetTopicByName(topic)
+	t, ok := s.GetPublicTopicByName(topic)
 	if !ok {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"ok": "false", "error": "topic not found"})
+		writeError(s, w, ErrTopicNotFound)
 		return
 	}
 
-	// Subscribe to the topic
-	if err := client.Sub(t); err != nil {
-		log.Errorf("Error subscribing to topic %s: %s", topic, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"ok": "false", "error": "internal server error"})
+	// Remove the public topic
+	if err := s.RemovePublicTopic(t); err != nil {
+		writeError(s, w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"ok": "true"})
+	writeOK(w, map[string]string{"topic_name": t.GetName()})
 }
 
-// Unsubscribe handles HTTP requests for client unsubscriptions.
-func Unsubscribe(s *SSEPubSubService, w http.ResponseWriter, r *http.Request) {
+// RemovePrivateTopic handles HTTP requests for removing a private topic.
+func RemovePrivateTopic(s *SSEPubSubService, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// GET clientID and topic from request body
 	clientID := r.URL.Query().Get("client_id")
-	topic := r.URL.Query().Get("topic")
+	topic := lookupTopicName(s, r.URL.Query().Get("topic"))
+
+	if !authorize(s, w, r, &AuthRequest{Action: ActionRemoveTopic, ClientID: clientID, Topic: topic, TopicType: string(TPrivate)}) {
+		return
+	}
 
 	// Get the client
 	client, ok := s.GetClientByID(clientID)
 	if !ok {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"ok": "false", "error": "client not found"})
+		writeError(s, w, ErrClientNotFound)
 		return
 	}
 
 	// Get the topic
-	t, ok := client.GetTopicByName(topic)
+	t, ok := client.GetPrivateTopicByName(topic)
 	if !ok {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"ok": "false", "error": "topic not found"})
+		writeError(s, w, ErrTopicNotFound)
 		return
 	}
 
-	// Unsubscribe from the topic
-	if err := client.Unsub(t); err != nil {
-		log.Errorf("Error unsubscribing from topic %s: %s", topic, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"ok": "false", "error": "internal server error"})
+	// Remove the private topic
+	if err := client.RemovePrivateTopic(t); err != nil {
+		writeError(s, w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"ok": "true"})
+	writeOK(w, map[string]string{"topic_name": t.GetName()})
 }
 
-// Event
+// Subscribe handles HTTP requests for client subscriptions.
+// Topics containing wildcards ("+" or "#") are subscribed as patterns.
+func Subscribe(s *SSEPubSubService, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// GET clientID and topic from request body
+	clientID := r.URL.Query().Get("client_id")
+	topic := lookupTopicName(s, r.URL.Query().Get("topic"))
+
+	if !authorize(s, w, r, &AuthRequest{Action: ActionSubscribe, ClientID: clientID, Topic: topic}) {
+		return
+	}
+
+	// Get the client
+	client, ok := s.GetClientByID(clientID)
+	if !ok {
+		writeError(s, w, ErrClientNotFound)
+		return
+	}
+
+	// Subscribe to the topic or pattern
+	if err := subscribeTopicOrPattern(client, topic); err != nil {
+		writeError(s, w, err)
+		return
+	}
+
+	writeOK(w, nil)
+}
+
+// Unsubscribe handles HTTP requests for client unsubscriptions.
+// Topics containing wildcards ("+" or "#") are unsubscribed as patterns.
+func Unsubscribe(s *SSEPubSubService, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// GET clientID and topic from request body
+	clientID := r.URL.Query().Get("client_id")
+	topic := lookupTopicName(s, r.URL.Query().Get("topic"))
+
+	if !authorize(s, w, r, &AuthRequest{Action: ActionSubscribe, ClientID: clientID, Topic: topic}) {
+		return
+	}
+
+	// Get the client
+	client, ok := s.GetClientByID(clientID)
+	if !ok {
+		writeError(s, w, ErrClientNotFound)
+		return
+	}
+
+	// Unsubscribe from the topic or pattern
+	if err := unsubscribeTopicOrPattern(client, topic); err != nil {
+		writeError(s, w, err)
+		return
+	}
+
+	writeOK(w, nil)
+}
+
+// Event handles the SSE connection of a client.
+// If the browser reconnects with a Last-Event-ID header (or last_event_id query parameter),
+// the updates it missed in the meantime are re-delivered.
+// If takeover is enabled (see SetTakeover), the connection replaces the one the client is already receiving over.
 func Event(s *SSEPubSubService, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// GET clientID and topic from request body
 	clientID := r.URL.Query().Get("client_id")
 
+	if !authorize(s, w, r, &AuthRequest{Action: ActionConnect, ClientID: clientID}) {
+		return
+	}
+
 	// Get the client
 	client, ok := s.GetClientByID(clientID)
 	if !ok {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"ok": "false", "error": "client not found"})
+		writeError(s, w, ErrClientNotFound)
 		return
 	}
 
-	// Test if client is already receiving
-	if client.GetStatus() == Receving {
-		w.WriteHeader(http.StatusBadRequest)
+	// Test if client is already receiving. With takeover the new stream replaces the old one.
+	if client.GetStatus() == Receving && !s.GetTakeover() {
+		writeError(s, w, ErrAlreadyReceiving)
+		return
+	}
 
-		json.NewEncoder(w).Encode(map[string]string{"ok": "false", "error": "client is already receiving"})
+	// Test if the service is shut down
+	if s.isClosed() {
+		writeError(s, w, ErrServiceClosed)
 		return
 	}
 
@@ -160,15 +275,55 @@ func Event(s *SSEPubSubService, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
+	// Get the last event ID the browser received before it reconnected
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
 	// Get the request's context. If the connection closes, the context will be canceled.
-	ctx := r.Context()
+	// A failing write (e.g. of a heartbeat) cancels it as well, so a dead connection is detected.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	rc := http.NewResponseController(w)
 
 	// Keep the connection open until it's closed by the client or client is removed
 	// OnEvent: Send message to client if new data is published
-	client.Start(ctx, func(msg string) {
-		fmt.Fprintf(w, "%s", msg)
-		if f, ok := w.(http.Flusher); ok {
-			f.Flush()
+	client.Resume(ctx, lastEventID, func(msg string) {
+		if _, err := fmt.Fprintf(w, "%s", msg); err != nil {
+			s.GetLogger().Debug("Error writing to event stream", logKeyClientID, clientID, logKeyError, err)
+			cancel()
+			return
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			s.GetLogger().Debug("Error flushing event stream", logKeyClientID, clientID, logKeyError, err)
+			cancel()
 		}
 	})
 }
+
+// Subscribe a topic, or a pattern if the topic contains wildcards
+func subscribeTopicOrPattern(client *Client, topic string) error {
+	if IsPattern(topic) {
+		return client.SubPattern(topic)
+	}
+
+	t, ok := client.GetTopicByName(topic)
+	if !ok {
+		return ErrTopicNotFound
+	}
+	return client.Sub(t)
+}
+
+// Unsubscribe a topic, or a pattern if the topic contains wildcards
+func unsubscribeTopicOrPattern(client *Client, topic string) error {
+	if IsPattern(topic) {
+		return client.UnsubPattern(topic)
+	}
+
+	t, ok := client.GetTopicByName(topic)
+	if !ok {
+		return ErrTopicNotFound
+	}
+	return client.Unsub(t)
+}
@@ -0,0 +1,113 @@
+package pubsubsse
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// HeartbeatMode defines what is written to an idle event stream.
+type HeartbeatMode int
+
+const (
+	// Write the SSE comment line ": ping". Browsers ignore it.
+	HeartbeatComment HeartbeatMode = iota
+	// Write a sys "ping" event which the client can see.
+	HeartbeatSysPing
+)
+
+// String returns the name of the mode.
+func (m HeartbeatMode) String() string {
+	switch m {
+	case HeartbeatComment:
+		return "comment"
+	case HeartbeatSysPing:
+		return "sys_ping"
+	}
+	return "unknown"
+}
+
+// HeartbeatOptions configures the heartbeat of event streams.
+type HeartbeatOptions struct {
+	// Interval between two heartbeats. 0 disables the heartbeat.
+	Interval time.Duration
+	Mode     HeartbeatMode
+}
+
+// Get the heartbeat of the event streams
+func (s *SSEPubSubService) GetHeartbeat() HeartbeatOptions {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.heartbeat
+}
+
+// Set the heartbeat of the event streams.
+// While no messages are flowing, a heartbeat is written every interval,
+// so proxies keep the connection open and dead connections are detected by the failing write.
+// Streams which are already open keep their heartbeat.
+func (s *SSEPubSubService) SetHeartbeat(o HeartbeatOptions) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.heartbeat = o
+}
+
+// Build the heartbeat frame in the wire format of the stream
+func (o HeartbeatOptions) frame(format WireFormat) string {
+	if o.Mode == HeartbeatSysPing {
+		data, _ := json.Marshal(&eventData{
+			Sys: []eventDataSys{{Type: "ping"}},
+		})
+		if format == WireNamedEvents {
+			return sseFrame("", SysEventName, string(data))
+		}
+		return sseFrame("", "", string(data))
+	}
+	return ": ping\n\n"
+}
+
+// heartbeatTimer fires when nothing was written to the stream for the heartbeat interval.
+// It is reset on every write, so the heartbeat is written exactly one interval after the last write.
+type heartbeatTimer struct {
+	interval time.Duration
+	timer    *time.Timer
+}
+
+// Create the timer of the heartbeat
+func (o HeartbeatOptions) newTimer() *heartbeatTimer {
+	h := &heartbeatTimer{interval: o.Interval}
+	if o.Interval > 0 {
+		h.timer = time.NewTimer(o.Interval)
+	}
+	return h
+}
+
+// Get the channel of the timer. It is nil if the heartbeat is disabled.
+func (h *heartbeatTimer) C() <-chan time.Time {
+	if h.timer == nil {
+		return nil
+	}
+	return h.timer.C
+}
+
+// Start the interval again after a write.
+// After the timer fired, it must only be reset when its channel was read.
+func (h *heartbeatTimer) reset() {
+	if h.timer == nil {
+		return
+	}
+	if !h.timer.Stop() {
+		select {
+		case <-h.timer.C:
+		default:
+		}
+	}
+	h.timer.Reset(h.interval)
+}
+
+// Stop the timer
+func (h *heartbeatTimer) stop() {
+	if h.timer != nil {
+		h.timer.Stop()
+	}
+}
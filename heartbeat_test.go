@@ -0,0 +1,141 @@
+package pubsubsse
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests for:
+// +SetHeartbeat(o HeartbeatOptions)
+// +GetHeartbeat(): HeartbeatOptions
+
+// Wait for a frame which contains s
+func waitForFrame(t *testing.T, frames chan string, s string) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case frame := <-frames:
+			if strings.Contains(frame, s) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Frame containing %q not received", s)
+		}
+	}
+}
+
+func TestHeartbeat_Comment(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetHeartbeat(HeartbeatOptions{Interval: 5 * time.Millisecond})
+	if ssePubSub.GetHeartbeat().Mode != HeartbeatComment {
+		t.Error("Expected comment heartbeat by default")
+	}
+
+	client := ssePubSub.NewClient()
+	frames, cancel := resumeClient(client, "")
+	defer cancel()
+
+	waitForFrame(t, frames, ": ping\n\n")
+}
+
+func TestHeartbeat_SysPing(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetHeartbeat(HeartbeatOptions{Interval: 5 * time.Millisecond, Mode: HeartbeatSysPing})
+
+	client := ssePubSub.NewClient()
+	frames, cancel := resumeClient(client, "")
+	defer cancel()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case frame := <-frames:
+			_, data := parseFrame(t, frame)
+			if len(data.Sys) == 1 && data.Sys[0].Type == "ping" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Sys ping not received")
+		}
+	}
+}
+
+// TestHeartbeat_AfterLastWrite tests that the heartbeat is written one interval after the last write.
+func TestHeartbeat_AfterLastWrite(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetHeartbeat(HeartbeatOptions{Interval: 100 * time.Millisecond})
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	client.Sub(topic)
+	frames, cancel := resumeClient(client, "")
+	defer cancel()
+
+	// An update between two heartbeats
+	waitForFrame(t, frames, ": ping\n\n")
+	time.Sleep(20 * time.Millisecond)
+	topic.Pub("a")
+	waitForUpdate(t, frames, "a")
+	written := time.Now()
+
+	waitForFrame(t, frames, ": ping\n\n")
+	if idle := time.Since(written); idle < 80*time.Millisecond || idle >= 150*time.Millisecond {
+		t.Errorf("Expected heartbeat one interval after the update, got %s", idle)
+	}
+}
+
+func TestHeartbeat_Disabled(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	frames, cancel := resumeClient(client, "")
+	defer cancel()
+
+	<-frames // Init message
+	select {
+	case frame := <-frames:
+		t.Errorf("Unexpected frame %q", frame)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// ResponseWriter which fails after the first write like a closed connection
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	writes int
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	w.writes++
+	if w.writes > 1 {
+		return 0, errors.New("broken pipe")
+	}
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestEvent_HeartbeatDetectsDeadConnection(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetHeartbeat(HeartbeatOptions{Interval: 5 * time.Millisecond})
+	client := ssePubSub.NewClient()
+
+	w := &failingWriter{ResponseRecorder: httptest.NewRecorder()}
+	req := httptest.NewRequest(http.MethodGet, "/event?client_id="+client.GetID(), nil)
+
+	done := make(chan struct{})
+	go func() {
+		Event(ssePubSub, w, req)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Event did not return after the write failed")
+	}
+	if client.GetStatus() != Waiting {
+		t.Error("Expected client to be waiting after the connection died")
+	}
+}
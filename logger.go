@@ -0,0 +1,98 @@
+package pubsubsse
+
+// Logger is the structured logger of the service.
+// The arguments are alternating keys and values, like those of log/slog,
+// so a *slog.Logger can be used directly:
+//
+//	ssePubSub.SetLogger(slog.Default())
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// Keys of the structured log fields
+const (
+	logKeyClientID = "client_id"
+	logKeyTopic    = "topic"
+	logKeyGroup    = "group"
+	logKeyError    = "error"
+	logKeyPayload  = "payload"
+)
+
+// Logger which discards everything. It is the default logger of the service.
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
+
+// Get the logger. It is never nil.
+func (s *SSEPubSubService) GetLogger() Logger {
+	s.logLock.RLock()
+	defer s.logLock.RUnlock()
+
+	if s.logger == nil {
+		return nopLogger{}
+	}
+	return s.logger
+}
+
+// Set the logger. nil discards all log messages.
+func (s *SSEPubSubService) SetLogger(l Logger) {
+	s.logLock.Lock()
+	defer s.logLock.Unlock()
+
+	s.logger = l
+}
+
+// Get if the payloads of the messages are logged
+func (s *SSEPubSubService) GetLogPayloads() bool {
+	s.logLock.RLock()
+	defer s.logLock.RUnlock()
+
+	return s.logPayloads
+}
+
+// Set if the payloads of the messages are logged (at debug level).
+// They are not logged by default, because they may contain sensitive data.
+func (s *SSEPubSubService) SetLogPayloads(enabled bool) {
+	s.logLock.Lock()
+	defer s.logLock.Unlock()
+
+	s.logPayloads = enabled
+}
+
+// Get the logger of the service of the client
+func (c *Client) logger() Logger {
+	if c.sSEPubSubService == nil {
+		return nopLogger{}
+	}
+	return c.sSEPubSubService.GetLogger()
+}
+
+// Get the logger of the service of the group
+func (g *Group) logger() Logger {
+	if g.service == nil {
+		return nopLogger{}
+	}
+	return g.service.GetLogger()
+}
+
+// Get the logger of the service of the topic
+func (t *Topic) logger() Logger {
+	if s := t.service(); s != nil {
+		return s.GetLogger()
+	}
+	return nopLogger{}
+}
+
+// Get the logger of an option struct, e.g. of a backplane
+func loggerOrNop(l Logger) Logger {
+	if l == nil {
+		return nopLogger{}
+	}
+	return l
+}
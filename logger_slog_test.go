@@ -0,0 +1,24 @@
+//go:build go1.21
+
+package pubsubsse
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSSEPubSubService_SetLogger_Slog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ssePubSub := NewSSEPubSubService()
+
+	// *slog.Logger implements Logger
+	ssePubSub.SetLogger(slog.New(slog.NewTextHandler(buf, nil)))
+	ssePubSub.SetBackplane(failingBackplane{})
+	ssePubSub.NewPublicTopic("news")
+
+	if out := buf.String(); !strings.Contains(out, "level=ERROR") || !strings.Contains(out, "topic=news") {
+		t.Errorf("Expected structured error message, got %q", out)
+	}
+}
@@ -0,0 +1,139 @@
+package pubsubsse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Tests for:
+// +GetLogger(): Logger
+// +SetLogger(l Logger)
+// +SetLogPayloads(enabled bool)
+
+// Log entry of the recordLogger
+type logEntry struct {
+	level  string
+	msg    string
+	fields map[string]interface{}
+}
+
+// Logger which records the entries
+type recordLogger struct {
+	lock    sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordLogger) record(level, msg string, args []interface{}) {
+	fields := map[string]interface{}{}
+	for i := 0; i+1 < len(args); i += 2 {
+		fields[fmt.Sprint(args[i])] = args[i+1]
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, fields: fields})
+}
+
+func (l *recordLogger) Debug(msg string, args ...interface{}) { l.record("debug", msg, args) }
+func (l *recordLogger) Info(msg string, args ...interface{})  { l.record("info", msg, args) }
+func (l *recordLogger) Warn(msg string, args ...interface{})  { l.record("warn", msg, args) }
+func (l *recordLogger) Error(msg string, args ...interface{}) { l.record("error", msg, args) }
+
+// Get the entries with the message
+func (l *recordLogger) find(msg string) []logEntry {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	found := []logEntry{}
+	for _, e := range l.entries {
+		if e.msg == msg {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// Backplane which fails to publish, so every change of the service logs an error
+type failingBackplane struct{}
+
+func (failingBackplane) Publish(msg *BackplaneMessage) error             { return errors.New("unreachable") }
+func (failingBackplane) Subscribe(handler func(*BackplaneMessage)) error { return nil }
+func (failingBackplane) Close() error                                    { return nil }
+
+func TestSSEPubSubService_SetLogger(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetBackplane(failingBackplane{})
+
+	// No-op by default
+	if ssePubSub.GetLogger() == nil {
+		t.Fatal("Expected a default logger")
+	}
+	ssePubSub.NewPublicTopic("a")
+
+	logger := &recordLogger{}
+	ssePubSub.SetLogger(logger)
+
+	// Structured fields
+	ssePubSub.NewPublicTopic("b")
+	entries := logger.find("Error publishing to backplane")
+	if len(entries) != 1 || entries[0].level != "error" || entries[0].fields[logKeyTopic] != "b" || entries[0].fields[logKeyError] == nil {
+		t.Errorf("Expected error with topic and error fields, got %+v", entries)
+	}
+
+	group := ssePubSub.NewGroup("group")
+	group.NewTopic("c")
+	entries = logger.find("Error publishing to backplane")
+	if len(entries) != 2 || entries[1].fields[logKeyGroup] != "group" {
+		t.Errorf("Expected error with group field, got %+v", entries)
+	}
+
+	// nil discards the messages
+	ssePubSub.SetLogger(nil)
+	ssePubSub.NewPublicTopic("d")
+	if len(logger.find("Error publishing to backplane")) != 2 {
+		t.Error("Expected no more messages after the logger was removed")
+	}
+}
+
+func TestSSEPubSubService_SetLogPayloads(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	logger := &recordLogger{}
+	ssePubSub.SetLogger(logger)
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	client.Sub(topic)
+	client.Poll(context.Background(), "", 0)
+
+	// Payloads are not logged by default
+	topic.Pub("secret")
+	client.Poll(context.Background(), "", 0)
+	entries := logger.find("Sending message to client")
+	if len(entries) == 0 {
+		t.Fatal("Expected debug message for the sent message")
+	}
+	for _, e := range entries {
+		if e.level != "debug" || e.fields[logKeyClientID] != client.GetID() {
+			t.Errorf("Expected debug message with client_id, got %+v", e)
+		}
+		if _, ok := e.fields[logKeyPayload]; ok {
+			t.Errorf("Expected no payload, got %+v", e)
+		}
+	}
+
+	// Opt-in
+	ssePubSub.SetLogPayloads(true)
+	if !ssePubSub.GetLogPayloads() {
+		t.Error("Expected payload logging to be enabled")
+	}
+	topic.Pub("visible")
+	client.Poll(context.Background(), "", 0)
+	entries = logger.find("Sending message to client")
+	last := entries[len(entries)-1]
+	if payload, _ := last.fields[logKeyPayload].(string); !strings.Contains(payload, "visible") || last.fields[logKeyTopic] != "news" {
+		t.Errorf("Expected payload and topic, got %+v", last)
+	}
+}
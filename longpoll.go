@@ -0,0 +1,211 @@
+package pubsubsse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Timeouts of a poll
+const (
+	DefaultPollTimeout = 30 * time.Second
+	MaxPollTimeout     = 2 * time.Minute
+)
+
+// Header of the LongPoll response with the cursor for the next poll
+const PollCursorHeader = "X-Pubsub-Cursor"
+
+// Poll returns the messages of a long-polling client.
+// The first poll starts the long-poll session: the client gets the status Polling,
+// messages are queued in its stream between the polls and the init message is returned.
+// If no messages are queued, Poll waits up to timeout for the next one.
+//
+// cursor is the cursor returned by the previous poll. The updates of subscribed topics
+// published after it are re-delivered, so nothing is lost if a response does not arrive.
+// The messages are returned as JSON envelopes, the same as the data of the SSE frames.
+// If ctx is cancelled, nothing is returned and the init message is sent again with the next poll.
+// 0. Check if client is already receiving over an event stream
+// 1. Start the long-poll session
+// 2. Send the init message until a poll returned it
+// 3. Re-deliver updates newer than the cursor
+// 4. Wait for messages if there are none
+// 5. Return the queued messages and the new cursor
+func (c *Client) Poll(ctx context.Context, cursor string, timeout time.Duration) ([]json.RawMessage, string, error) {
+	// An invalid cursor must not start the session, the init message would be lost
+	if _, err := decodeCursor(cursor); err != nil {
+		return nil, "", fmt.Errorf("[C:%s]: %w: %s", c.GetID(), ErrInvalidRequest, err)
+	}
+
+	c.pollLock.Lock()
+	defer c.pollLock.Unlock()
+
+	msgs := []json.RawMessage{}
+	collect := func(frame string) {
+		if data, ok := sseData(frame); ok {
+			msgs = append(msgs, json.RawMessage(data))
+		}
+	}
+
+	// Start the long-poll session
+	c.lock.Lock()
+	if c.status == Receving {
+		c.lock.Unlock()
+		return nil, "", fmt.Errorf("[C:%s]: %w", c.id, ErrAlreadyReceiving)
+	}
+	started := c.status == Waiting
+	if started {
+		c.stopchan = make(chan struct{})
+		c.status = Polling
+		c.wireFormat = WireEnvelope
+		c.pollInit = true
+	}
+	sendInit := c.pollInit
+	stopchan := c.stopchan
+	c.polls++
+	c.lock.Unlock()
+
+	defer func() {
+		c.lock.Lock()
+		c.polls--
+		c.lastSeen = time.Now()
+		c.lock.Unlock()
+	}()
+
+	// Register the poll, so Shutdown waits for it
+	if err := c.sSEPubSubService.addStream(c); err != nil {
+		c.stop()
+		return nil, "", fmt.Errorf("[C:%s]: %w", c.GetID(), err)
+	}
+	defer c.sSEPubSubService.doneStream()
+
+	// Messages taken from the stream and the positions of the cursor before they were delivered.
+	// If the poll is cancelled, they are put back, so the next poll returns them.
+	var popped []*message
+	var positions map[string]*cursorPos
+	deliverStream := func() {
+		popped = c.stream.popAll()
+		positions = c.cursorPositions(popped)
+		c.deliverMessages(popped, collect)
+	}
+
+	// Return the messages. The init message and the messages of the stream are delivered only if the poll was not cancelled.
+	finish := func() ([]json.RawMessage, string, error) {
+		if err := ctx.Err(); err != nil {
+			c.stream.pushFront(popped)
+			c.restoreCursor(positions)
+			return nil, "", err
+		}
+		c.lock.Lock()
+		c.pollInit = false
+		c.lock.Unlock()
+		return msgs, c.encodeCursor(), nil
+	}
+
+	if sendInit {
+		if err := c.sendInitMSG(collect); err != nil {
+			c.logger().Error("Error sending init message to client", logKeyClientID, c.GetID(), logKeyError, err)
+			return nil, "", err
+		}
+	}
+
+	// Re-deliver updates newer than the cursor
+	if cursor != "" {
+		if err := c.replay(cursor, collect); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// Wait for messages if there are none
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+wait:
+	for len(msgs) == 0 && c.stream.len() == 0 {
+		select {
+		case <-c.stream.ready:
+		case <-timer.C:
+			break wait
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		case <-stopchan:
+			// Flush the pending messages, e.g. the shutdown message
+			if c.sSEPubSubService.isClosed() {
+				deliverStream()
+			}
+			// Otherwise the messages belong to the event stream the client switched to, if any
+			return finish()
+		}
+	}
+
+	deliverStream()
+
+	return finish()
+}
+
+// Encode the cursor of the client
+func (c *Client) encodeCursor() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return encodeCursor(c.cursor)
+}
+
+// LongPoll handles the polls of a long-polling client.
+// It is an alternative to Event and WebSocket for environments which can hold neither open.
+// The response is a JSON array of the messages the client would receive over the SSE stream.
+// The cursor for the next poll is sent in the X-Pubsub-Cursor header.
+// Query parameters:
+//   - client_id
+//   - cursor: cursor of the previous response
+//   - timeout: seconds to wait for a message (default 30, max 120)
+func LongPoll(s *SSEPubSubService, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	clientID := r.URL.Query().Get("client_id")
+
+	if !authorize(s, w, r, &AuthRequest{Action: ActionConnect, ClientID: clientID}) {
+		return
+	}
+
+	// Get the client
+	client, ok := s.GetClientByID(clientID)
+	if !ok {
+		writeError(s, w, ErrClientNotFound)
+		return
+	}
+
+	// Test if client is already receiving over an event stream
+	if client.GetStatus() == Receving {
+		writeError(s, w, ErrAlreadyReceiving)
+		return
+	}
+
+	// Get the timeout
+	timeout := DefaultPollTimeout
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		seconds, err := strconv.Atoi(t)
+		if err != nil || seconds < 0 {
+			writeError(s, w, detailError(ErrInvalidRequest, "invalid timeout"))
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+	if timeout > MaxPollTimeout {
+		timeout = MaxPollTimeout
+	}
+
+	msgs, cursor, err := client.Poll(r.Context(), r.URL.Query().Get("cursor"), timeout)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		writeError(s, w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set(PollCursorHeader, cursor)
+	json.NewEncoder(w).Encode(msgs)
+}
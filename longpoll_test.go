@@ -0,0 +1,240 @@
+package pubsubsse
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Tests for:
+// +Poll(ctx Context, cursor string, timeout Duration): []RawMessage, string, error
+// +LongPoll(s *SSEPubSubService, w ResponseWriter, r *Request)
+
+// Decode the messages of a poll
+func decodePoll(t *testing.T, msgs []json.RawMessage) []eventData {
+	t.Helper()
+	data := []eventData{}
+	for _, m := range msgs {
+		var d eventData
+		if err := json.Unmarshal(m, &d); err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, d)
+	}
+	return data
+}
+
+func TestClient_Poll(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	client.Sub(topic)
+
+	// The first poll returns the init message
+	msgs, cursor, err := client.Poll(context.Background(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := decodePoll(t, msgs)
+	if len(data) != 1 || len(data[0].Sys) == 0 {
+		t.Fatalf("Expected init message, got %s", msgs)
+	}
+	if client.GetStatus() != Polling {
+		t.Errorf("Expected status Polling, got %d", client.GetStatus())
+	}
+
+	// Messages are queued between the polls
+	topic.Pub("a")
+	msgs, cursor, err = client.Poll(context.Background(), cursor, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updates := getUpdates(decodePoll(t, msgs), "news"); len(updates) != 1 || updates[0].Data != "a" {
+		t.Fatalf("Expected update a, got %s", msgs)
+	}
+	if cursor != "news="+topic.epoch+".1" {
+		t.Errorf("Expected cursor news=%s.1, got %s", topic.epoch, cursor)
+	}
+
+	// The response of a poll is lost: the next poll with the old cursor re-delivers the update
+	topic.Pub("b")
+	if _, _, err := client.Poll(context.Background(), cursor, 0); err != nil {
+		t.Fatal(err)
+	}
+	msgs, cursor, _ = client.Poll(context.Background(), cursor, 0)
+	if updates := getUpdates(decodePoll(t, msgs), "news"); len(updates) != 1 || updates[0].Data != "b" {
+		t.Fatalf("Expected update b to be re-delivered, got %s", msgs)
+	}
+	if cursor != "news="+topic.epoch+".2" {
+		t.Errorf("Expected cursor news=%s.2, got %s", topic.epoch, cursor)
+	}
+
+	// Wait for the next message
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		topic.Pub("c")
+	}()
+	msgs, _, _ = client.Poll(context.Background(), cursor, time.Second)
+	if updates := getUpdates(decodePoll(t, msgs), "news"); len(updates) != 1 || updates[0].Data != "c" {
+		t.Fatalf("Expected update c, got %s", msgs)
+	}
+
+	// Nothing is published within the timeout
+	msgs, _, _ = client.Poll(context.Background(), "", 10*time.Millisecond)
+	if len(msgs) != 0 {
+		t.Errorf("Expected no messages, got %s", msgs)
+	}
+
+	// Invalid cursor
+	if _, _, err := client.Poll(context.Background(), "news=x", 0); err == nil {
+		t.Error("Expected error for invalid cursor")
+	}
+}
+
+// TestClient_Poll_Cancelled tests that the init message is sent again if the first poll was cancelled.
+func TestClient_Poll_Cancelled(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := client.Poll(ctx, "", 0); err == nil {
+		t.Fatal("Expected error for cancelled poll")
+	}
+
+	msgs, _, err := client.Poll(context.Background(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := decodePoll(t, msgs); len(data) != 1 || !hasSys(data[0], "topics") {
+		t.Fatalf("Expected init message, got %s", msgs)
+	}
+
+	// Once delivered, it is not sent again
+	if msgs, _, _ := client.Poll(context.Background(), "", 0); len(msgs) != 0 {
+		t.Errorf("Expected no messages, got %s", msgs)
+	}
+}
+
+// TestClient_Poll_CancelledAfterPop tests that the messages taken from the stream by a cancelled poll are not lost.
+func TestClient_Poll_CancelledAfterPop(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	if _, _, err := client.Poll(context.Background(), "", 0); err != nil {
+		t.Fatal(err)
+	}
+	client.Sub(topic)
+	if _, _, err := client.Poll(context.Background(), "", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	topic.Pub("a")
+	topic.Pub("b")
+	eventually(t, "Updates not queued", func() bool { return client.stream.len() == 2 })
+
+	// The poll takes the messages from the stream, but is cancelled before it returns them
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := client.Poll(ctx, "", 0); err == nil {
+		t.Fatal("Expected error for cancelled poll")
+	}
+
+	msgs, _, err := client.Poll(context.Background(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := decodePoll(t, msgs)
+	if len(data) != 2 || data[0].Updates[0].Data != "a" || data[1].Updates[0].Data != "b" {
+		t.Errorf("Expected the updates a and b, got %s", msgs)
+	}
+}
+
+func TestClient_Poll_Idle(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	client.Poll(context.Background(), "", 0)
+
+	// The client is idle between its polls
+	time.Sleep(5 * time.Millisecond)
+	if client.GetIdleTime() < 5*time.Millisecond {
+		t.Errorf("Expected idle time between polls, got %s", client.GetIdleTime())
+	}
+
+	// The client is not idle while waiting in a poll
+	done := make(chan struct{})
+	go func() {
+		client.Poll(context.Background(), "", time.Second)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if client.GetIdleTime() != 0 {
+		t.Errorf("Expected no idle time while polling, got %s", client.GetIdleTime())
+	}
+
+	// Removing the client ends the poll
+	ssePubSub.RemoveClient(client)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Poll did not end after the client was removed")
+	}
+}
+
+func TestClient_Poll_SwitchToEvent(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	client.Poll(context.Background(), "", 0)
+
+	// A polling client can switch to the event stream
+	_, cancel := resumeClient(client, "")
+	defer cancel()
+
+	if _, _, err := client.Poll(context.Background(), "", 0); err == nil {
+		t.Error("Expected error while receiving over the event stream")
+	}
+}
+
+func TestLongPoll(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	client.Sub(topic)
+
+	poll := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		LongPoll(ssePubSub, w, httptest.NewRequest(http.MethodGet, "/poll?"+query, nil))
+		return w
+	}
+
+	w := poll("client_id=" + client.GetID() + "&timeout=0")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var msgs []json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &msgs); err != nil || len(msgs) != 1 {
+		t.Fatalf("Expected array with init message, got %s", w.Body)
+	}
+
+	topic.Pub("a")
+	w = poll("client_id=" + client.GetID() + "&timeout=0&cursor=" + w.Header().Get(PollCursorHeader))
+	if w.Header().Get(PollCursorHeader) != "news="+topic.epoch+".1" {
+		t.Errorf("Expected cursor news=%s.1, got %q", topic.epoch, w.Header().Get(PollCursorHeader))
+	}
+	msgs = nil
+	json.Unmarshal(w.Body.Bytes(), &msgs)
+	if updates := getUpdates(decodePoll(t, msgs), "news"); len(updates) != 1 {
+		t.Errorf("Expected update, got %s", w.Body)
+	}
+
+	if w := poll("client_id=unknown"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown client, got %d", w.Code)
+	}
+	if w := poll("client_id=" + client.GetID() + "&timeout=x"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid timeout, got %d", w.Code)
+	}
+}
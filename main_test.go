@@ -94,13 +94,14 @@ func httpToEvent(t *testing.T, client *Client, port int, connected, done chan bo
 					fmt.Printf("ok: %s\n", client.GetID())
 				}
 
-				// Remove the "data: " from message
-				message = strings.TrimPrefix(message, "data: ")
-
-				if message == "\n" {
+				// Skip everything which is not data, e.g. the event id
+				if !strings.HasPrefix(message, "data: ") {
 					continue
 				}
 
+				// Remove the "data: " from message
+				message = strings.TrimPrefix(message, "data: ")
+
 				var rvalue eventData
 				// Unmarshal the JSON data
 				err = json.Unmarshal([]byte(message), &rvalue)
@@ -114,3 +115,39 @@ func httpToEvent(t *testing.T, client *Client, port int, connected, done chan bo
 		}
 	}()
 }
+
+// Mark the client as receiving without opening an event stream.
+// Everything sent to the client stays in its stream and can be read with drainStream.
+func setReceiving(client *Client) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+
+	client.status = Receving
+}
+
+// Read all messages which are waiting in the stream of the client
+func drainStream(t *testing.T, client *Client) []eventData {
+	data := []eventData{}
+	for _, msg := range client.stream.popAll() {
+		var rvalue eventData
+		if err := json.Unmarshal([]byte(msg.data), &rvalue); err != nil {
+			t.Error(err)
+			continue
+		}
+		data = append(data, rvalue)
+	}
+	return data
+}
+
+// Get all updates for the topic from the received data
+func getUpdates(data []eventData, topic string) []eventDataUpdates {
+	updates := []eventDataUpdates{}
+	for _, d := range data {
+		for _, u := range d.Updates {
+			if u.Topic == topic {
+				updates = append(updates, u)
+			}
+		}
+	}
+	return updates
+}
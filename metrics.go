@@ -0,0 +1,300 @@
+package pubsubsse
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Content type of the Prometheus text format
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Buckets of the histograms
+var (
+	sendLatencyBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+	queueDepthBuckets  = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000}
+)
+
+// Counters and histograms of a service. The gauges are read from the state of the service when they are written.
+type metrics struct {
+	published map[topicType]*atomic.Uint64
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	reconnect atomic.Uint64
+
+	sendLatency *histogram
+	queueDepth  *histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		published: map[topicType]*atomic.Uint64{
+			TPublic:  {},
+			TPrivate: {},
+			TGroup:   {},
+		},
+		sendLatency: newHistogram(sendLatencyBuckets),
+		queueDepth:  newHistogram(queueDepthBuckets),
+	}
+}
+
+// Count an update which was fanned out to the subscribers of a topic
+func (m *metrics) addPublished(t topicType) {
+	if m == nil {
+		return
+	}
+	if c, ok := m.published[t]; ok {
+		c.Add(1)
+	}
+}
+
+// Count a message which was sent to a client
+func (m *metrics) addDelivered() {
+	if m != nil {
+		m.delivered.Add(1)
+	}
+}
+
+// Count messages which were dropped because the stream of a client was full
+func (m *metrics) addDropped(n uint64) {
+	if m != nil && n > 0 {
+		m.dropped.Add(n)
+	}
+}
+
+// Count a client which reconnected with a Last-Event-ID
+func (m *metrics) addReconnect() {
+	if m != nil {
+		m.reconnect.Add(1)
+	}
+}
+
+// Observe the time between publishing and sending a message
+func (m *metrics) observeSendLatency(d time.Duration) {
+	if m != nil {
+		m.sendLatency.observe(d.Seconds())
+	}
+}
+
+// Observe the number of messages taken from the stream of a client at once
+func (m *metrics) observeQueueDepth(n int) {
+	if m != nil {
+		m.queueDepth.observe(float64(n))
+	}
+}
+
+// Get the metrics of the service of the client
+func (c *Client) metrics() *metrics {
+	if c.sSEPubSubService == nil {
+		return nil
+	}
+	return c.sSEPubSubService.metrics
+}
+
+// Get the metrics of the service of the topic
+func (t *Topic) metrics() *metrics {
+	if s := t.service(); s != nil {
+		return s.metrics
+	}
+	return nil
+}
+
+// -----------------------------
+// Histogram
+// -----------------------------
+
+// Histogram with cumulative buckets like a Prometheus histogram
+type histogram struct {
+	lock    sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// Write the buckets, the sum and the count of the histogram
+func (h *histogram) write(w *metricsWriter, name string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i, b := range h.buckets {
+		w.sample(name+"_bucket", []string{"le", formatFloat(b)}, float64(h.counts[i]))
+	}
+	w.sample(name+"_bucket", []string{"le", "+Inf"}, float64(h.count))
+	w.sample(name+"_sum", nil, h.sum)
+	w.sample(name+"_count", nil, float64(h.count))
+}
+
+// -----------------------------
+// Prometheus text format
+// -----------------------------
+
+// Writer of the Prometheus text format
+type metricsWriter struct {
+	w *bufio.Writer
+}
+
+// Write the HELP and TYPE lines of a metric
+func (w *metricsWriter) header(name, typ, help string) {
+	fmt.Fprintf(w.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// Write a sample. labels are alternating names and values.
+func (w *metricsWriter) sample(name string, labels []string, value float64) {
+	w.w.WriteString(name)
+	if len(labels) > 0 {
+		w.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.w.WriteByte(',')
+			}
+			fmt.Fprintf(w.w, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+		}
+		w.w.WriteByte('}')
+	}
+	w.w.WriteByte(' ')
+	w.w.WriteString(formatFloat(value))
+	w.w.WriteByte('\n')
+}
+
+// Escape a label value
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WriteMetrics writes the metrics of the service in the Prometheus text format:
+//
+//	pubsub_clients{status}                      clients by status (waiting, receiving, polling)
+//	pubsub_topics{type}                         topics by type (public, private, group)
+//	pubsub_groups                               groups
+//	pubsub_topic_subscriptions{topic,type,group} subscribed clients of the public and group topics
+//	pubsub_messages_published_total{type}       updates fanned out to the subscribers of a topic
+//	pubsub_messages_delivered_total             messages sent to clients
+//	pubsub_messages_dropped_total               messages dropped because the stream of a client was full
+//	pubsub_reconnects_total                     clients which reconnected with a Last-Event-ID
+//	pubsub_send_latency_seconds                 time between publishing and sending an update
+//	pubsub_queue_depth                          messages taken from the stream of a client at once
+//
+// Private topics are counted, but have no subscription gauge, because there is one per client.
+func (s *SSEPubSubService) WriteMetrics(out io.Writer) error {
+	w := &metricsWriter{w: bufio.NewWriter(out)}
+
+	// Clients by status and private topics
+	statusNames := map[status]string{Waiting: "waiting", Receving: "receiving", Polling: "polling"}
+	clientsByStatus := map[status]int{}
+	privateTopics := 0
+	for _, c := range s.GetClients() {
+		clientsByStatus[c.GetStatus()]++
+		privateTopics += len(c.GetPrivateTopics())
+	}
+	w.header("pubsub_clients", "gauge", "Number of clients by status.")
+	for _, st := range []status{Waiting, Receving, Polling} {
+		w.sample("pubsub_clients", []string{"status", statusNames[st]}, float64(clientsByStatus[st]))
+	}
+
+	// Topics by type and their subscriptions
+	type topicSubs struct {
+		name, ttype, group string
+		clients            int
+	}
+	subs := []topicSubs{}
+	publicTopics := s.GetPublicTopics()
+	for _, t := range publicTopics {
+		subs = append(subs, topicSubs{t.GetName(), string(TPublic), "", len(t.GetClients())})
+	}
+	groups := s.GetGroups()
+	groupTopics := 0
+	for _, g := range groups {
+		for _, t := range g.GetTopics() {
+			subs = append(subs, topicSubs{t.GetName(), string(TGroup), g.GetName(), len(t.GetClients())})
+			groupTopics++
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].group != subs[j].group {
+			return subs[i].group < subs[j].group
+		}
+		return subs[i].name < subs[j].name
+	})
+
+	w.header("pubsub_topics", "gauge", "Number of topics by type.")
+	w.sample("pubsub_topics", []string{"type", string(TPublic)}, float64(len(publicTopics)))
+	w.sample("pubsub_topics", []string{"type", string(TPrivate)}, float64(privateTopics))
+	w.sample("pubsub_topics", []string{"type", string(TGroup)}, float64(groupTopics))
+
+	w.header("pubsub_groups", "gauge", "Number of groups.")
+	w.sample("pubsub_groups", nil, float64(len(groups)))
+
+	w.header("pubsub_topic_subscriptions", "gauge", "Number of clients subscribed to a public or group topic.")
+	for _, t := range subs {
+		w.sample("pubsub_topic_subscriptions", []string{"topic", t.name, "type", t.ttype, "group", t.group}, float64(t.clients))
+	}
+
+	// Counters
+	m := s.metrics
+	w.header("pubsub_messages_published_total", "counter", "Number of updates fanned out to the subscribers of a topic.")
+	for _, t := range []topicType{TPublic, TPrivate, TGroup} {
+		w.sample("pubsub_messages_published_total", []string{"type", string(t)}, float64(m.published[t].Load()))
+	}
+	w.header("pubsub_messages_delivered_total", "counter", "Number of messages sent to clients.")
+	w.sample("pubsub_messages_delivered_total", nil, float64(m.delivered.Load()))
+	w.header("pubsub_messages_dropped_total", "counter", "Number of messages dropped because the stream of a client was full.")
+	w.sample("pubsub_messages_dropped_total", nil, float64(m.dropped.Load()))
+	w.header("pubsub_reconnects_total", "counter", "Number of clients which reconnected with a Last-Event-ID.")
+	w.sample("pubsub_reconnects_total", nil, float64(m.reconnect.Load()))
+
+	// Histograms
+	w.header("pubsub_send_latency_seconds", "histogram", "Time between publishing an update and sending it to a client.")
+	m.sendLatency.write(w, "pubsub_send_latency_seconds")
+	w.header("pubsub_queue_depth", "histogram", "Number of messages taken from the stream of a client at once.")
+	m.queueDepth.write(w, "pubsub_queue_depth")
+
+	return w.w.Flush()
+}
+
+// Metrics handles HTTP requests for the metrics of the service in the Prometheus text format.
+func Metrics(s *SSEPubSubService, w http.ResponseWriter, r *http.Request) {
+	if !authorize(s, w, r, &AuthRequest{Action: ActionMetrics}) {
+		return
+	}
+
+	w.Header().Set("Content-Type", metricsContentType)
+	if err := s.WriteMetrics(w); err != nil {
+		s.GetLogger().Debug("Error writing metrics", logKeyError, err)
+	}
+}
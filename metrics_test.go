@@ -0,0 +1,122 @@
+package pubsubsse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Tests for:
+// +WriteMetrics(w Writer): error
+// +Metrics(s *SSEPubSubService, w ResponseWriter, r *Request)
+
+func TestMetrics(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("news")
+	group := ssePubSub.NewGroup("g")
+	group.NewTopic("room")
+
+	// Polling client with a small stream
+	polling := ssePubSub.NewClient()
+	polling.SetStreamOptions(StreamOptions{BufferSize: 1, Policy: DropNewest})
+	polling.Sub(topic)
+	polling.Poll(context.Background(), "", 0)
+
+	// Waiting client with a private topic
+	waiting := ssePubSub.NewClient()
+	waiting.NewPrivateTopic("private")
+
+	// The second update is dropped
+	topic.Pub("a")
+	topic.Pub("b")
+	polling.Poll(context.Background(), "", 0)
+
+	// Receiving client which reconnects
+	receiving := ssePubSub.NewClient()
+	receiving.Sub(topic)
+	_, cancel := resumeClient(receiving, "news="+topic.epoch+".0")
+	defer cancel()
+
+	w := httptest.NewRecorder()
+	Metrics(ssePubSub, w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("Expected Prometheus text format, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+
+	expected := []string{
+		"# TYPE pubsub_clients gauge",
+		`pubsub_clients{status="waiting"} 1`,
+		`pubsub_clients{status="receiving"} 1`,
+		`pubsub_clients{status="polling"} 1`,
+		`pubsub_topics{type="public"} 1`,
+		`pubsub_topics{type="private"} 1`,
+		`pubsub_topics{type="group"} 1`,
+		"pubsub_groups 1",
+		`pubsub_topic_subscriptions{topic="news",type="public",group=""} 2`,
+		`pubsub_topic_subscriptions{topic="room",type="group",group="g"} 0`,
+		"# TYPE pubsub_messages_published_total counter",
+		`pubsub_messages_published_total{type="public"} 2`,
+		"pubsub_messages_dropped_total 1",
+		"pubsub_reconnects_total 1",
+		"# TYPE pubsub_send_latency_seconds histogram",
+		`pubsub_send_latency_seconds_bucket{le="+Inf"} 1`,
+		"pubsub_send_latency_seconds_count 1",
+		`pubsub_queue_depth_bucket{le="1"} 1`,
+		"pubsub_queue_depth_count 1",
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected line %q in metrics:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "pubsub_messages_delivered_total 0\n") {
+		t.Errorf("Expected delivered messages, got:\n%s", body)
+	}
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	server := httptest.NewServer(ssePubSub.Handler(HandlerOptions{}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected metrics, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// The metrics are authorized
+	ssePubSub.SetAuthorizer(NewBearerAuthorizer("secret"))
+	resp, err = http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", resp.StatusCode)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("Unexpected escaped label %s", got)
+	}
+}
+
+func TestMetrics_PubAsync(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("news")
+	<-topic.PubAsync("a")
+
+	w := httptest.NewRecorder()
+	Metrics(ssePubSub, w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `pubsub_messages_published_total{type="public"} 1`+"\n") {
+		t.Errorf("Expected PubAsync to be counted, got:\n%s", w.Body)
+	}
+}
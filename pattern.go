@@ -0,0 +1,105 @@
+package pubsubsse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Wildcards which can be used in topic patterns.
+// They follow the MQTT topic filter syntax:
+// "+" matches exactly one topic level and "#" matches any number of levels
+// (including the parent level itself). "#" must be the last level.
+const (
+	WildcardSingleLevel = "+"
+	WildcardMultiLevel  = "#"
+)
+
+// IsPattern reports whether the topic name contains a wildcard.
+func IsPattern(name string) bool {
+	return strings.ContainsAny(name, WildcardSingleLevel+WildcardMultiLevel)
+}
+
+// validatePattern checks if the pattern is a valid topic pattern.
+func validatePattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("pattern is empty")
+	}
+
+	levels := strings.Split(pattern, "/")
+	for i, level := range levels {
+		if strings.Contains(level, WildcardMultiLevel) {
+			if level != WildcardMultiLevel {
+				return fmt.Errorf("pattern %s: %s must occupy a whole level", pattern, WildcardMultiLevel)
+			}
+			if i != len(levels)-1 {
+				return fmt.Errorf("pattern %s: %s must be the last level", pattern, WildcardMultiLevel)
+			}
+		}
+		if strings.Contains(level, WildcardSingleLevel) && level != WildcardSingleLevel {
+			return fmt.Errorf("pattern %s: %s must occupy a whole level", pattern, WildcardSingleLevel)
+		}
+	}
+
+	return nil
+}
+
+// matchPattern checks if the topic name matches the pattern.
+func matchPattern(pattern, name string) bool {
+	patternLevels := strings.Split(pattern, "/")
+	nameLevels := strings.Split(name, "/")
+
+	for i, level := range patternLevels {
+		if level == WildcardMultiLevel {
+			return true
+		}
+		if i >= len(nameLevels) {
+			return false
+		}
+		if level != WildcardSingleLevel && level != nameLevels[i] {
+			return false
+		}
+	}
+
+	return len(patternLevels) == len(nameLevels)
+}
+
+// Add the client to the clients with patterns if it has patterns, remove it otherwise
+func (s *SSEPubSubService) updatePatternClient(c *Client) {
+	if s == nil {
+		return
+	}
+	if len(c.GetSubscribedPatterns()) == 0 {
+		s.removePatternClient(c)
+		return
+	}
+
+	s.patternLock.Lock()
+	defer s.patternLock.Unlock()
+
+	s.patternClients[c.GetID()] = c
+}
+
+// Remove the client from the clients with patterns
+func (s *SSEPubSubService) removePatternClient(c *Client) {
+	s.patternLock.Lock()
+	defer s.patternLock.Unlock()
+
+	if client, ok := s.patternClients[c.GetID()]; ok && client == c {
+		delete(s.patternClients, c.GetID())
+	}
+}
+
+// Get the clients with patterns. It is empty if no client subscribed a pattern.
+func (s *SSEPubSubService) getPatternClients() map[string]*Client {
+	s.patternLock.RLock()
+	defer s.patternLock.RUnlock()
+
+	if len(s.patternClients) == 0 {
+		return nil
+	}
+	clients := make(map[string]*Client, len(s.patternClients))
+	for k, v := range s.patternClients {
+		clients[k] = v
+	}
+	return clients
+}
@@ -0,0 +1,68 @@
+package pubsubsse
+
+import (
+	"testing"
+)
+
+// Tests for:
+// +IsPattern(name string): bool
+// -validatePattern(pattern string): error
+// -matchPattern(pattern, name string): bool
+
+// TestIsPattern tests the IsPattern() function.
+func TestIsPattern(t *testing.T) {
+	if IsPattern("server/status") {
+		t.Error("Expected server/status not to be a pattern")
+	}
+	if !IsPattern("server/+") {
+		t.Error("Expected server/+ to be a pattern")
+	}
+	if !IsPattern("server/#") {
+		t.Error("Expected server/# to be a pattern")
+	}
+}
+
+// TestValidatePattern tests the validatePattern() function.
+func TestValidatePattern(t *testing.T) {
+	valid := []string{"#", "+", "a/+/c", "a/#", "+/+/#", "a/b"}
+	for _, p := range valid {
+		if err := validatePattern(p); err != nil {
+			t.Errorf("Expected %s to be valid: %s", p, err)
+		}
+	}
+
+	invalid := []string{"", "a/#/c", "a/b#", "a+/b", "#/a"}
+	for _, p := range invalid {
+		if err := validatePattern(p); err == nil {
+			t.Errorf("Expected %s to be invalid", p)
+		}
+	}
+}
+
+// TestMatchPattern tests the matchPattern() function.
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"sensors/+/temperature", "sensors/kitchen/temperature", true},
+		{"sensors/+/temperature", "sensors/kitchen/humidity", false},
+		{"sensors/+/temperature", "sensors/a/b/temperature", false},
+		{"rooms/#", "rooms", true},
+		{"rooms/#", "rooms/a", true},
+		{"rooms/#", "rooms/a/b/c", true},
+		{"rooms/#", "roomsx/a", false},
+		{"#", "anything/at/all", true},
+		{"+", "a", true},
+		{"+", "a/b", false},
+		{"a/b", "a/b", true},
+		{"a/b", "a/b/c", false},
+	}
+
+	for _, test := range tests {
+		if matchPattern(test.pattern, test.name) != test.match {
+			t.Errorf("matchPattern(%q, %q) != %v", test.pattern, test.name, test.match)
+		}
+	}
+}
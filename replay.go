@@ -0,0 +1,97 @@
+package pubsubsse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultReplayBufferSize is the number of updates a topic keeps
+// to re-deliver them to clients which reconnect with a Last-Event-ID.
+const DefaultReplayBufferSize = 100
+
+// MaxCursorEntries is the maximum number of topics in a Last-Event-ID or poll cursor.
+// Longer cursors are rejected.
+const MaxCursorEntries = 1000
+
+// cursorPos is the position of a client in a topic: the last delivered sequence number
+// and the epoch of the topic it belongs to. The epoch is a nonce which is created with the topic,
+// so sequence numbers of a removed and re-created topic or of another instance are not mixed up.
+type cursorPos struct {
+	epoch string
+	seq   uint64
+}
+
+// message is a single frame queued for the event stream of a client.
+type message struct {
+	topic string    // name of the topic for updates, empty for sys messages
+	seq   uint64    // sequence number of the update in its topic, 0 if it is not replayable
+	epoch string    // epoch of the topic the sequence number belongs to
+	data  string    // JSON encoded eventData
+	time  time.Time // time the message was created
+	event string    // SSE event name of the update in the named events wire format
+
+	payload json.RawMessage // JSON encoded data of the update
+	ctx     context.Context // trace context of the update, nil if it is not traced
+}
+
+// retainedCopy returns a copy of the update which is sent outside of the
+// regular stream order, e.g. the retained value on subscribe.
+// It has no sequence number, so it is neither deduplicated nor moves the cursor.
+func (m *message) retainedCopy() *message {
+	return &message{
+		topic:   m.topic,
+		data:    m.data,
+		time:    m.time,
+		event:   m.event,
+		payload: m.payload,
+	}
+}
+
+// encodeCursor encodes the epoch and the last delivered sequence number of every topic
+// into the id field of an SSE frame. E.g. "server%2Fstatus=1f0c2a9b.12&test=7d3e01aa.3".
+func encodeCursor(cursor map[string]cursorPos) string {
+	values := url.Values{}
+	for topic, pos := range cursor {
+		values.Set(topic, pos.epoch+"."+strconv.FormatUint(pos.seq, 10))
+	}
+	return values.Encode()
+}
+
+// decodeCursor decodes the Last-Event-ID sent by the browser on reconnect.
+// Entries without an epoch are decoded with an empty epoch, so they never match a topic.
+func decodeCursor(id string) (map[string]cursorPos, error) {
+	values, err := url.ParseQuery(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event id %q: %s", id, err)
+	}
+	if len(values) > MaxCursorEntries {
+		return nil, fmt.Errorf("invalid event id: more than %d topics", MaxCursorEntries)
+	}
+
+	cursor := make(map[string]cursorPos)
+	for topic := range values {
+		epoch, seqStr, ok := strings.Cut(values.Get(topic), ".")
+		if !ok {
+			epoch, seqStr = "", epoch
+		}
+		seq, err := strconv.ParseUint(seqStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event id %q: %s", id, err)
+		}
+		cursor[topic] = cursorPos{epoch: epoch, seq: seq}
+	}
+	return cursor, nil
+}
+
+// sortMessages sorts messages of different topics by the time they were published.
+func sortMessages(msgs []*message) {
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].time.Before(msgs[j].time)
+	})
+}
@@ -0,0 +1,306 @@
+package pubsubsse
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests for:
+// +Resume(ctx Context, lastEventID string, onEvent OnEventFunc): error
+// +SetReplayBufferSize(n int)
+// -encodeCursor(cursor map[string]cursorPos): string
+// -decodeCursor(id string): map[string]cursorPos, error
+
+// Start the client with Resume and collect all frames
+func resumeClient(client *Client, lastEventID string) (frames chan string, cancel func()) {
+	frames = make(chan string, 100)
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		client.Resume(ctx, lastEventID, func(msg string) { frames <- msg })
+		close(done)
+	}()
+
+	// Wait for the init message
+	for client.GetStatus() != Receving {
+		time.Sleep(time.Millisecond)
+	}
+
+	return frames, func() {
+		cancelCtx()
+		<-done
+	}
+}
+
+// Split an SSE frame into its id and data
+func parseFrame(t *testing.T, frame string) (string, eventData) {
+	var id string
+	var data eventData
+	for _, line := range strings.Split(frame, "\n") {
+		if strings.HasPrefix(line, "id: ") {
+			id = strings.TrimPrefix(line, "id: ")
+		}
+		if strings.HasPrefix(line, "data: ") {
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	return id, data
+}
+
+// Read frames until the update is received and return the id of its frame
+func waitForUpdate(t *testing.T, frames chan string, value string) string {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case frame := <-frames:
+			id, data := parseFrame(t, frame)
+			for _, u := range data.Updates {
+				if u.Data == value {
+					return id
+				}
+			}
+		case <-timeout:
+			t.Fatalf("Update %s not received", value)
+		}
+	}
+}
+
+// Read all updates of the frames which are already available
+func collectUpdates(t *testing.T, frames chan string) []string {
+	values := []string{}
+	for {
+		select {
+		case frame := <-frames:
+			_, data := parseFrame(t, frame)
+			for _, u := range data.Updates {
+				values = append(values, u.Data.(string))
+			}
+		case <-time.After(50 * time.Millisecond):
+			return values
+		}
+	}
+}
+
+// TestCursor tests encodeCursor() and decodeCursor().
+func TestCursor(t *testing.T) {
+	cursor := map[string]cursorPos{"server/status": {epoch: "a1", seq: 12}, "test": {epoch: "b2", seq: 3}}
+	id := encodeCursor(cursor)
+	if strings.ContainsAny(id, "\n\r") {
+		t.Error("Expected id without line breaks")
+	}
+
+	decoded, err := decodeCursor(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || decoded["server/status"] != cursor["server/status"] || decoded["test"] != cursor["test"] {
+		t.Errorf("Unexpected cursor %v", decoded)
+	}
+
+	if _, err := decodeCursor("test=abc"); err == nil {
+		t.Error("Expected error for invalid id")
+	}
+
+	// Entries without epoch are decoded with an empty epoch
+	if decoded, err := decodeCursor("test=3"); err != nil || decoded["test"] != (cursorPos{seq: 3}) {
+		t.Errorf("Unexpected cursor %v %v", decoded, err)
+	}
+
+	// Too many entries
+	values := url.Values{}
+	for i := 0; i <= MaxCursorEntries; i++ {
+		values.Set(strconv.Itoa(i), "a1.1")
+	}
+	if _, err := decodeCursor(values.Encode()); err == nil {
+		t.Error("Expected error for too many entries")
+	}
+}
+
+// TestClient_Resume_Epoch tests that cursor entries of another epoch or of topics which are not received are ignored.
+func TestClient_Resume_Epoch(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	topic := ssePubSub.NewPublicTopic("news")
+	other := ssePubSub.NewPublicTopic("other")
+	client.Sub(topic)
+	topic.Pub("1")
+	topic.Pub("2")
+
+	// The entry of another epoch (e.g. of a removed topic with the same name) is ignored,
+	// the client continues at its own position
+	frames, cancel := resumeClient(client, "news=00000000.2&other="+other.epoch+".0&unknown=x1.0")
+	topic.Pub("3")
+	values := collectUpdates(t, frames)
+	cancel()
+	if strings.Join(values, ",") != "1,2,3" {
+		t.Errorf("Expected updates 1,2,3, got %v", values)
+	}
+
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	if _, ok := client.cursor["other"]; ok {
+		t.Error("Expected entry of a topic which is not received to be ignored")
+	}
+	if _, ok := client.cursor["unknown"]; ok {
+		t.Error("Expected entry of an unknown topic to be ignored")
+	}
+}
+
+// TestClient_Resume tests that missed updates are re-delivered on reconnect.
+func TestClient_Resume(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	topic := ssePubSub.NewPublicTopic("server/status")
+	other := ssePubSub.NewPublicTopic("other")
+	if err := client.Sub(topic); err != nil {
+		t.Fatal(err)
+	}
+
+	// First connection
+	frames, cancel := resumeClient(client, "")
+	topic.Pub("1")
+	lastEventID := waitForUpdate(t, frames, "1")
+	cancel()
+	if lastEventID == "" {
+		t.Fatal("Expected update frame with id")
+	}
+
+	// Published while the client is disconnected
+	topic.Pub("2")
+	topic.Pub("3")
+	other.Pub("other")
+
+	// Reconnect with the Last-Event-ID
+	frames, cancel = resumeClient(client, lastEventID)
+	defer cancel()
+	topic.Pub("4")
+
+	values := collectUpdates(t, frames)
+	if strings.Join(values, ",") != "2,3,4" {
+		t.Errorf("Expected updates 2,3,4 got %v", values)
+	}
+}
+
+// TestClient_Resume_Subtopics tests that updates of subtopics and pattern matches without a position
+// are re-delivered since the client disconnected.
+func TestClient_Resume_Subtopics(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	rooms := ssePubSub.NewPublicTopic("rooms")
+	kitchen := ssePubSub.NewPublicTopic("rooms/kitchen")
+	client.Sub(rooms)
+	client.SubPattern("sensors/#")
+
+	frames, cancel := resumeClient(client, "")
+	rooms.Pub("1")
+	lastEventID := waitForUpdate(t, frames, "1")
+	cancel()
+	for client.GetStatus() != Waiting {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Topics created and published while the client is disconnected
+	time.Sleep(time.Millisecond)
+	kitchen.Pub("2")
+	ssePubSub.NewPublicTopic("rooms/bath").Pub("3")
+	ssePubSub.NewPublicTopic("sensors/temperature").Pub("4")
+
+	frames, cancel = resumeClient(client, lastEventID)
+	defer cancel()
+	values := collectUpdates(t, frames)
+	if strings.Join(values, ",") != "2,3,4" {
+		t.Errorf("Expected updates 2,3,4 got %v", values)
+	}
+}
+
+// TestClient_Resume_KeepsQueue tests that messages queued before a reconnect are not discarded.
+func TestClient_Resume_KeepsQueue(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	topic := ssePubSub.NewPublicTopic("news")
+	client.Sub(topic)
+
+	// The stream ended before the queued messages were written
+	setReceiving(client)
+	lastEventID := "news=" + topic.epoch + ".0"
+	topic.Pub("1")
+	client.send(eventData{Sys: []eventDataSys{{Type: "custom"}}})
+	client.stop()
+
+	frames, cancel := resumeClient(client, lastEventID)
+	defer cancel()
+
+	updates, custom := []string{}, 0
+	timeout := time.After(100 * time.Millisecond)
+	for done := false; !done; {
+		select {
+		case frame := <-frames:
+			_, data := parseFrame(t, frame)
+			for _, u := range data.Updates {
+				updates = append(updates, u.Data.(string))
+			}
+			for _, sys := range data.Sys {
+				if sys.Type == "custom" {
+					custom++
+				}
+			}
+		case <-timeout:
+			done = true
+		}
+	}
+	if strings.Join(updates, ",") != "1" {
+		t.Errorf("Expected update 1 once, got %v", updates)
+	}
+	if custom != 1 {
+		t.Errorf("Expected the queued sys message, got %d", custom)
+	}
+}
+
+// TestClient_Start_NoReplay tests that a new connection without Last-Event-ID gets no replay.
+func TestClient_Start_NoReplay(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	topic := ssePubSub.NewPublicTopic("test")
+	if err := client.Sub(topic); err != nil {
+		t.Fatal(err)
+	}
+	topic.Pub("1")
+
+	frames, cancel := resumeClient(client, "")
+	defer cancel()
+
+	if values := collectUpdates(t, frames); len(values) != 0 {
+		t.Errorf("Expected no updates got %v", values)
+	}
+}
+
+// TestTopic_SetReplayBufferSize tests that the replay buffer is bounded.
+func TestTopic_SetReplayBufferSize(t *testing.T) {
+	topic := newTopic("test", TPublic)
+	if topic.GetReplayBufferSize() != DefaultReplayBufferSize {
+		t.Error("Expected default replay buffer size")
+	}
+
+	topic.SetReplayBufferSize(2)
+	topic.Pub("1")
+	topic.Pub("2")
+	topic.Pub("3")
+
+	history := topic.getHistorySince(0)
+	if len(history) != 2 || history[0].seq != 2 || history[1].seq != 3 {
+		t.Errorf("Expected updates 2 and 3 in replay buffer")
+	}
+
+	topic.SetReplayBufferSize(0)
+	topic.Pub("4")
+	if len(topic.getHistorySince(0)) != 0 {
+		t.Error("Expected empty replay buffer")
+	}
+}
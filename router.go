@@ -0,0 +1,140 @@
+package pubsubsse
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Max size of a JSON request body
+const maxRequestBodySize = 1 << 20
+
+// HandlerOptions configures the handler returned by Handler.
+type HandlerOptions struct {
+	// Prefix the handler is mounted under, e.g. "/pubsub".
+	// It is stripped from the path if present, so the handler works
+	// with routers which pass the full path (e.g. chi Mount, gorilla PathPrefix, ServeMux)
+	// and with http.StripPrefix.
+	Prefix string
+}
+
+// A route of the handler
+type route struct {
+	method string
+	path   string
+	handle func(s *SSEPubSubService, w http.ResponseWriter, r *http.Request)
+}
+
+// Routes of the handler. The parameters are read from the query
+// and, for POST and DELETE, from a JSON body.
+var routes = []route{
+	{http.MethodPost, "/clients", AddClient},
+	{http.MethodDelete, "/clients", RemoveClient},
+	{http.MethodPost, "/topics/public", AddPublicTopic},
+	{http.MethodDelete, "/topics/public", RemovePublicTopic},
+	{http.MethodPost, "/topics/private", AddPrivateTopic},
+	{http.MethodDelete, "/topics/private", RemovePrivateTopic},
+	{http.MethodPost, "/subscriptions", Subscribe},
+	{http.MethodDelete, "/subscriptions", Unsubscribe},
+	{http.MethodGet, "/events", Event},
+	{http.MethodGet, "/ws", WebSocket},
+	{http.MethodGet, "/poll", LongPoll},
+	{http.MethodGet, "/metrics", Metrics},
+}
+
+// Handler returns a single http.Handler with all endpoints of the service:
+//
+//	POST   {prefix}/clients                                 create a client
+//	DELETE {prefix}/clients         {"client_id"}           remove a client
+//	POST   {prefix}/topics/public   {"topic"}               create a public topic
+//	DELETE {prefix}/topics/public   {"topic"}               remove a public topic
+//	POST   {prefix}/topics/private  {"client_id", "topic"}  create a private topic
+//	DELETE {prefix}/topics/private  {"client_id", "topic"}  remove a private topic
+//	POST   {prefix}/subscriptions   {"client_id", "topic"}  subscribe a topic or pattern
+//	DELETE {prefix}/subscriptions   {"client_id", "topic"}  unsubscribe a topic or pattern
+//	GET    {prefix}/events?client_id=                       SSE stream
+//	GET    {prefix}/ws?client_id=                           WebSocket
+//	GET    {prefix}/poll?client_id=                         long-polling
+//	GET    {prefix}/metrics                                 metrics in the Prometheus text format
+//
+// The parameters can be sent as JSON body or as query parameters.
+func (s *SSEPubSubService) Handler(opts HandlerOptions) http.Handler {
+	prefix := strings.TrimSuffix(opts.Prefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Strip the prefix if the router did not
+		path := r.URL.Path
+		if prefix != "" && (path == prefix || strings.HasPrefix(path, prefix+"/")) {
+			path = strings.TrimPrefix(path, prefix)
+		}
+		if path != "/" {
+			path = strings.TrimSuffix(path, "/")
+		}
+
+		// Find the route
+		allowed := []string{}
+		for _, rt := range routes {
+			if rt.path != path {
+				continue
+			}
+			if rt.method != r.Method {
+				allowed = append(allowed, rt.method)
+				continue
+			}
+
+			r, err := mergeJSONBody(r)
+			if err != nil {
+				writeError(s, w, detailError(ErrInvalidRequest, "invalid request body"))
+				return
+			}
+			rt.handle(s, w, r)
+			return
+		}
+
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			writeError(s, w, errMethodNotAllowed)
+			return
+		}
+		writeError(s, w, errRouteNotFound)
+	})
+}
+
+// Merge the parameters of a JSON body into the query of the request.
+// The values of the body take precedence. Requests without a JSON body are returned as they are.
+func mergeJSONBody(r *http.Request) (*http.Request, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return r, nil
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "application/json") {
+		return r, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxRequestBodySize {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return r, nil
+	}
+
+	params := map[string]string{}
+	if err := json.Unmarshal(body, &params); err != nil {
+		return nil, err
+	}
+
+	r = r.Clone(r.Context())
+	query := r.URL.Query()
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	r.URL.RawQuery = query.Encode()
+	return r, nil
+}
@@ -0,0 +1,140 @@
+package pubsubsse
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Tests for:
+// +Handler(opts HandlerOptions): Handler
+
+// Send a request to the server and decode the JSON response
+func doJSON(t *testing.T, method, url, body string) (int, apiResponse, http.Header) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var data apiResponse
+	json.NewDecoder(resp.Body).Decode(&data)
+	return resp.StatusCode, data, resp.Header
+}
+
+func TestSSEPubSubService_Handler(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+
+	// Mounted under a prefix with the full path
+	mux := http.NewServeMux()
+	mux.Handle("/pubsub/", ssePubSub.Handler(HandlerOptions{Prefix: "/pubsub/"}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	url := server.URL + "/pubsub"
+
+	code, data, _ := doJSON(t, http.MethodPost, url+"/clients", "")
+	if code != http.StatusOK || data.ClientID == "" {
+		t.Fatalf("Expected client, got %d %v", code, data)
+	}
+	clientID := data.ClientID
+
+	code, data, _ = doJSON(t, http.MethodPost, url+"/topics/public", `{"topic":"news"}`)
+	if code != http.StatusOK || data.TopicName != "news" {
+		t.Fatalf("Expected public topic, got %d %v", code, data)
+	}
+
+	code, data, _ = doJSON(t, http.MethodPost, url+"/topics/private", `{"client_id":"`+clientID+`","topic":"private"}`)
+	if code != http.StatusOK || data.TopicName != "private" {
+		t.Fatalf("Expected private topic, got %d %v", code, data)
+	}
+
+	// JSON body
+	code, _, _ = doJSON(t, http.MethodPost, url+"/subscriptions", `{"client_id":"`+clientID+`","topic":"news"}`)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	client, _ := ssePubSub.GetClientByID(clientID)
+	if _, ok := client.GetSubscribedTopics()["news"]; !ok {
+		t.Error("Expected client to be subscribed")
+	}
+
+	// Query parameters
+	code, _, _ = doJSON(t, http.MethodDelete, url+"/subscriptions?client_id="+clientID+"&topic=news", "")
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if _, ok := client.GetSubscribedTopics()["news"]; ok {
+		t.Error("Expected client to be unsubscribed")
+	}
+
+	// Errors
+	code, data, header := doJSON(t, http.MethodGet, url+"/subscriptions", "")
+	if code != http.StatusMethodNotAllowed || header.Get("Allow") != "POST, DELETE" || data.OK || data.errorCode() != CodeMethodNotAllowed {
+		t.Errorf("Expected 405, got %d %v %s", code, data, header.Get("Allow"))
+	}
+	if code, _, _ := doJSON(t, http.MethodGet, url+"/unknown", ""); code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", code)
+	}
+	if code, data, _ := doJSON(t, http.MethodPost, url+"/subscriptions", `{"topic":1}`); code != http.StatusBadRequest || data.errorCode() != CodeInvalidRequest {
+		t.Errorf("Expected 400 for invalid body, got %d %v", code, data)
+	}
+	if code, data, _ := doJSON(t, http.MethodPost, url+"/subscriptions", `{"client_id":"unknown"}`); code != http.StatusNotFound || data.errorCode() != CodeClientNotFound {
+		t.Errorf("Expected 404 for unknown client, got %d %v", code, data)
+	}
+
+	// Remove
+	code, data, _ = doJSON(t, http.MethodDelete, url+"/topics/private", `{"client_id":"`+clientID+`","topic":"private"}`)
+	if code != http.StatusOK || data.TopicName != "private" || len(client.GetPrivateTopics()) != 0 {
+		t.Errorf("Expected private topic to be removed, got %d %v", code, data)
+	}
+	code, data, _ = doJSON(t, http.MethodDelete, url+"/topics/private", `{"client_id":"`+clientID+`","topic":"private"}`)
+	if code != http.StatusNotFound || data.errorCode() != CodeTopicNotFound {
+		t.Errorf("Expected 404 for removed private topic, got %d %v", code, data)
+	}
+
+	code, data, _ = doJSON(t, http.MethodDelete, url+"/topics/public", `{"topic":"/news/"}`)
+	if code != http.StatusOK || data.TopicName != "news" || len(ssePubSub.GetPublicTopics()) != 0 {
+		t.Errorf("Expected public topic to be removed, got %d %v", code, data)
+	}
+	code, data, _ = doJSON(t, http.MethodDelete, url+"/topics/public", `{"topic":"news"}`)
+	if code != http.StatusNotFound || data.errorCode() != CodeTopicNotFound {
+		t.Errorf("Expected 404 for removed public topic, got %d %v", code, data)
+	}
+
+	code, _, _ = doJSON(t, http.MethodDelete, url+"/clients", `{"client_id":"`+clientID+`"}`)
+	if _, ok := ssePubSub.GetClientByID(clientID); code != http.StatusOK || ok {
+		t.Errorf("Expected client to be removed, got %d", code)
+	}
+	code, data, _ = doJSON(t, http.MethodDelete, url+"/clients", `{"client_id":"`+clientID+`"}`)
+	if code != http.StatusNotFound || data.errorCode() != CodeClientNotFound {
+		t.Errorf("Expected 404 for removed client, got %d %v", code, data)
+	}
+}
+
+func TestSSEPubSubService_Handler_StripPrefix(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	handler := http.StripPrefix("/api", ssePubSub.Handler(HandlerOptions{Prefix: "/api"}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/clients/", nil))
+	if w.Code != http.StatusOK || len(ssePubSub.GetClients()) != 1 {
+		t.Errorf("Expected client to be created, got %d %s", w.Code, w.Body)
+	}
+
+	// Without prefix
+	w = httptest.NewRecorder()
+	ssePubSub.Handler(HandlerOptions{}).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/clients", nil))
+	if w.Code != http.StatusOK || len(ssePubSub.GetClients()) != 2 {
+		t.Errorf("Expected client to be created, got %d %s", w.Code, w.Body)
+	}
+}
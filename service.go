@@ -1,9 +1,10 @@
 package pubsubsse
 
 import (
+	"fmt"
 	"sync"
+	"time"
 
-	"github.com/apex/log"
 	"github.com/google/uuid"
 )
 
@@ -15,10 +16,66 @@ type SSEPubSubService struct {
 	publicTopics map[string]*Topic
 	groups       map[string]*Group
 
+	defaultStreamOptions StreamOptions
+
+	// Backplane to share topics with other instances
+	nodeID    string
+	backplane Backplane
+
+	// Authorizer of the HTTP handlers
+	authorizer Authorizer
+
+	// If a new event stream of a client takes over its current stream
+	takeover bool
+
+	// Origins which may open a WebSocket besides the own one
+	webSocketOrigins []string
+
+	// Idle TTL of clients and the janitor removing expired clients
+	clientTTL   time.Duration
+	janitorStop chan struct{}
+	janitorDone chan struct{}
+
+	// Heartbeat of the event streams
+	heartbeat HeartbeatOptions
+
+	// Wire format of the event streams and the reconnection time sent to the browser
+	wireFormat WireFormat
+	retry      time.Duration
+
+	// Codec of the published messages
+	codec Codec
+
+	// Rules of valid topic names
+	topicRules TopicRules
+
+	// Logger and if the payloads are logged. They have their own lock, so they can be used while lock is held.
+	logger      Logger
+	logPayloads bool
+	logLock     sync.RWMutex
+
+	// Counters and histograms of the metrics
+	metrics *metrics
+
+	// Clients with pattern subscriptions. They have their own lock, because they are read on every publish.
+	patternClients map[string]*Client
+	patternLock    sync.RWMutex
+
+	// Tracer of the publish-to-delivery path. It has its own lock, because it is read on every publish and delivery.
+	tracer     Tracer
+	tracerLock sync.RWMutex
+
 	lock sync.Mutex
 
-	// Events:
-	eventsOnNewClient map[string]funcClient
+	// Handlers of the lifecycle events
+	events serviceEvents
+
+	// Shutdown: if the service is shut down, the running event streams and long-polls
+	// and the channel which is closed when the last of them ended
+	shutdownOptions ShutdownOptions
+	closed          bool
+	streams         int
+	streamsDone     chan struct{}
 }
 
 // NewSSEPubSub creates a new sSEPubSubService instance.
@@ -28,90 +85,142 @@ func NewSSEPubSubService() *SSEPubSubService {
 		publicTopics: make(map[string]*Topic),
 		groups:       make(map[string]*Group),
 
-		lock: sync.Mutex{},
+		patternClients: make(map[string]*Client),
 
-		eventsOnNewClient: make(map[string]funcClient),
-	}
-}
+		defaultStreamOptions: DefaultStreamOptions(),
+		codec:                JSONCodec{},
+		topicRules:           DefaultTopicRules(),
+		metrics:              newMetrics(),
+		shutdownOptions:      DefaultShutdownOptions(),
 
-// Create new client
-func (s *SSEPubSubService) NewClient() *Client {
-	// Lock the sSEPubSubService
-	s.lock.Lock()
-
-	c := newClient(s)
-	s.clients[c.GetID()] = c
-	s.lock.Unlock()
-
-	// Emit event
-	s.emitOnNewClient(c)
+		nodeID: uuid.New().String(),
 
-	return c
+		lock: sync.Mutex{},
+	}
 }
 
-// Event: When client is created
-func (s *SSEPubSubService) OnNewClient(f funcClient) string {
-	// Lock the sSEPubSubService
+// Get the stream options new clients get by default
+func (s *SSEPubSubService) GetDefaultStreamOptions() StreamOptions {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	id := uuid.New().String()
-
-	// Add f to eventsOnNewClient map
-	s.eventsOnNewClient[id] = f
-	return id
+	return s.defaultStreamOptions
 }
 
-// Emit Event: When client is created
-func (s *SSEPubSubService) emitOnNewClient(c *Client) {
-	// Lock the sSEPubSubService
+// Set the stream options new clients get by default.
+// Existing clients keep their options. Use client.SetStreamOptions to change them.
+func (s *SSEPubSubService) SetDefaultStreamOptions(o StreamOptions) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	// Emit event
-	for _, f := range s.eventsOnNewClient {
-		go f(c)
+	s.defaultStreamOptions = o.normalize()
+}
+
+// Create new client
+// If the service is shut down, a closed client is returned: it is not added to the service and
+// its event streams and long-polls are refused with ErrServiceClosed. Use CreateClient to get the error.
+func (s *SSEPubSubService) NewClient() *Client {
+	c, err := s.CreateClient()
+	if err != nil {
+		s.GetLogger().Warn("Error creating client", logKeyError, err)
+		return newClient(s, uuid.New().String())
 	}
+	return c
 }
 
-// Remove Event: When client is created
-func (s *SSEPubSubService) RemoveOnNewClient(id string) {
+// Create new client
+// 0. Check if the service is shut down, return ErrServiceClosed if it is
+// 1. Create a new client
+// 2. Add the client to the sSEPubSubService
+// 3. Emit OnNewClient
+func (s *SSEPubSubService) CreateClient() (*Client, error) {
+	return s.createClient(uuid.New().String())
+}
+
+// Create new client with the ID. If a client with the ID exists, it is returned.
+func (s *SSEPubSubService) createClient(id string) (*Client, error) {
+	c := newClient(s, id)
+
 	// Lock the sSEPubSubService
 	s.lock.Lock()
-	defer s.lock.Unlock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil, ErrServiceClosed
+	}
+	if existing, ok := s.clients[id]; ok {
+		s.lock.Unlock()
+		return existing, nil
+	}
+	s.clients[id] = c
+	s.lock.Unlock()
+
+	// Emit event
+	s.emitOnNewClient(c)
 
-	// Remove f from eventsOnNewClient map
-	delete(s.eventsOnNewClient, id)
+	return c, nil
 }
 
 // Remove client
-// 1. Unsubscribe from all topics
-// 2. Remove all private topics
-// 3. Stop the client
-// 4. Remove client from sSEPubSubService
-func (s *SSEPubSubService) RemoveClient(c *Client) {
+// 1. Remove client from sSEPubSubService
+// 2. Unsubscribe from all topics
+// 3. Remove client from all groups
+// 4. Remove all private topics
+// 5. Stop the client
+//
+// ErrClientNotFound is returned if the client does not exist in the service.
+func (s *SSEPubSubService) RemoveClient(c *Client) error {
+	return s.removeClient(c, 0)
+}
+
+// Remove client like RemoveClient. With a ttl > 0 the client is only removed if it is idle for longer than the ttl,
+// otherwise errClientNotIdle is returned. The idle time is checked under the lock of the service,
+// so a client which starts receiving in the meantime is kept or can not start anymore (see addStream).
+func (s *SSEPubSubService) removeClient(c *Client, ttl time.Duration) error {
+	id := c.GetID()
+
+	// Remove client from sSEPubSubService
+	s.lock.Lock()
+	if client, ok := s.clients[id]; !ok || client != c {
+		s.lock.Unlock()
+		return fmt.Errorf("%w: client %s does not exist", ErrClientNotFound, id)
+	}
+	if ttl > 0 && c.GetIdleTime() <= ttl {
+		s.lock.Unlock()
+		return errClientNotIdle
+	}
+	delete(s.clients, id)
+	s.lock.Unlock()
+	s.removePatternClient(c)
+
 	// Unsubscribe from all topics
 	alltopics := c.GetAllTopics()
 	for _, t := range alltopics {
 		if err := c.Unsub(t); err != nil {
-			log.Errorf("[C:%s]: Error unsubscribing from topic %s: %s", c.GetID(), t.GetName(), err)
+			s.GetLogger().Error("Error unsubscribing from topic", logKeyClientID, c.GetID(), logKeyTopic, t.GetName(), logKeyError, err)
+		}
+	}
+
+	// Remove client from all groups
+	for _, g := range c.GetGroups() {
+		if err := g.RemoveClient(c); err != nil {
+			s.GetLogger().Error("Error removing client from group", logKeyClientID, c.GetID(), logKeyGroup, g.GetName(), logKeyError, err)
 		}
 	}
 
 	// Remove all private topics
 	for _, t := range c.GetPrivateTopics() {
-		c.RemovePrivateTopic(t)
+		if err := c.RemovePrivateTopic(t); err != nil {
+			s.GetLogger().Error("Error removing private topic", logKeyClientID, c.GetID(), logKeyTopic, t.GetName(), logKeyError, err)
+		}
 	}
 
 	// stop the client
 	c.stop()
 
-	// Lock the sSEPubSubService
-	s.lock.Lock()
-	defer s.lock.Unlock()
+	// Emit event
+	s.emitOnClientRemoved(c)
 
-	// Remove client from sSEPubSubService
-	delete(s.clients, c.GetID())
+	return nil
 }
 
 // Add Group
@@ -126,6 +235,7 @@ func (s *SSEPubSubService) NewGroup(name string) *Group {
 
 	// Create a new group
 	g := newGroup(name)
+	g.service = s
 
 	// Add the group to the sSEPubSubService
 	s.lock.Lock()
@@ -140,7 +250,9 @@ func (s *SSEPubSubService) NewGroup(name string) *Group {
 // 1. Remove all topics from the group
 // 2. Remove all clients from the group
 // 3. Remove group from sSEPubSubService
-func (s *SSEPubSubService) RemoveGroup(g *Group) {
+//
+// ErrGroupNotFound is returned if the group does not exist in the service.
+func (s *SSEPubSubService) RemoveGroup(g *Group) error {
 	// Check if group exists in sSEPubSubService
 	checkIfExist := func() bool {
 		if group, ok := s.GetGroupByName(g.GetName()); ok {
@@ -151,24 +263,29 @@ func (s *SSEPubSubService) RemoveGroup(g *Group) {
 		return false
 	}
 	if !checkIfExist() {
-		log.Errorf("Group %s does not exist in sSEPubSubService", g.GetName())
-		return
+		return fmt.Errorf("%w: group %s does not exist", ErrGroupNotFound, g.GetName())
 	}
 
 	// Remove all topics from the group
 	for _, t := range g.GetTopics() {
-		g.RemoveTopic(t)
+		if err := g.RemoveTopic(t); err != nil {
+			s.GetLogger().Error("Error removing topic from group", logKeyGroup, g.GetName(), logKeyTopic, t.GetName(), logKeyError, err)
+		}
 	}
 
 	// Remove all clients from the group
 	for _, c := range g.GetClients() {
-		g.RemoveClient(c)
+		if err := g.RemoveClient(c); err != nil {
+			s.GetLogger().Error("Error removing client from group", logKeyClientID, c.GetID(), logKeyGroup, g.GetName(), logKeyError, err)
+		}
 	}
 
 	// Remove group from sSEPubSubService
 	s.lock.Lock()
 	delete(s.groups, g.GetName())
 	s.lock.Unlock()
+
+	return nil
 }
 
 // Get groups
@@ -218,18 +335,45 @@ func (s *SSEPubSubService) GetClientByID(id string) (*Client, bool) {
 }
 
 // Create new public topic
-// 0. Check if topic already exists, return it if it does
-// 1. Create a new public topic
-// 2. Add the topic to the sSEPubSubService
-// 3. Inform all clients about the new topic
+// It returns nil if the name is invalid. Use CreatePublicTopic to get the error.
 func (s *SSEPubSubService) NewPublicTopic(name string) *Topic {
+	t, err := s.CreatePublicTopic(name)
+	if err != nil {
+		s.GetLogger().Error("Error creating public topic", logKeyTopic, name, logKeyError, err)
+	}
+	return t
+}
+
+// Create new public topic
+// 0. Canonicalize the name, return an error wrapping ErrInvalidTopic if it is invalid
+// 1. Check if topic already exists, return it if it does
+// 2. Create a new public topic
+// 3. Add the topic to the sSEPubSubService
+// 4. Inform all clients about the new topic
+// 5. Inform the other instances about the new topic
+func (s *SSEPubSubService) CreatePublicTopic(name string) (*Topic, error) {
+	name, err := canonicalTopicName(s, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.newPublicTopic(name, nil), nil
+}
+
+// Create new public topic.
+// remote are the options of a topic of another instance. Without them the topic is created
+// by this instance and the other instances are informed over the backplane.
+func (s *SSEPubSubService) newPublicTopic(name string, remote *BackplaneTopicOptions) *Topic {
 	// Check if topic already exists, return it if it does
-	if t, ok := s.GetPublicTopicByName(name); ok {
+	if t, ok := s.publicTopicByName(name); ok {
 		return t
 	}
 
 	// Create a new public topic
 	t := newTopic(name, TPublic)
+	t.setScope(s)
+	if remote != nil {
+		t.setBackplaneOptions(remote)
+	}
 	s.lock.Lock()
 	s.publicTopics[t.GetName()] = t
 	s.lock.Unlock()
@@ -237,10 +381,18 @@ func (s *SSEPubSubService) NewPublicTopic(name string) *Topic {
 	// Inform all clients about the new topic
 	for _, c := range s.GetClients() {
 		if err := c.sendTopicList(); err != nil {
-			log.Errorf("[C:%s]: Error sending new topic to client: %s", c.id, err)
+			s.GetLogger().Error("Error sending new topic to client", logKeyClientID, c.id, logKeyError, err)
 		}
 	}
 
+	// Inform the other instances about the new topic
+	if remote == nil {
+		s.publishBackplane(&BackplaneMessage{Event: BackplaneTopicCreated, TopicType: string(TPublic), Topic: t.GetName(), Options: t.backplaneOptions()})
+	}
+
+	// Emit event
+	s.emitOnTopicCreated(t)
+
 	return t
 }
 
@@ -250,11 +402,18 @@ func (s *SSEPubSubService) NewPublicTopic(name string) *Topic {
 // 2. Check if topic exists in sSEPubSubService
 // 3. Remove topic from sSEPubSubService
 // 4. Inform all clients about the removed topic by sending the new topic list
-func (s *SSEPubSubService) RemovePublicTopic(t *Topic) {
+// 5. Inform the other instances about the removed topic
+//
+// ErrTopicNotFound is returned if the topic is not a public topic of the service.
+func (s *SSEPubSubService) RemovePublicTopic(t *Topic) error {
+	return s.removePublicTopic(t, true)
+}
+
+// Remove public topic and inform the other instances over the backplane if propagate is true
+func (s *SSEPubSubService) removePublicTopic(t *Topic, propagate bool) error {
 	// Check if topic is public
 	if t.GetType() != string(TPublic) {
-		log.Errorf("Topic %s is not public", t.GetName())
-		return
+		return fmt.Errorf("%w: topic %s is not public", ErrTopicNotFound, t.GetName())
 	}
 
 	// Check if topic exists in sSEPubSubService
@@ -267,14 +426,13 @@ func (s *SSEPubSubService) RemovePublicTopic(t *Topic) {
 		return false
 	}
 	if !checkIfExist() {
-		log.Errorf("Topic %s does not exist in sSEPubSubService", t.GetName())
-		return
+		return fmt.Errorf("%w: topic %s does not exist", ErrTopicNotFound, t.GetName())
 	}
 
 	// Remove this topic from all clients
 	for _, c := range t.GetClients() {
 		if err := c.Unsub(t); err != nil {
-			log.Errorf("[C:%s]: Error unsubscribing from topic %s: %s", c.GetID(), t.GetName(), err)
+			s.GetLogger().Error("Error unsubscribing from topic", logKeyClientID, c.GetID(), logKeyTopic, t.GetName(), logKeyError, err)
 		}
 	}
 
@@ -286,9 +444,19 @@ func (s *SSEPubSubService) RemovePublicTopic(t *Topic) {
 	// Inform all clients about the removed topic by sending the new topic list
 	for _, c := range s.GetClients() {
 		if err := c.sendTopicList(); err != nil {
-			log.Errorf("[C:%s]: Error sending new topic to client: %s", c.id, err)
+			s.GetLogger().Error("Error sending new topic to client", logKeyClientID, c.id, logKeyError, err)
 		}
 	}
+
+	// Inform the other instances about the removed topic
+	if propagate {
+		s.publishBackplane(&BackplaneMessage{Event: BackplaneTopicRemoved, TopicType: string(TPublic), Topic: t.GetName()})
+	}
+
+	// Emit event
+	s.emitOnTopicRemoved(t)
+
+	return nil
 }
 
 // Get public topics
@@ -305,11 +473,42 @@ func (s *SSEPubSubService) GetPublicTopics() map[string]*Topic {
 	return newmap
 }
 
-// Get public topic by name
+// Get public topic by name. The name is canonicalized, so "/news/" finds "news".
 func (s *SSEPubSubService) GetPublicTopicByName(name string) (*Topic, bool) {
+	return s.publicTopicByName(lookupTopicName(s, name))
+}
+
+// Get public topic by its canonical name
+func (s *SSEPubSubService) publicTopicByName(name string) (*Topic, bool) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
 	t, ok := s.publicTopics[name]
 	return t, ok
 }
+
+// Resolve a public topic by name for the subscription hierarchy
+func (s *SSEPubSubService) scopeTopicByName(name string) (*Topic, bool) {
+	return s.publicTopicByName(name)
+}
+
+// Get all public topics for the subscription hierarchy
+func (s *SSEPubSubService) scopeTopics() map[string]*Topic {
+	return s.GetPublicTopics()
+}
+
+// Public topics belong to the sSEPubSubService
+func (s *SSEPubSubService) scopeService() *SSEPubSubService {
+	return s
+}
+
+// All clients can see public topics
+func (s *SSEPubSubService) scopeClients() map[string]*Client {
+	return s.GetClients()
+}
+
+// Check if the client belongs to the sSEPubSubService
+func (s *SSEPubSubService) scopeHasClient(c *Client) bool {
+	client, ok := s.GetClientByID(c.GetID())
+	return ok && client == c
+}
@@ -1,22 +1,23 @@
 package pubsubsse
 
 import (
+	"errors"
 	"testing"
 )
 
 // Tests for:
 // +NewClient(): *client
-// +RemoveClient(c *client)
+// +RemoveClient(c *client): error
 // +GetClients(): map[string]*client
 // +GetClientByID(id string): *client, bool
 
 // +NewGroup(name string): *group
-// +RemoveGroup(g *group)
+// +RemoveGroup(g *group): error
 // +GetGroups(): map[string]*group
 // +GetGroupByName(name string): *group, bool
 
 // +NewPublicTopic(name string): *topic
-// +RemovePublicTopic(t *topic)
+// +RemovePublicTopic(t *topic): error
 // +GetPublicTopics(): map[string]*topic
 // +GetPublicTopicByName(name string): *topic, bool
 
@@ -53,7 +54,9 @@ func TestSSEPubSubService_NewClient(t *testing.T) {
 func TestSSEPubSubService_RemoveClient(t *testing.T) {
 	ssePubSub := NewSSEPubSubService()
 	client := ssePubSub.NewClient()
-	ssePubSub.RemoveClient(client)
+	if err := ssePubSub.RemoveClient(client); err != nil {
+		t.Errorf("Client not removed: %s", err)
+	}
 	_, ok := ssePubSub.GetClientByID(client.GetID())
 	if ok {
 		t.Error("Client not removed: found")
@@ -61,6 +64,9 @@ func TestSSEPubSubService_RemoveClient(t *testing.T) {
 	if len(ssePubSub.GetClients()) != 0 {
 		t.Error("Client not removed: Multiple clients exist")
 	}
+	if err := ssePubSub.RemoveClient(client); !errors.Is(err, ErrClientNotFound) {
+		t.Errorf("Expected ErrClientNotFound, got %v", err)
+	}
 }
 
 // Create a new client and get all clients
@@ -119,7 +125,9 @@ func TestSSEPubSubService_NewGroup(t *testing.T) {
 func TestSSEPubSubService_RemoveGroup(t *testing.T) {
 	ssePubSub := NewSSEPubSubService()
 	group := ssePubSub.NewGroup("test")
-	ssePubSub.RemoveGroup(group)
+	if err := ssePubSub.RemoveGroup(group); err != nil {
+		t.Errorf("Group not removed: %s", err)
+	}
 	_, ok := ssePubSub.GetGroupByName(group.GetName())
 	if ok {
 		t.Error("Group not removed")
@@ -127,6 +135,9 @@ func TestSSEPubSubService_RemoveGroup(t *testing.T) {
 	if len(ssePubSub.GetGroups()) != 0 {
 		t.Error("Group not removed: Multiple groups exist")
 	}
+	if err := ssePubSub.RemoveGroup(group); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("Expected ErrGroupNotFound, got %v", err)
+	}
 }
 
 // Create a new group and get all groups
@@ -185,7 +196,9 @@ func TestSSEPubSubService_NewPublicTopic(t *testing.T) {
 func TestSSEPubSubService_RemovePublicTopic(t *testing.T) {
 	ssePubSub := NewSSEPubSubService()
 	topic := ssePubSub.NewPublicTopic("test")
-	ssePubSub.RemovePublicTopic(topic)
+	if err := ssePubSub.RemovePublicTopic(topic); err != nil {
+		t.Errorf("Public topic not removed: %s", err)
+	}
 	_, ok := ssePubSub.GetPublicTopicByName(topic.GetName())
 	if ok {
 		t.Error("Public topic not removed")
@@ -193,6 +206,12 @@ func TestSSEPubSubService_RemovePublicTopic(t *testing.T) {
 	if len(ssePubSub.GetPublicTopics()) != 0 {
 		t.Error("Public topic not removed: Multiple public topics exist")
 	}
+	if err := ssePubSub.RemovePublicTopic(topic); !errors.Is(err, ErrTopicNotFound) {
+		t.Errorf("Expected ErrTopicNotFound, got %v", err)
+	}
+	if err := ssePubSub.RemovePublicTopic(ssePubSub.NewClient().NewPrivateTopic("test")); !errors.Is(err, ErrTopicNotFound) {
+		t.Errorf("Expected ErrTopicNotFound for a private topic, got %v", err)
+	}
 }
 
 // Create a new public topic and get all public topics
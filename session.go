@@ -0,0 +1,96 @@
+package pubsubsse
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxClientIDLength is the maximum length of a client ID supplied by the application in characters.
+const MaxClientIDLength = 256
+
+// Create new client with an ID of the application, e.g. a user or session ID.
+// It returns nil if the ID is invalid. If the service is shut down, a closed client is returned like by NewClient.
+// Use CreateClientWithID to get the error.
+func (s *SSEPubSubService) NewClientWithID(id string) *Client {
+	c, err := s.CreateClientWithID(id)
+	if errors.Is(err, ErrServiceClosed) {
+		s.GetLogger().Warn("Error creating client", logKeyClientID, id, logKeyError, err)
+		return newClient(s, id)
+	}
+	if err != nil {
+		s.GetLogger().Error("Error creating client", logKeyClientID, id, logKeyError, err)
+	}
+	return c
+}
+
+// Create new client with an ID of the application, e.g. a user or session ID.
+// 0. Check if the ID is valid, return an error wrapping ErrInvalidClientID if it is not
+// 1. Check if the client already exists, return it if it does
+// 2. Create a new client with the ID and add it to the sSEPubSubService
+//
+// Because the existing client is returned, its subscriptions, private topics and groups
+// survive when the browser reconnects and the application creates the client again.
+// ErrServiceClosed is returned if the service is shut down.
+func (s *SSEPubSubService) CreateClientWithID(id string) (*Client, error) {
+	if err := validateClientID(id); err != nil {
+		return nil, detailError(ErrInvalidClientID, "%s", err)
+	}
+	return s.createClient(id)
+}
+
+// Check if the client ID is not empty, not too long and has no whitespace or control characters
+func validateClientID(id string) error {
+	if id == "" {
+		return fmt.Errorf("client id is empty")
+	}
+	if utf8.RuneCountInString(id) > MaxClientIDLength {
+		return fmt.Errorf("client id is longer than %d characters", MaxClientIDLength)
+	}
+	for _, r := range id {
+		if r == utf8.RuneError || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return fmt.Errorf("client id %q contains an invalid character", id)
+		}
+	}
+	return nil
+}
+
+// Get if a new event stream of a client takes over the stream the client is already receiving over
+func (s *SSEPubSubService) GetTakeover() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.takeover
+}
+
+// Set if a new event stream of a client takes over the stream the client is already receiving over.
+// The old stream ends and the new one continues the session, e.g. if the old TCP connection is dead
+// but was not closed yet. If it is false, which is the default, the new stream is refused with ErrAlreadyReceiving.
+func (s *SSEPubSubService) SetTakeover(enabled bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.takeover = enabled
+}
+
+// Check if the event stream of the generation is the current stream of the client
+func (c *Client) isStream(gen uint64) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.streamGen == gen
+}
+
+// Stop the client if the event stream of the generation is its current stream.
+// Returns false if the stream was taken over by a newer stream, which keeps running.
+func (c *Client) stopStream(gen uint64) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.streamGen != gen {
+		return false
+	}
+	c.stopLocked()
+	return true
+}
@@ -0,0 +1,191 @@
+package pubsubsse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Tests for:
+// +NewClientWithID(id string): *Client
+// +CreateClientWithID(id string): *Client, error
+// +SetTakeover(enabled bool)
+
+func TestSSEPubSubService_NewClientWithID(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("news")
+
+	client := ssePubSub.NewClientWithID("user-1")
+	if client == nil || client.GetID() != "user-1" {
+		t.Fatalf("Expected client with ID user-1, got %v", client)
+	}
+	if c, ok := ssePubSub.GetClientByID("user-1"); !ok || c != client {
+		t.Error("Expected client to be added to the service")
+	}
+	client.Sub(topic)
+	client.NewPrivateTopic("private")
+
+	// The existing client with its subscriptions and private topics is returned
+	again, err := ssePubSub.CreateClientWithID("user-1")
+	if err != nil || again != client {
+		t.Fatalf("Expected existing client, got %v %v", again, err)
+	}
+	if len(again.GetSubscribedTopics()) != 1 || len(again.GetPrivateTopics()) != 1 {
+		t.Error("Expected subscriptions and private topics to survive")
+	}
+	if len(ssePubSub.GetClients()) != 1 {
+		t.Errorf("Expected 1 client, got %d", len(ssePubSub.GetClients()))
+	}
+}
+
+func TestSSEPubSubService_CreateClientWithID_Invalid(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+
+	for _, id := range []string{"", "user 1", "user\n1", strings.Repeat("a", MaxClientIDLength+1)} {
+		if _, err := ssePubSub.CreateClientWithID(id); !errors.Is(err, ErrInvalidClientID) {
+			t.Errorf("%q: expected ErrInvalidClientID, got %v", id, err)
+		}
+	}
+	if ssePubSub.NewClientWithID("") != nil {
+		t.Error("Expected no client for an empty ID")
+	}
+	if len(ssePubSub.GetClients()) != 0 {
+		t.Error("Expected no client to be added")
+	}
+
+	ssePubSub.Shutdown(context.Background())
+	if _, err := ssePubSub.CreateClientWithID("user-1"); !errors.Is(err, ErrServiceClosed) {
+		t.Errorf("Expected ErrServiceClosed, got %v", err)
+	}
+
+	// After the shutdown a closed client is returned, which is not added to the service
+	client := ssePubSub.NewClientWithID("user-1")
+	if client == nil || client.GetID() != "user-1" {
+		t.Fatalf("Expected a closed client, got %v", client)
+	}
+	if len(ssePubSub.GetClients()) != 0 {
+		t.Error("Expected no client to be added")
+	}
+	if err := client.Start(context.Background(), func(string) {}); !errors.Is(err, ErrServiceClosed) {
+		t.Errorf("Expected ErrServiceClosed, got %v", err)
+	}
+}
+
+func TestClient_Takeover(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetEventDispatch(DispatchSync)
+	var connected, disconnected atomic.Int32
+	ssePubSub.OnClientConnected(func(c *Client) { connected.Add(1) })
+	ssePubSub.OnClientDisconnected(func(c *Client) { disconnected.Add(1) })
+
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClientWithID("user-1")
+	client.Sub(topic)
+	oldFrames := make(chan string, 100)
+	oldDone := make(chan error, 1)
+	go func() {
+		oldDone <- client.Start(context.Background(), func(msg string) { oldFrames <- msg })
+	}()
+	for client.GetStatus() != Receving {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Without takeover the second stream is refused
+	if err := client.Start(context.Background(), func(string) {}); !errors.Is(err, ErrAlreadyReceiving) {
+		t.Fatalf("Expected ErrAlreadyReceiving, got %v", err)
+	}
+
+	// With takeover the old stream ends and the new one gets the updates
+	ssePubSub.SetTakeover(true)
+	newFrames := make(chan string, 100)
+	ctx, cancelNew := context.WithCancel(context.Background())
+	newDone := make(chan struct{})
+	go func() {
+		client.Start(ctx, func(msg string) { newFrames <- msg })
+		close(newDone)
+	}()
+
+	select {
+	case err := <-oldDone:
+		if err != nil {
+			t.Errorf("Expected old stream to end without error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Old stream did not end")
+	}
+	for len(newFrames) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if client.GetStatus() != Receving {
+		t.Error("Expected client to keep receiving over the new stream")
+	}
+	if disconnected.Load() != 0 || connected.Load() != 2 {
+		t.Errorf("Expected 2 connected and 0 disconnected events, got %d and %d", connected.Load(), disconnected.Load())
+	}
+
+	// The subscription survived
+	topic.Pub("a")
+	waitForUpdate(t, newFrames, "a")
+	if updates := collectUpdates(t, oldFrames); len(updates) != 0 {
+		t.Errorf("Expected no updates on the old stream, got %v", updates)
+	}
+
+	// The new stream stops the client when it ends
+	cancelNew()
+	<-newDone
+	if client.GetStatus() != Waiting || disconnected.Load() != 1 {
+		t.Errorf("Expected client to be stopped, got status %d and %d disconnected events", client.GetStatus(), disconnected.Load())
+	}
+}
+
+func TestEvent_Takeover(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetTakeover(true)
+	client := ssePubSub.NewClientWithID("user-1")
+	server := httptest.NewServer(ssePubSub.Handler(HandlerOptions{}))
+	defer server.Close()
+
+	// The old connection
+	old, err := http.Get(server.URL + "/events?client_id=user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Body.Close()
+	for client.GetStatus() != Receving {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The new connection takes over, the old one is closed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events?client_id=user-1", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected new stream, got %d", resp.StatusCode)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(old.Body)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected old connection to end cleanly, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Old connection was not closed")
+	}
+}
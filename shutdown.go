@@ -0,0 +1,170 @@
+package pubsubsse
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ShutdownOptions configures how Shutdown informs the clients.
+type ShutdownOptions struct {
+	// Notify sends a final sys "shutdown" message to every receiving client.
+	Notify bool
+	// Reconnect is the reconnect hint of the shutdown message: how long the browser
+	// should wait before it reconnects, e.g. until another instance took over. 0 sends no hint.
+	// SSE streams also get it as retry directive, so EventSource waits as long before it reconnects.
+	Reconnect time.Duration
+}
+
+// DefaultShutdownOptions returns the shutdown options a new service uses: the clients are notified without a reconnect hint.
+func DefaultShutdownOptions() ShutdownOptions {
+	return ShutdownOptions{Notify: true}
+}
+
+// Get the options of Shutdown
+func (s *SSEPubSubService) GetShutdownOptions() ShutdownOptions {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.shutdownOptions
+}
+
+// Set the options of Shutdown
+func (s *SSEPubSubService) SetShutdownOptions(o ShutdownOptions) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.shutdownOptions = o
+}
+
+// Shutdown shuts the service down gracefully, e.g. before the process exits on a deploy.
+// 1. Stop accepting new clients, event streams and long-polls
+// 2. Stop the janitor
+// 3. Wait until the pending messages of every receiving client are in its stream, at most until ctx is done
+// 4. Send the sys "shutdown" message to every receiving client
+// 5. Stop the event streams and long-polls. The messages in their streams are flushed first.
+// 6. Close the backplane
+// 7. Wait until all event streams and long-polls ended
+//
+// If ctx is done before all streams ended, ctx.Err() is returned.
+// Calling Shutdown again only waits for the streams.
+func (s *SSEPubSubService) Shutdown(ctx context.Context) error {
+	// Stop accepting new clients, event streams and long-polls
+	s.lock.Lock()
+	alreadyClosed := s.closed
+	s.closed = true
+	done := s.streamsDone
+	if done == nil {
+		done = make(chan struct{})
+		if s.streams == 0 {
+			close(done)
+		} else {
+			s.streamsDone = done
+		}
+	}
+	s.lock.Unlock()
+
+	if !alreadyClosed {
+		s.GetLogger().Info("Shutting down")
+
+		// Stop the janitor
+		s.StopJanitor()
+
+		// Wait for the pending messages, send the sys "shutdown" message and stop the clients.
+		// The clients are handled concurrently, so a blocked client does not delay the others.
+		opts := s.GetShutdownOptions()
+		var wg sync.WaitGroup
+		for _, c := range s.GetClients() {
+			if !c.isReceiving() {
+				continue
+			}
+			wg.Add(1)
+			go func(c *Client) {
+				defer wg.Done()
+
+				if err := c.waitPending(ctx); err != nil {
+					s.GetLogger().Warn("Error flushing pending messages of client", logKeyClientID, c.GetID(), logKeyError, err)
+				}
+				if opts.Notify {
+					if err := c.sendShutdown(opts.Reconnect); err != nil {
+						s.GetLogger().Warn("Error sending shutdown message to client", logKeyClientID, c.GetID(), logKeyError, err)
+					}
+				}
+				c.stop()
+			}(c)
+		}
+		wg.Wait()
+
+		// Close the backplane
+		if err := s.SetBackplane(nil); err != nil {
+			s.GetLogger().Error("Error closing backplane", logKeyError, err)
+		}
+	}
+
+	// Wait until all event streams and long-polls ended
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Check if the service is shut down
+func (s *SSEPubSubService) isClosed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.closed
+}
+
+// Register a running event stream or long-poll of the client. ErrServiceClosed is returned if the service is shut down,
+// ErrClientNotFound if the client was removed in the meantime, e.g. because it expired.
+// The stop channel of the client must be created before, so Shutdown can stop it.
+func (s *SSEPubSubService) addStream(c *Client) error {
+	id := c.GetID()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return ErrServiceClosed
+	}
+	if client, ok := s.clients[id]; !ok || client != c {
+		return ErrClientNotFound
+	}
+	s.streams++
+	return nil
+}
+
+// Unregister an event stream or long-poll which ended
+func (s *SSEPubSubService) doneStream() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.streams--
+	if s.streams == 0 && s.streamsDone != nil {
+		close(s.streamsDone)
+		s.streamsDone = nil
+	}
+}
+
+// sendShutdown sends a message to the client to inform it that the service shuts down
+func (c *Client) sendShutdown(reconnect time.Duration) error {
+	// Build the JSON data
+	fulldata := &eventData{
+		Sys: []eventDataSys{
+			{
+				Type:  "shutdown",
+				Retry: reconnect.Milliseconds(),
+			},
+		},
+	}
+
+	// Send the JSON data to the client
+	if err := c.send(fulldata); err != nil {
+		return err
+	}
+
+	return nil
+}
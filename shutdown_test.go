@@ -0,0 +1,377 @@
+package pubsubsse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests for:
+// +Shutdown(ctx Context): error
+// +SetShutdownOptions(o ShutdownOptions)
+// +CreateClient(): *Client, error
+
+// Read frames until the sys "shutdown" message is received and return it
+func waitForShutdown(t *testing.T, frames chan string) eventDataSys {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case frame := <-frames:
+			_, data := parseFrame(t, frame)
+			for _, sys := range data.Sys {
+				if sys.Type == "shutdown" {
+					return sys
+				}
+			}
+		case <-timeout:
+			t.Fatal("Shutdown message not received")
+		}
+	}
+}
+
+func TestSSEPubSubService_Shutdown(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetShutdownOptions(ShutdownOptions{Notify: true, Reconnect: 3 * time.Second})
+	ssePubSub.SetClientTTL(time.Minute)
+	ssePubSub.StartJanitor(time.Minute)
+	if err := ssePubSub.SetBackplane(NewInProcessHub().NewBackplane()); err != nil {
+		t.Fatal(err)
+	}
+
+	client := ssePubSub.NewClient()
+	stopped := make(chan error, 1)
+	frames := make(chan string, 100)
+	retries := make(chan string, 100)
+	go func() {
+		stopped <- client.Start(context.Background(), func(msg string) {
+			if strings.HasPrefix(msg, "retry: ") {
+				retries <- msg
+			}
+			frames <- msg
+		})
+	}()
+	for client.GetStatus() != Receving {
+		time.Sleep(time.Millisecond)
+	}
+	waiting := ssePubSub.NewClient()
+
+	if err := ssePubSub.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The streaming client got the shutdown message with the reconnect hint and was stopped
+	if sys := waitForShutdown(t, frames); sys.Retry != 3000 {
+		t.Errorf("Expected reconnect hint of 3000ms, got %d", sys.Retry)
+	}
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("Expected stream to end without error, got %v", err)
+		}
+	default:
+		t.Error("Expected Start to return before Shutdown")
+	}
+
+	// EventSource gets the reconnect hint as retry directive
+	select {
+	case retry := <-retries:
+		if retry != "retry: 3000\n\n" {
+			t.Errorf("Unexpected retry directive %q", retry)
+		}
+	default:
+		t.Error("Expected retry directive")
+	}
+	if client.GetStatus() != Waiting || waiting.GetStatus() != Waiting {
+		t.Error("Expected clients to be waiting")
+	}
+
+	// The janitor and the backplane are stopped
+	if ssePubSub.janitorStop != nil {
+		t.Error("Expected janitor to be stopped")
+	}
+	if ssePubSub.GetBackplane() != nil {
+		t.Error("Expected backplane to be closed")
+	}
+
+	// New clients and streams are refused
+	if _, err := ssePubSub.CreateClient(); !errors.Is(err, ErrServiceClosed) {
+		t.Errorf("Expected ErrServiceClosed, got %v", err)
+	}
+	closed := ssePubSub.NewClient()
+	if closed == nil {
+		t.Fatal("Expected a closed client")
+	}
+	if _, ok := ssePubSub.GetClientByID(closed.GetID()); ok {
+		t.Error("Expected the closed client not to be added")
+	}
+	if err := closed.Start(context.Background(), func(string) {}); !errors.Is(err, ErrServiceClosed) {
+		t.Errorf("Expected ErrServiceClosed, got %v", err)
+	}
+	if err := client.Start(context.Background(), func(string) {}); !errors.Is(err, ErrServiceClosed) {
+		t.Errorf("Expected ErrServiceClosed, got %v", err)
+	}
+	if client.GetStatus() != Waiting {
+		t.Error("Expected refused client to be waiting")
+	}
+	if _, _, err := waiting.Poll(context.Background(), "", 0); !errors.Is(err, ErrServiceClosed) {
+		t.Errorf("Expected ErrServiceClosed, got %v", err)
+	}
+
+	// Shutdown again
+	if err := ssePubSub.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSSEPubSubService_Shutdown_Flush(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	client.Sub(topic)
+
+	// The stream is blocked while the first update is written
+	block := make(chan struct{})
+	frames := make(chan string, 100)
+	go client.Start(context.Background(), func(msg string) {
+		frames <- msg
+		if _, data := parseFrame(t, msg); len(data.Updates) > 0 && data.Updates[0].Data == "a" {
+			<-block
+		}
+	})
+	for client.GetStatus() != Receving {
+		time.Sleep(time.Millisecond)
+	}
+	topic.Pub("a")
+	waitForUpdate(t, frames, "a")
+
+	// The pending updates and the shutdown message are flushed before the stream ends
+	topic.Pub("b")
+	topic.Pub("c")
+	done := make(chan error, 1)
+	go func() { done <- ssePubSub.Shutdown(context.Background()) }()
+	for client.GetStatus() != Waiting {
+		time.Sleep(time.Millisecond)
+	}
+	close(block)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown did not return")
+	}
+
+	received := []string{}
+	for len(frames) > 0 {
+		_, data := parseFrame(t, <-frames)
+		for _, u := range data.Updates {
+			received = append(received, u.Data.(string))
+		}
+		for _, sys := range data.Sys {
+			received = append(received, sys.Type)
+		}
+	}
+	if len(received) != 3 || received[0] != "b" || received[1] != "c" || received[2] != "shutdown" {
+		t.Errorf("Expected pending updates and the shutdown message, got %v", received)
+	}
+}
+
+// TestSSEPubSubService_Shutdown_Pending tests that the messages which wait for space in the stream
+// of a blocked client are delivered before the shutdown message.
+func TestSSEPubSubService_Shutdown_Pending(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	client.SetStreamOptions(StreamOptions{BufferSize: 1, Policy: BlockWithTimeout, BlockTimeout: time.Minute})
+	client.Sub(topic)
+
+	// The stream is blocked while the first update is written
+	block := make(chan struct{})
+	frames := make(chan string, 100)
+	go client.Start(context.Background(), func(msg string) {
+		frames <- msg
+		if _, data := parseFrame(t, msg); len(data.Updates) > 0 && data.Updates[0].Data == "a" {
+			<-block
+		}
+	})
+	for client.GetStatus() != Receving {
+		time.Sleep(time.Millisecond)
+	}
+	topic.Pub("a")
+	waitForUpdate(t, frames, "a")
+
+	// "b" fills the stream, "c" and "d" wait for space
+	topic.Pub("b")
+	topic.Pub("c")
+	topic.Pub("d")
+	done := make(chan error, 1)
+	go func() { done <- ssePubSub.Shutdown(context.Background()) }()
+
+	// The client is not stopped while messages are pending
+	time.Sleep(20 * time.Millisecond)
+	if client.GetStatus() != Receving {
+		t.Error("Expected the client to receive until the pending messages are in the stream")
+	}
+	close(block)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown did not return")
+	}
+
+	received := []string{}
+	for len(frames) > 0 {
+		_, data := parseFrame(t, <-frames)
+		for _, u := range data.Updates {
+			received = append(received, u.Data.(string))
+		}
+		for _, sys := range data.Sys {
+			received = append(received, sys.Type)
+		}
+	}
+	expected := []string{"b", "c", "d", "shutdown"}
+	if strings.Join(received, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, received)
+	}
+}
+
+// TestSSEPubSubService_Shutdown_PendingDeadline tests that a blocked client is stopped when ctx is done,
+// although messages are pending.
+func TestSSEPubSubService_Shutdown_PendingDeadline(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetShutdownOptions(ShutdownOptions{})
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	client.SetStreamOptions(StreamOptions{BufferSize: 1, Policy: BlockWithTimeout, BlockTimeout: time.Minute})
+	client.Sub(topic)
+
+	// The stream hangs while it writes the first update
+	block := make(chan struct{})
+	writing := make(chan struct{})
+	go client.Start(context.Background(), func(msg string) {
+		if _, data := parseFrame(t, msg); len(data.Updates) > 0 && data.Updates[0].Data == "a" {
+			close(writing)
+			<-block
+		}
+	})
+	for client.GetStatus() != Receving {
+		time.Sleep(time.Millisecond)
+	}
+	topic.Pub("a")
+	<-writing
+	topic.Pub("b")
+	topic.Pub("c")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := ssePubSub.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if client.GetStatus() != Waiting {
+		t.Error("Expected the client to be stopped")
+	}
+
+	close(block)
+	if err := ssePubSub.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSSEPubSubService_Shutdown_Deadline(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetShutdownOptions(ShutdownOptions{})
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	client.Sub(topic)
+
+	// The stream hangs while it writes the update
+	block := make(chan struct{})
+	writing := make(chan struct{})
+	go client.Start(context.Background(), func(msg string) {
+		if _, data := parseFrame(t, msg); len(data.Updates) > 0 {
+			close(writing)
+			<-block
+		}
+	})
+	for client.GetStatus() != Receving {
+		time.Sleep(time.Millisecond)
+	}
+	topic.Pub("a")
+	<-writing
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := ssePubSub.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+
+	// Wait again until the stream ended
+	close(block)
+	if err := ssePubSub.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSSEPubSubService_Shutdown_Poll(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	client.Poll(context.Background(), "", 0)
+
+	// A waiting poll returns the shutdown message
+	result := make(chan []json.RawMessage, 1)
+	go func() {
+		msgs, _, _ := client.Poll(context.Background(), "", time.Minute)
+		result <- msgs
+	}()
+	for {
+		ssePubSub.lock.Lock()
+		streams := ssePubSub.streams
+		ssePubSub.lock.Unlock()
+		if streams > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := ssePubSub.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	msgs := <-result
+	var data eventData
+	if len(msgs) != 1 || json.Unmarshal(msgs[0], &data) != nil || len(data.Sys) != 1 || data.Sys[0].Type != "shutdown" {
+		t.Errorf("Expected shutdown message, got %s", msgs)
+	}
+}
+
+func TestSSEPubSubService_Shutdown_Handler(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	handler := ssePubSub.Handler(HandlerOptions{})
+	ssePubSub.Shutdown(context.Background())
+
+	for _, path := range []string{"/clients", "/events?client_id=" + client.GetID()} {
+		method := http.MethodGet
+		if path == "/clients" {
+			method = http.MethodPost
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+
+		var resp ErrorResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		if w.Code != http.StatusServiceUnavailable || resp.Error.Code != CodeServiceClosed {
+			t.Errorf("%s: expected 503 service_closed, got %d %+v", path, w.Code, resp)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package pubsubsse
+
+import (
+	"sync"
+	"time"
+)
+
+// OverflowPolicy defines what happens if a message is sent to a client whose stream is full.
+type OverflowPolicy int
+
+const (
+	// BlockWithTimeout blocks the sender until there is space in the stream.
+	// If the timeout expires, the new message is dropped.
+	BlockWithTimeout OverflowPolicy = iota
+	// DropNewest drops the new message.
+	DropNewest
+	// DropOldest drops the oldest message in the stream to make space for the new one.
+	DropOldest
+	// CoalesceLatest replaces the queued update of the same topic with the new one.
+	// If there is no queued update of the topic, the oldest message is dropped.
+	CoalesceLatest
+	// DisconnectSlowConsumer drops the new message and stops the event stream of the client.
+	DisconnectSlowConsumer
+)
+
+// String returns the name of the policy
+func (p OverflowPolicy) String() string {
+	switch p {
+	case BlockWithTimeout:
+		return "block_with_timeout"
+	case DropNewest:
+		return "drop_newest"
+	case DropOldest:
+		return "drop_oldest"
+	case CoalesceLatest:
+		return "coalesce_latest"
+	case DisconnectSlowConsumer:
+		return "disconnect_slow_consumer"
+	}
+	return "unknown"
+}
+
+// Defaults for the stream of a client.
+const (
+	DefaultBufferSize   = 100
+	DefaultBlockTimeout = 100 * time.Millisecond
+)
+
+// StreamOptions configures the stream buffer of a client.
+type StreamOptions struct {
+	// BufferSize is the number of messages the stream can hold.
+	BufferSize int
+	// Policy is applied if a message is sent while the stream is full.
+	Policy OverflowPolicy
+	// BlockTimeout is the maximum time a sender is blocked by BlockWithTimeout.
+	BlockTimeout time.Duration
+}
+
+// DefaultStreamOptions returns the stream options new clients get by default.
+func DefaultStreamOptions() StreamOptions {
+	return StreamOptions{
+		BufferSize:   DefaultBufferSize,
+		Policy:       BlockWithTimeout,
+		BlockTimeout: DefaultBlockTimeout,
+	}
+}
+
+// Replace invalid values with the defaults
+func (o StreamOptions) normalize() StreamOptions {
+	if o.BufferSize <= 0 {
+		o.BufferSize = DefaultBufferSize
+	}
+	if o.BlockTimeout <= 0 {
+		o.BlockTimeout = DefaultBlockTimeout
+	}
+	return o
+}
+
+// streamQueue is the buffer between the senders and the event stream of a client.
+type streamQueue struct {
+	lock  sync.Mutex
+	items []*message
+
+	// ready is signalled when a message is added
+	ready chan struct{}
+	// space is closed (and replaced) when messages are removed
+	space chan struct{}
+}
+
+// Create a new stream queue
+func newStreamQueue() *streamQueue {
+	return &streamQueue{
+		items: []*message{},
+		ready: make(chan struct{}, 1),
+		space: make(chan struct{}),
+	}
+}
+
+// Signal the reader that messages are available
+func (q *streamQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Add the message if the queue holds less than size messages
+func (q *streamQueue) tryPush(m *message, size int) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if len(q.items) >= size {
+		return false
+	}
+	q.items = append(q.items, m)
+	q.signal()
+	return true
+}
+
+// Add the message and drop the oldest messages if the queue is full.
+// Returns the number of dropped messages.
+func (q *streamQueue) pushDropOldest(m *message, size int) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.items = append(q.items, m)
+	dropped := 0
+	if len(q.items) > size {
+		dropped = len(q.items) - size
+		q.items = append([]*message{}, q.items[dropped:]...)
+	}
+	q.signal()
+	return dropped
+}
+
+// Replace the last queued update of the same topic with the message.
+// Returns false if there is no queued update of the topic.
+func (q *streamQueue) replaceTopic(m *message) bool {
+	if m.topic == "" {
+		return false
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for i := len(q.items) - 1; i >= 0; i-- {
+		if q.items[i].topic == m.topic && q.items[i].seq > 0 {
+			q.items[i] = m
+			return true
+		}
+	}
+	return false
+}
+
+// Get the channel which is closed when messages are removed
+func (q *streamQueue) spaceChan() chan struct{} {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.space
+}
+
+// Remove and return all queued messages
+func (q *streamQueue) popAll() []*message {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	items := q.items
+	q.items = []*message{}
+	if len(items) > 0 {
+		close(q.space)
+		q.space = make(chan struct{})
+	}
+	return items
+}
+
+// Put messages back in front of the queue, e.g. because they were not delivered.
+// The size is not checked, the messages were queued before.
+func (q *streamQueue) pushFront(msgs []*message) {
+	if len(msgs) == 0 {
+		return
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.items = append(append([]*message{}, msgs...), q.items...)
+	q.signal()
+}
+
+// Get the number of queued messages
+func (q *streamQueue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return len(q.items)
+}
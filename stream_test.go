@@ -0,0 +1,150 @@
+package pubsubsse
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests for:
+// +SetStreamOptions(o StreamOptions)
+// +GetDroppedMessages(): uint64
+// -enqueue(m *message): error
+
+// Create a receiving client with the stream options
+func newTestStreamClient(o StreamOptions) (*Client, *Topic) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	client.SetStreamOptions(o)
+	topic := ssePubSub.NewPublicTopic("test")
+	client.Sub(topic)
+	other := ssePubSub.NewPublicTopic("other")
+	client.Sub(other)
+	setReceiving(client)
+	return client, topic
+}
+
+// Get the data of all update messages in the stream
+func streamValues(client *Client) []string {
+	values := []string{}
+	for _, m := range client.stream.popAll() {
+		if m.seq > 0 {
+			values = append(values, m.data)
+		}
+	}
+	return values
+}
+
+// TestStream_DefaultOptions tests the default stream options.
+func TestStream_DefaultOptions(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	if client.GetStreamOptions() != DefaultStreamOptions() {
+		t.Error("Expected default stream options")
+	}
+
+	ssePubSub.SetDefaultStreamOptions(StreamOptions{BufferSize: 5, Policy: DropOldest})
+	client = ssePubSub.NewClient()
+	o := client.GetStreamOptions()
+	if o.BufferSize != 5 || o.Policy != DropOldest || o.BlockTimeout != DefaultBlockTimeout {
+		t.Errorf("Unexpected stream options %+v", o)
+	}
+}
+
+// TestStream_DropNewest tests the DropNewest policy.
+func TestStream_DropNewest(t *testing.T) {
+	client, topic := newTestStreamClient(StreamOptions{BufferSize: 2, Policy: DropNewest})
+	topic.Pub(1)
+	topic.Pub(2)
+	topic.Pub(3)
+
+	values := streamValues(client)
+	if len(values) != 2 || values[0] != `{"sys":null,"updates":[{"topic":"test","data":1}]}` {
+		t.Errorf("Unexpected stream %v", values)
+	}
+	if client.GetDroppedMessages() != 1 {
+		t.Errorf("Expected 1 dropped message got %d", client.GetDroppedMessages())
+	}
+}
+
+// TestStream_DropOldest tests the DropOldest policy.
+func TestStream_DropOldest(t *testing.T) {
+	client, topic := newTestStreamClient(StreamOptions{BufferSize: 2, Policy: DropOldest})
+	topic.Pub(1)
+	topic.Pub(2)
+	topic.Pub(3)
+
+	values := streamValues(client)
+	if len(values) != 2 || values[1] != `{"sys":null,"updates":[{"topic":"test","data":3}]}` {
+		t.Errorf("Unexpected stream %v", values)
+	}
+	if client.GetDroppedMessages() != 1 {
+		t.Errorf("Expected 1 dropped message got %d", client.GetDroppedMessages())
+	}
+}
+
+// TestStream_CoalesceLatest tests the CoalesceLatest policy.
+func TestStream_CoalesceLatest(t *testing.T) {
+	client, topic := newTestStreamClient(StreamOptions{BufferSize: 2, Policy: CoalesceLatest})
+	other, _ := client.GetTopicByName("other")
+	topic.Pub(1)
+	other.Pub(1)
+	topic.Pub(2)
+	topic.Pub(3)
+
+	values := streamValues(client)
+	if len(values) != 2 ||
+		values[0] != `{"sys":null,"updates":[{"topic":"test","data":3}]}` ||
+		values[1] != `{"sys":null,"updates":[{"topic":"other","data":1}]}` {
+		t.Errorf("Unexpected stream %v", values)
+	}
+	if client.GetDroppedMessages() != 2 {
+		t.Errorf("Expected 2 dropped messages got %d", client.GetDroppedMessages())
+	}
+}
+
+// TestStream_DisconnectSlowConsumer tests the DisconnectSlowConsumer policy.
+func TestStream_DisconnectSlowConsumer(t *testing.T) {
+	client, topic := newTestStreamClient(StreamOptions{BufferSize: 1, Policy: DisconnectSlowConsumer})
+	topic.Pub(1)
+	topic.Pub(2)
+
+	if client.GetStatus() != Waiting {
+		t.Error("Expected slow consumer to be disconnected")
+	}
+	if client.GetDroppedMessages() != 1 {
+		t.Errorf("Expected 1 dropped message got %d", client.GetDroppedMessages())
+	}
+}
+
+// TestStream_BlockWithTimeout tests the BlockWithTimeout policy.
+func TestStream_BlockWithTimeout(t *testing.T) {
+	client, topic := newTestStreamClient(StreamOptions{BufferSize: 1, Policy: BlockWithTimeout, BlockTimeout: 20 * time.Millisecond})
+	topic.Pub(1)
+
+	// Times out
+	start := time.Now()
+	report := <-topic.PubAsync(2)
+	if time.Since(start) < 20*time.Millisecond {
+		t.Error("Expected delivery to wait for the timeout")
+	}
+	if report.Clients[client.GetID()] != Dropped {
+		t.Errorf("Expected message to be dropped got %s", report.Clients[client.GetID()])
+	}
+	if client.GetDroppedMessages() != 1 {
+		t.Errorf("Expected 1 dropped message got %d", client.GetDroppedMessages())
+	}
+
+	// Unblocked by the reader
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		client.stream.popAll()
+	}()
+	report = <-topic.PubAsync(3)
+	if report.Clients[client.GetID()] != Delivered {
+		t.Errorf("Expected message to be delivered got %s", report.Clients[client.GetID()])
+	}
+	values := streamValues(client)
+	if len(values) != 1 || values[0] != `{"sys":null,"updates":[{"topic":"test","data":3}]}` {
+		t.Errorf("Unexpected stream %v", values)
+	}
+}
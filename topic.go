@@ -1,9 +1,13 @@
 package pubsubsse
 
 import (
+	"context"
+	"encoding/json"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/apex/log"
 	"github.com/google/uuid"
 )
 
@@ -16,22 +20,63 @@ const (
 	TGroup   topicType = "group"
 )
 
+// topicScope is the container a topic lives in: the sSEPubSubService for
+// public topics, a group for group topics or a client for private topics.
+// It is used to resolve the parent topics of the subscription hierarchy
+// and the clients which can see the topic for pattern subscriptions.
+type topicScope interface {
+	scopeTopicByName(name string) (*Topic, bool)
+	scopeTopics() map[string]*Topic
+	scopeClients() map[string]*Client
+	scopeHasClient(c *Client) bool
+	scopeService() *SSEPubSubService
+}
+
 // Topic represents a messaging Topic in the SSE pub-sub system.
 type Topic struct {
 	name    string
 	id      string
+	epoch   string // nonce of the topic in the replay cursor, see cursorPos
 	ttype   topicType
 	clients map[string]*Client
+	scope   topicScope
 	lock    sync.Mutex
+
+	// Publish lock. It is held while an update is numbered and put into the streams of the subscribers,
+	// so concurrent publishers can't enqueue a newer update before an older one.
+	pubLock sync.Mutex
+
+	// Replay buffer
+	seq         uint64
+	history     []*message
+	historySize int
+
+	// Retained last value
+	retained    bool
+	retainedMsg *message
+
+	// Access control list. nil allows everyone.
+	acl *TopicACL
+
+	// SSE event name of the updates in the named events wire format. Empty means the topic name.
+	eventName string
+
+	// Codec of the published messages. nil uses the codec of the service.
+	codec Codec
 }
 
 // Create a new topic
 func newTopic(name string, ttype topicType) *Topic {
+	id := uuid.New().String()
 	return &Topic{
 		name:    name,
-		id:      uuid.New().String(),
+		id:      id,
+		epoch:   id[:8],
 		ttype:   ttype,
 		clients: make(map[string]*Client),
+
+		history:     []*message{},
+		historySize: DefaultReplayBufferSize,
 	}
 }
 
@@ -59,6 +104,167 @@ func (t *Topic) GetType() string {
 	return string(t.ttype)
 }
 
+// Get the size of the replay buffer
+func (t *Topic) GetReplayBufferSize() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.historySize
+}
+
+// Set the size of the replay buffer.
+// The topic keeps the last n updates to re-deliver them to reconnecting clients.
+// 0 disables the replay buffer.
+func (t *Topic) SetReplayBufferSize(n int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if n < 0 {
+		n = 0
+	}
+	t.historySize = n
+	if len(t.history) > n {
+		t.history = append([]*message{}, t.history[len(t.history)-n:]...)
+	}
+}
+
+// Get the cursor position of the last update
+func (t *Topic) getCursor() cursorPos {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return cursorPos{epoch: t.epoch, seq: t.seq}
+}
+
+// Get all updates in the replay buffer with a sequence number greater than seq
+func (t *Topic) getHistorySince(seq uint64) []*message {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	msgs := []*message{}
+	for _, m := range t.history {
+		if m.seq > seq {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+// Get all updates in the replay buffer which were published after since
+func (t *Topic) getHistoryAfter(since time.Time) []*message {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	msgs := []*message{}
+	for _, m := range t.history {
+		if m.time.After(since) {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs
+}
+
+// Check if the topic retains its last value
+func (t *Topic) IsRetained() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.retained
+}
+
+// Set if the topic retains its last value.
+// The retained value is sent to clients as soon as they subscribe
+// and in the init message when they (re)connect.
+// Disabling it clears the retained value.
+func (t *Topic) SetRetained(retained bool) {
+	t.lock.Lock()
+	t.retained = retained
+	if !retained {
+		t.retainedMsg = nil
+	}
+	t.lock.Unlock()
+
+	t.publishBackplaneOptions()
+}
+
+// Clear the retained value
+func (t *Topic) ClearRetained() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.retainedMsg = nil
+}
+
+// Get the retained value as update message
+func (t *Topic) getRetained() (*message, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.retainedMsg == nil {
+		return nil, false
+	}
+	return t.retainedMsg.retainedCopy(), true
+}
+
+// Get all subtopics which exist in the same scope.
+// For "a" these are e.g. the topics "a/b" and "a/b/c".
+func (t *Topic) getChildren() []*Topic {
+	t.lock.Lock()
+	prefix := t.name + "/"
+	scope := t.scope
+	t.lock.Unlock()
+
+	children := []*Topic{}
+	if scope == nil {
+		return children
+	}
+
+	for name, c := range scope.scopeTopics() {
+		if strings.HasPrefix(name, prefix) {
+			children = append(children, c)
+		}
+	}
+	return children
+}
+
+// Set the scope of the topic
+func (t *Topic) setScope(scope topicScope) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.scope = scope
+}
+
+// Get the scope of the topic. nil if the topic has no scope.
+func (t *Topic) getScope() topicScope {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.scope
+}
+
+// Get all parent topics which exist in the same scope.
+// For "a/b/c" these are the topics "a" and "a/b" (if they exist).
+func (t *Topic) getParents() []*Topic {
+	t.lock.Lock()
+	name := t.name
+	scope := t.scope
+	t.lock.Unlock()
+
+	parents := []*Topic{}
+	if scope == nil {
+		return parents
+	}
+
+	levels := strings.Split(name, "/")
+	for i := 1; i < len(levels); i++ {
+		if p, ok := scope.scopeTopicByName(strings.Join(levels[:i], "/")); ok && p != t {
+			parents = append(parents, p)
+		}
+	}
+	return parents
+}
+
 // Add a client to the topic
 func (t *Topic) addClient(c *Client) {
 	t.lock.Lock()
@@ -88,8 +294,55 @@ func (t *Topic) GetClients() map[string]*Client {
 	return newmap
 }
 
-// Check if a client is subscribed to the topic
-func (t *Topic) IsSubscribed(c *Client) bool {
+// Get all clients which can see the topic
+func (t *Topic) getScopeClients() map[string]*Client {
+	t.lock.Lock()
+	scope := t.scope
+	t.lock.Unlock()
+
+	if scope == nil {
+		return map[string]*Client{}
+	}
+	return scope.scopeClients()
+}
+
+// Get all clients which receive updates of the topic.
+// These are the clients subscribed to the topic itself,
+// the clients subscribed to one of its parent topics and
+// the clients with a pattern matching the topic,
+// as long as the ACL allows them.
+func (t *Topic) getSubscribers() map[string]*Client {
+	subscribers := t.GetClients()
+	for _, p := range t.getParents() {
+		for k, v := range p.GetClients() {
+			subscribers[k] = v
+		}
+	}
+
+	// Only the clients with patterns are checked, so publishing does not scan all clients
+	name := t.GetName()
+	if s := t.service(); s != nil {
+		for k, v := range s.getPatternClients() {
+			if _, ok := subscribers[k]; ok {
+				continue
+			}
+			if v.matchesPattern(name) && t.hasScopeClient(v) {
+				subscribers[k] = v
+			}
+		}
+	}
+
+	// Clients which are not allowed by the ACL get no updates
+	for k, v := range subscribers {
+		if !t.canAccess(v) {
+			delete(subscribers, k)
+		}
+	}
+	return subscribers
+}
+
+// Check if a client is subscribed to the topic itself
+func (t *Topic) isDirectSubscribed(c *Client) bool {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
@@ -97,19 +350,59 @@ func (t *Topic) IsSubscribed(c *Client) bool {
 	return ok
 }
 
+// Check if a client can see the topic
+func (t *Topic) hasScopeClient(c *Client) bool {
+	t.lock.Lock()
+	scope := t.scope
+	t.lock.Unlock()
+
+	return scope != nil && scope.scopeHasClient(c)
+}
+
+// Check if a client receives the updates of the topic,
+// because it is subscribed to it or has a pattern matching it.
+func (t *Topic) receives(c *Client) bool {
+	if t.IsSubscribed(c) {
+		return true
+	}
+	return t.canAccess(c) && c.matchesPattern(t.GetName()) && t.hasScopeClient(c)
+}
+
+// Check if a client is subscribed to the topic.
+// A client subscribed to a parent topic is also subscribed to all its subtopics.
+// Pattern subscriptions are not included, see Client.GetSubscribedPatterns.
+// A client which is not allowed by the ACL is never subscribed.
+func (t *Topic) IsSubscribed(c *Client) bool {
+	if !t.canAccess(c) {
+		return false
+	}
+	if t.isDirectSubscribed(c) {
+		return true
+	}
+	for _, p := range t.getParents() {
+		if p.isDirectSubscribed(c) {
+			return true
+		}
+	}
+	return false
+}
+
 type eventData struct {
 	Sys     []eventDataSys     `json:"sys"`
 	Updates []eventDataUpdates `json:"updates"`
 }
 
 type eventDataSys struct {
-	Type string             `json:"type"`
-	List []eventDataSysList `json:"list,omitempty"`
+	Type  string             `json:"type"`
+	List  []eventDataSysList `json:"list,omitempty"`
+	Retry int64              `json:"retry,omitempty"` // shutdown: reconnect hint in milliseconds
 }
 
 type eventDataSysList struct {
-	Name string `json:"name"`
-	Type string `json:"type,omitempty"` // topics, subscribed, unsubscribed
+	Name  string `json:"name"`
+	Type  string `json:"type,omitempty"`  // topics, subscribed, unsubscribed
+	Error string `json:"error,omitempty"` // error
+	Code  string `json:"code,omitempty"`  // error code
 }
 
 type eventDataUpdates struct {
@@ -117,25 +410,318 @@ type eventDataUpdates struct {
 	Data  interface{} `json:"data"`
 }
 
-// Publish a message to all clients in the topic
-func (t *Topic) Pub(msg interface{}) error {
-	// Build the JSON data
-	fulldata := &eventData{
-		Updates: []eventDataUpdates{},
+// DeliveryStatus is the result of publishing an update to a single client.
+type DeliveryStatus string
+
+const (
+	// Delivered means the update was put into the stream of the client.
+	Delivered DeliveryStatus = "delivered"
+	// Dropped means the update was dropped because the stream of the client was full.
+	Dropped DeliveryStatus = "dropped"
+	// NotReceiving means the client has no open event stream.
+	NotReceiving DeliveryStatus = "not_receiving"
+)
+
+// DeliveryReport describes the delivery of an update to all subscribers.
+type DeliveryReport struct {
+	Topic string
+	// Seq is the sequence number of the update in the topic.
+	Seq uint64
+	// Clients maps the client IDs to the delivery status.
+	Clients map[string]DeliveryStatus
+	// Err is set if the update could not be published at all.
+	Err error
+}
+
+// Count returns the number of clients with the delivery status.
+func (r *DeliveryReport) Count(status DeliveryStatus) int {
+	n := 0
+	for _, s := range r.Clients {
+		if s == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Build the update message of an already encoded message
+// 1. Build the JSON data around the encoded message
+// 2. Number the update and store it in the replay buffer
+// 3. Keep it as retained value if the topic is retained
+//
+// event overrides the SSE event name of the topic for this update if it is not empty.
+// ctx is the trace context of the update, nil if it is not traced.
+func (t *Topic) newRawUpdate(ctx context.Context, event string, payload json.RawMessage) (*message, error) {
+	if err := validateEventName(event); err != nil {
+		return nil, err
 	}
-	u := eventDataUpdates{
-		Topic: t.GetName(),
-		Data:  msg,
+
+	// The payload is embedded into the JSON envelope as is, invalid JSON would break it for every subscriber
+	if !json.Valid(payload) {
+		return nil, detailError(ErrInvalidPayload, "data of topic %s is not valid JSON", t.GetName())
 	}
-	fulldata.Updates = append(fulldata.Updates, u)
 
-	// Send the JSON data to all clients
-	for _, c := range t.GetClients() {
-		err := c.send(fulldata) // ignore error. Fire and forget.
-		if err != nil {
-			log.Errorf("[T:%s]: Error sending data to client: %s", t.GetName(), err.Error())
+	// Build the JSON data without re-marshalling the payload
+	topicJSON, err := json.Marshal(t.GetName())
+	if err != nil {
+		return nil, err
+	}
+	jsonData := `{"sys":null,"updates":[{"topic":` + string(topicJSON) + `,"data":` + string(payload) + `}]}`
+
+	// Number the update and store it in the replay buffer
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if event == "" {
+		event = t.eventName
+	}
+	if event == "" {
+		event = t.name
+	}
+
+	t.seq++
+	m := &message{
+		topic: t.name,
+		seq:   t.seq,
+		epoch: t.epoch,
+		data:  jsonData,
+		time:  time.Now(),
+		event: event,
+
+		payload: payload,
+		ctx:     ctx,
+	}
+	if t.retained {
+		t.retainedMsg = m
+	}
+	if t.historySize > 0 {
+		t.history = append(t.history, m)
+		if len(t.history) > t.historySize {
+			t.history = t.history[len(t.history)-t.historySize:]
 		}
 	}
 
+	return m, nil
+}
+
+// Publish a message to all clients subscribed to the topic or one of its parent topics.
+// The message is marshalled once and put into the streams of the clients without blocking.
+// Public and group topics also publish the message to the other instances over the backplane.
+// Clients which have to be waited for (BlockWithTimeout) get the message from their own writer goroutine.
+func (t *Topic) Pub(msg interface{}) error {
+	return t.PubEventContext(context.Background(), "", msg)
+}
+
+// Publish a message like Pub. If a tracer is set, the publish span is a child of the span in ctx,
+// so the trace of the caller (e.g. of an HTTP request) continues into the fan-out and the delivery.
+func (t *Topic) PubContext(ctx context.Context, msg interface{}) error {
+	return t.PubEventContext(ctx, "", msg)
+}
+
+// Publish a message like Pub with the SSE event name event instead of the event name of the topic.
+// The event name is only used in the named events wire format.
+func (t *Topic) PubEvent(event string, msg interface{}) error {
+	return t.PubEventContext(context.Background(), event, msg)
+}
+
+// Publish a message like PubEvent with the trace context ctx (see PubContext).
+func (t *Topic) PubEventContext(ctx context.Context, event string, msg interface{}) error {
+	ctx, span := t.startPublishSpan(ctx, event)
+
+	// Encode the message once for all subscribers with the codec of the topic
+	payload, err := t.GetCodec().Encode(msg)
+	if err != nil {
+		span.RecordError(err)
+		span.End()
+		return err
+	}
+
+	// Send the JSON data to all clients
+	m, err := t.fanOut(ctx, event, payload, span)
+	if err != nil {
+		return err
+	}
+
+	// Inform the other instances about the update
+	t.publishBackplane(m)
+
 	return nil
 }
+
+// Publish an already encoded message without re-marshalling it.
+// data is put into the data field of the update as is, so it has to be valid JSON
+// (e.g. a JSON document or a base64 encoded string).
+func (t *Topic) PubRaw(data []byte) error {
+	return t.PubRawContext(context.Background(), data)
+}
+
+// Publish an already encoded message like PubRaw with the trace context ctx (see PubContext).
+func (t *Topic) PubRawContext(ctx context.Context, data []byte) error {
+	ctx, span := t.startPublishSpan(ctx, "")
+	m, err := t.fanOut(ctx, "", json.RawMessage(data), span)
+	if err != nil {
+		return err
+	}
+
+	t.publishBackplane(m)
+
+	return nil
+}
+
+// pubLocal publishes an update received from another instance over the backplane.
+// It is only sent to the local clients.
+func (t *Topic) pubLocal(event string, data json.RawMessage) error {
+	ctx, span := t.startPublishSpan(context.Background(), event)
+	span.SetAttributes(Attr(AttrBackplane, true))
+	_, err := t.fanOut(ctx, event, data, span)
+	return err
+}
+
+// enqueueUpdate numbers the update and puts it into the streams of all subscribers under the publish lock.
+// Otherwise a concurrent publisher could enqueue the next update first
+// and the clients would skip this one as already delivered.
+// prepare is called with the update and its subscribers before the update is enqueued.
+// It returns the function which is called with the delivery status of every subscriber.
+func (t *Topic) enqueueUpdate(ctx context.Context, event string, payload json.RawMessage, prepare func(m *message, subscribers map[string]*Client) func(c *Client, status DeliveryStatus)) (*message, error) {
+	t.pubLock.Lock()
+	defer t.pubLock.Unlock()
+
+	m, err := t.newRawUpdate(ctx, event, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	subscribers := t.getSubscribers()
+	done := prepare(m, subscribers)
+	for _, c := range subscribers {
+		c := c
+		c.enqueueAsync(m, func(status DeliveryStatus) { done(c, status) })
+	}
+
+	return m, nil
+}
+
+// fanOut numbers the update and sends it to all subscribers. Fire and forget.
+// The publish span ends when the update was handed to every subscriber.
+func (t *Topic) fanOut(ctx context.Context, event string, payload json.RawMessage, span Span) (*message, error) {
+	m, err := t.enqueueUpdate(ctx, event, payload, func(m *message, subscribers map[string]*Client) func(*Client, DeliveryStatus) {
+		span.SetAttributes(Attr(AttrSeq, m.seq))
+		if len(subscribers) == 0 {
+			span.End()
+			return nil
+		}
+
+		pending := &atomic.Int64{}
+		pending.Store(int64(len(subscribers)))
+		return func(c *Client, status DeliveryStatus) {
+			span.AddEvent(EventEnqueue, Attr(AttrClientID, c.GetID()), Attr(AttrStatus, string(status)))
+			if status == Dropped {
+				t.logger().Warn("Error sending data to client: stream is full", logKeyClientID, c.GetID(), logKeyTopic, m.topic)
+			}
+			if pending.Add(-1) == 0 {
+				span.End()
+			}
+		}
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.End()
+		return nil, err
+	}
+
+	t.metrics().addPublished(topicType(t.GetType()))
+	t.service().emitOnPublish(PublishEvent{Topic: t, Seq: m.seq, Event: m.event, Data: m.payload})
+
+	return m, nil
+}
+
+// Inform the other instances about the update.
+// The options of the topic are sent along, so an instance which does not know the topic yet creates it with them.
+func (t *Topic) publishBackplane(m *message) {
+	t.sendBackplane(&BackplaneMessage{Event: BackplanePub, Topic: m.topic, EventName: m.event, Data: m.payload, Options: t.backplaneOptions()})
+}
+
+// Send a message about the topic to the other instances.
+// Private topics are not shared, because their client only exists on this instance.
+func (t *Topic) sendBackplane(msg *BackplaneMessage) {
+	t.lock.Lock()
+	scope := t.scope
+	ttype := t.ttype
+	t.lock.Unlock()
+
+	if scope == nil || ttype == TPrivate {
+		return
+	}
+
+	msg.TopicType = string(ttype)
+	if g, ok := scope.(*Group); ok {
+		g.publishBackplane(msg)
+		return
+	}
+	if s := scope.scopeService(); s != nil {
+		s.publishBackplane(msg)
+	}
+}
+
+// PubAsync publishes a message like Pub and returns a channel
+// which receives the delivery report once the update was handed to every subscriber.
+func (t *Topic) PubAsync(msg interface{}) <-chan *DeliveryReport {
+	return t.PubAsyncContext(context.Background(), msg)
+}
+
+// Publish a message like PubAsync with the trace context ctx (see PubContext).
+func (t *Topic) PubAsyncContext(ctx context.Context, msg interface{}) <-chan *DeliveryReport {
+	result := make(chan *DeliveryReport, 1)
+
+	report := &DeliveryReport{
+		Topic:   t.GetName(),
+		Clients: make(map[string]DeliveryStatus),
+	}
+
+	ctx, span := t.startPublishSpan(ctx, "")
+	fail := func(err error) <-chan *DeliveryReport {
+		span.RecordError(err)
+		span.End()
+		report.Err = err
+		result <- report
+		return result
+	}
+
+	// Encode the message once for all subscribers with the codec of the topic
+	payload, err := t.GetCodec().Encode(msg)
+	if err != nil {
+		return fail(err)
+	}
+
+	// Send the JSON data to all clients and collect the results
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	m, err := t.enqueueUpdate(ctx, "", payload, func(m *message, subscribers map[string]*Client) func(*Client, DeliveryStatus) {
+		report.Seq = m.seq
+		span.SetAttributes(Attr(AttrSeq, m.seq))
+		wg.Add(len(subscribers))
+		return func(c *Client, status DeliveryStatus) {
+			span.AddEvent(EventEnqueue, Attr(AttrClientID, c.GetID()), Attr(AttrStatus, string(status)))
+			lock.Lock()
+			report.Clients[c.GetID()] = status
+			lock.Unlock()
+			wg.Done()
+		}
+	})
+	if err != nil {
+		return fail(err)
+	}
+	t.metrics().addPublished(topicType(t.GetType()))
+	t.service().emitOnPublish(PublishEvent{Topic: t, Seq: m.seq, Event: m.event, Data: m.payload})
+
+	go func() {
+		wg.Wait()
+		span.End()
+		result <- report
+	}()
+
+	// Inform the other instances about the update
+	t.publishBackplane(m)
+
+	return result
+}
@@ -1,7 +1,10 @@
 package pubsubsse
 
 import (
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 // Tests for:
@@ -11,6 +14,10 @@ import (
 // +GetClients(): map[string]*client
 // +IsSubscribed(c *client): bool
 // +Pub(msg interface): error
+// +PubAsync(msg interface): <-chan *DeliveryReport
+// +SetRetained(retained bool)
+// +IsRetained(): bool
+// +ClearRetained()
 // -addClient(c *client)
 // -removeClient(c *client)
 
@@ -218,4 +225,359 @@ func TestRemoveClient(t *testing.T) {
 	if len(topic.GetClients()) != 0 {
 		t.Error("Expected topic to have no clients")
 	}
-}
\ No newline at end of file
+}
+
+// TestPub_Hierarchy tests that subscribers of a parent topic receive updates of all subtopics.
+func TestPub_Hierarchy(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	c1 := ssePubSub.NewClient()
+	c2 := ssePubSub.NewClient()
+	setReceiving(c1)
+	setReceiving(c2)
+
+	server := ssePubSub.NewPublicTopic("server")
+	status := ssePubSub.NewPublicTopic("server/status")
+	other := ssePubSub.NewPublicTopic("serverx")
+
+	if err := c1.Sub(server); err != nil {
+		t.Fatal(err)
+	}
+	if err := c2.Sub(status); err != nil {
+		t.Fatal(err)
+	}
+
+	// Topic created after the subscription
+	load := ssePubSub.NewPublicTopic("server/cpu/load")
+	drainStream(t, c1)
+	drainStream(t, c2)
+
+	status.Pub("up")
+	load.Pub(42)
+	other.Pub("other")
+	server.Pub("server")
+
+	data1 := drainStream(t, c1)
+	if len(getUpdates(data1, "server/status")) != 1 {
+		t.Error("Expected c1 to receive server/status")
+	}
+	if len(getUpdates(data1, "server/cpu/load")) != 1 {
+		t.Error("Expected c1 to receive server/cpu/load")
+	}
+	if len(getUpdates(data1, "server")) != 1 {
+		t.Error("Expected c1 to receive server")
+	}
+	if len(getUpdates(data1, "serverx")) != 0 {
+		t.Error("Expected c1 not to receive serverx")
+	}
+
+	data2 := drainStream(t, c2)
+	if len(getUpdates(data2, "server/status")) != 1 {
+		t.Error("Expected c2 to receive server/status")
+	}
+	if len(getUpdates(data2, "server")) != 0 || len(getUpdates(data2, "server/cpu/load")) != 0 {
+		t.Error("Expected c2 to only receive server/status")
+	}
+}
+
+// TestIsSubscribed_Hierarchy tests that subtopics of subscribed topics count as subscribed.
+func TestIsSubscribed_Hierarchy(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	c1 := ssePubSub.NewClient()
+
+	group := ssePubSub.NewGroup("group")
+	group.AddClient(c1)
+	parent := group.NewTopic("a")
+	if err := c1.Sub(parent); err != nil {
+		t.Fatal(err)
+	}
+	child := group.NewTopic("a/b/c")
+
+	if !child.IsSubscribed(c1) {
+		t.Error("Expected client to be subscribed to subtopic")
+	}
+	subscribed := c1.GetSubscribedTopics()
+	if len(subscribed) != 2 || subscribed["a/b/c"] != child {
+		t.Error("Expected subtopic in subscribed topics")
+	}
+
+	// A subtopic can not be unsubscribed on its own
+	if err := c1.Unsub(child); err == nil {
+		t.Error("Expected error when unsubscribing from a subtopic")
+	}
+
+	if err := c1.Unsub(parent); err != nil {
+		t.Fatal(err)
+	}
+	if child.IsSubscribed(c1) {
+		t.Error("Expected client not to be subscribed to subtopic")
+	}
+}
+
+// TestPub_NonBlocking tests that a slow client does not block the publisher
+// and does not lose the order of its messages.
+func TestPub_NonBlocking(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("test")
+
+	slow := ssePubSub.NewClient()
+	slow.SetStreamOptions(StreamOptions{BufferSize: 1, Policy: BlockWithTimeout, BlockTimeout: time.Second})
+	slow.Sub(topic)
+	setReceiving(slow)
+
+	fast := ssePubSub.NewClient()
+	fast.Sub(topic)
+	setReceiving(fast)
+
+	start := time.Now()
+	topic.Pub(1)
+	topic.Pub(2)
+	topic.Pub(3)
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("Expected publisher not to be blocked by the slow client")
+	}
+	if n := len(getUpdates(drainStream(t, fast), "test")); n != 3 {
+		t.Errorf("Expected fast client to receive 3 updates got %d", n)
+	}
+
+	// The slow client gets the pending messages in order once it reads
+	values := []interface{}{}
+	for len(values) < 3 {
+		for _, u := range getUpdates(drainStream(t, slow), "test") {
+			values = append(values, u.Data)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if values[0] != 1.0 || values[1] != 2.0 || values[2] != 3.0 {
+		t.Errorf("Unexpected order %v", values)
+	}
+}
+
+// TestPubAsync tests the delivery report of PubAsync().
+func TestPubAsync(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("test")
+
+	receiving := ssePubSub.NewClient()
+	receiving.Sub(topic)
+	setReceiving(receiving)
+
+	waiting := ssePubSub.NewClient()
+	waiting.Sub(topic)
+
+	full := ssePubSub.NewClient()
+	full.SetStreamOptions(StreamOptions{BufferSize: 1, Policy: DropNewest})
+	full.Sub(topic)
+	setReceiving(full)
+	topic.Pub("fill")
+
+	report := <-topic.PubAsync("test")
+	if report.Err != nil {
+		t.Fatal(report.Err)
+	}
+	if report.Topic != "test" || report.Seq != 2 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if report.Clients[receiving.GetID()] != Delivered ||
+		report.Clients[waiting.GetID()] != NotReceiving ||
+		report.Clients[full.GetID()] != Dropped {
+		t.Errorf("Unexpected report %+v", report.Clients)
+	}
+	if report.Count(Delivered) != 1 || report.Count(Dropped) != 1 || report.Count(NotReceiving) != 1 {
+		t.Error("Unexpected counts")
+	}
+
+	// Not marshallable
+	report = <-topic.PubAsync(func() {})
+	if report.Err == nil {
+		t.Error("Expected error for invalid message")
+	}
+}
+
+// TestPub_Concurrent tests that concurrent publishers enqueue the updates in the order of their sequence numbers.
+func TestPub_Concurrent(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("test")
+	client := ssePubSub.NewClient()
+	client.SetStreamOptions(StreamOptions{BufferSize: 1000, Policy: DropNewest})
+	client.Sub(topic)
+	setReceiving(client)
+
+	// More subscribers make the window between numbering and enqueueing larger
+	for i := 0; i < 50; i++ {
+		other := ssePubSub.NewClient()
+		other.Sub(topic)
+		setReceiving(other)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				topic.Pub(j)
+			}
+		}()
+	}
+	wg.Wait()
+
+	msgs := client.stream.popAll()
+	if len(msgs) != 500 {
+		t.Fatalf("Expected 500 updates, got %d", len(msgs))
+	}
+	for i, m := range msgs {
+		if m.seq != uint64(i+1) {
+			t.Fatalf("Expected seq %d at position %d, got %d", i+1, i, m.seq)
+		}
+	}
+}
+
+// Subscribers for the publish benchmarks
+const benchmarkSubscribers = 1000
+
+// Create a topic with receiving subscribers
+func newBenchmarkTopic(b *testing.B) *Topic {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetDefaultStreamOptions(StreamOptions{BufferSize: 10, Policy: DropOldest})
+	topic := ssePubSub.NewPublicTopic("bench")
+	for i := 0; i < benchmarkSubscribers; i++ {
+		c := ssePubSub.NewClient()
+		if err := c.Sub(topic); err != nil {
+			b.Fatal(err)
+		}
+		setReceiving(c)
+	}
+	return topic
+}
+
+// Benchmark data which is expensive to marshal
+type benchmarkData struct {
+	Values []float64         `json:"values"`
+	Labels map[string]string `json:"labels"`
+}
+
+func newBenchmarkData() benchmarkData {
+	d := benchmarkData{Labels: map[string]string{}}
+	for i := 0; i < 100; i++ {
+		d.Values = append(d.Values, float64(i)/3)
+		d.Labels[strconv.Itoa(i)] = "label"
+	}
+	return d
+}
+
+// BenchmarkPub benchmarks Pub, which marshals the message once for all subscribers.
+func BenchmarkPub(b *testing.B) {
+	topic := newBenchmarkTopic(b)
+	data := newBenchmarkData()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		topic.Pub(data)
+	}
+}
+
+// BenchmarkPubMarshalPerClient benchmarks the previous approach,
+// which marshalled the message for every subscriber.
+func BenchmarkPubMarshalPerClient(b *testing.B) {
+	topic := newBenchmarkTopic(b)
+	data := newBenchmarkData()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fulldata := &eventData{
+			Updates: []eventDataUpdates{{Topic: topic.GetName(), Data: data}},
+		}
+		for _, c := range topic.getSubscribers() {
+			c.send(fulldata)
+		}
+	}
+}
+
+// TestRetained tests that the retained value is sent on subscribe.
+func TestRetained(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	status := ssePubSub.NewPublicTopic("server/status")
+	if status.IsRetained() {
+		t.Error("Expected topic not to be retained by default")
+	}
+	status.SetRetained(true)
+	status.Pub("up")
+	status.Pub("down")
+
+	// Subscribe to the topic
+	c1 := ssePubSub.NewClient()
+	setReceiving(c1)
+	if err := c1.Sub(status); err != nil {
+		t.Fatal(err)
+	}
+	updates := getUpdates(drainStream(t, c1), "server/status")
+	if len(updates) != 1 || updates[0].Data != "down" {
+		t.Errorf("Expected retained value got %v", updates)
+	}
+
+	// Subscribe to the parent topic
+	c2 := ssePubSub.NewClient()
+	setReceiving(c2)
+	if err := c2.Sub(ssePubSub.NewPublicTopic("server")); err != nil {
+		t.Fatal(err)
+	}
+	if len(getUpdates(drainStream(t, c2), "server/status")) != 1 {
+		t.Error("Expected retained value of subtopic")
+	}
+
+	// Subscribe to a pattern
+	c3 := ssePubSub.NewClient()
+	setReceiving(c3)
+	if err := c3.SubPattern("+/status"); err != nil {
+		t.Fatal(err)
+	}
+	if len(getUpdates(drainStream(t, c3), "server/status")) != 1 {
+		t.Error("Expected retained value of matching topic")
+	}
+
+	// Clear the retained value
+	status.ClearRetained()
+	c4 := ssePubSub.NewClient()
+	setReceiving(c4)
+	c4.Sub(status)
+	if len(getUpdates(drainStream(t, c4), "server/status")) != 0 {
+		t.Error("Expected no retained value after clearing it")
+	}
+
+	// Disable retaining
+	status.Pub("up")
+	status.SetRetained(false)
+	status.Pub("down")
+	c5 := ssePubSub.NewClient()
+	setReceiving(c5)
+	c5.Sub(status)
+	if len(getUpdates(drainStream(t, c5), "server/status")) != 0 {
+		t.Error("Expected no retained value after disabling it")
+	}
+}
+
+// TestRetained_InitMSG tests that the init message contains the retained values.
+func TestRetained_InitMSG(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	status := ssePubSub.NewPublicTopic("server/status")
+	status.SetRetained(true)
+	status.Pub("up")
+	other := ssePubSub.NewPublicTopic("other")
+	other.SetRetained(true)
+	other.Pub("other")
+
+	client := ssePubSub.NewClient()
+	client.Sub(status)
+
+	frames := []string{}
+	if err := client.sendInitMSG(func(msg string) { frames = append(frames, msg) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 {
+		t.Fatal("Expected one init frame")
+	}
+	_, data := parseFrame(t, frames[0])
+	if len(data.Updates) != 1 || data.Updates[0].Topic != "server/status" || data.Updates[0].Data != "up" {
+		t.Errorf("Unexpected updates in init message %v", data.Updates)
+	}
+}
@@ -0,0 +1,114 @@
+package pubsubsse
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Defaults of the topic name rules
+const (
+	DefaultTopicMaxLength = 256
+	DefaultTopicMaxDepth  = 16
+)
+
+// TopicRules configures which topic names are valid.
+type TopicRules struct {
+	// MaxLength is the maximum length of the name in characters. 0 means no limit.
+	MaxLength int
+	// MaxDepth is the maximum number of levels, e.g. 3 for "a/b/c". 0 means no limit.
+	MaxDepth int
+	// AllowedChar reports whether a character may be used in a level.
+	// nil allows letters, digits and underscores.
+	AllowedChar func(r rune) bool
+}
+
+// DefaultTopicRules returns the topic name rules of a new service.
+func DefaultTopicRules() TopicRules {
+	return TopicRules{
+		MaxLength: DefaultTopicMaxLength,
+		MaxDepth:  DefaultTopicMaxDepth,
+	}
+}
+
+// Letters, digits and underscores
+func defaultAllowedChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Canonicalize returns the canonical form of a topic name, or an error wrapping
+// ErrInvalidTopic if the name is not valid.
+// Leading and trailing slashes are removed and repeated slashes are collapsed,
+// so "/server//status/" becomes "server/status".
+// The wildcards "+" and "#" are never allowed in topic names.
+func (r TopicRules) Canonicalize(name string) (string, error) {
+	levels := []string{}
+	for _, level := range strings.Split(name, "/") {
+		if level != "" {
+			levels = append(levels, level)
+		}
+	}
+	canonical := strings.Join(levels, "/")
+
+	if canonical == "" {
+		return "", detailError(ErrInvalidTopic, "topic name is empty")
+	}
+	if r.MaxLength > 0 && utf8.RuneCountInString(canonical) > r.MaxLength {
+		return "", detailError(ErrInvalidTopic, "topic %s is longer than %d characters", canonical, r.MaxLength)
+	}
+	if r.MaxDepth > 0 && len(levels) > r.MaxDepth {
+		return "", detailError(ErrInvalidTopic, "topic %s has more than %d levels", canonical, r.MaxDepth)
+	}
+
+	allowed := r.AllowedChar
+	if allowed == nil {
+		allowed = defaultAllowedChar
+	}
+	for _, c := range canonical {
+		if c == '/' {
+			continue
+		}
+		if strings.ContainsRune(WildcardSingleLevel+WildcardMultiLevel, c) || !allowed(c) {
+			return "", detailError(ErrInvalidTopic, "topic %s contains the character %q", canonical, c)
+		}
+	}
+
+	return canonical, nil
+}
+
+// Get the topic name rules
+func (s *SSEPubSubService) GetTopicRules() TopicRules {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.topicRules
+}
+
+// Set the topic name rules. They apply to topics created from now on.
+func (s *SSEPubSubService) SetTopicRules(r TopicRules) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.topicRules = r
+}
+
+// Get the canonical name to look a topic up with. The handlers also authorize with it,
+// so the authorizer sees the name of the topic which is used.
+// A name which is not valid (e.g. a pattern) can not be canonicalized and is returned as it is.
+func lookupTopicName(scope topicScope, name string) string {
+	if canonical, err := canonicalTopicName(scope, name); err == nil {
+		return canonical
+	}
+	return name
+}
+
+// Canonicalize a topic name with the rules of the service of the scope
+func canonicalTopicName(scope topicScope, name string) (string, error) {
+	rules := DefaultTopicRules()
+	if scope != nil {
+		if s := scope.scopeService(); s != nil {
+			rules = s.GetTopicRules()
+		}
+	}
+	return rules.Canonicalize(name)
+}
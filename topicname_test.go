@@ -0,0 +1,184 @@
+package pubsubsse
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Tests for:
+// +Canonicalize(name string): string, error
+// +SetTopicRules(r TopicRules)
+// +GetTopicRules(): TopicRules
+// +CreatePublicTopic(name string): *Topic, error
+// +CreatePrivateTopic(name string): *Topic, error
+// +CreateTopic(name string): *Topic, error
+
+func TestTopicRules_Canonicalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		valid    bool
+	}{
+		{"server/status", "server/status", true},
+		{"/server//status/", "server/status", true},
+		{"Räume_1/temp", "Räume_1/temp", true},
+		{"", "", false},
+		{"//", "", false},
+		{"server/+", "", false},
+		{"server/#", "", false},
+		{"server status", "", false},
+		{"server.status", "", false},
+		{strings.Repeat("a", DefaultTopicMaxLength+1), "", false},
+		{strings.Repeat("a/", DefaultTopicMaxDepth) + "a", "", false},
+	}
+
+	rules := DefaultTopicRules()
+	for _, test := range tests {
+		name, err := rules.Canonicalize(test.name)
+		if test.valid && (err != nil || name != test.expected) {
+			t.Errorf("Expected %q to be canonicalized to %q, got %q %v", test.name, test.expected, name, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidTopic) {
+			t.Errorf("Expected %q to be invalid, got %q %v", test.name, name, err)
+		}
+	}
+
+	// Custom rules
+	rules = TopicRules{
+		MaxLength:   5,
+		MaxDepth:    2,
+		AllowedChar: func(r rune) bool { return r >= 'a' && r <= 'z' || r == '-' },
+	}
+	if name, err := rules.Canonicalize("a-b/c"); err != nil || name != "a-b/c" {
+		t.Errorf("Expected a-b/c to be valid, got %q %v", name, err)
+	}
+	for _, name := range []string{"abcdef", "a/b/c", "A", "a/+"} {
+		if _, err := rules.Canonicalize(name); err == nil {
+			t.Errorf("Expected %q to be invalid", name)
+		}
+	}
+}
+
+func TestSSEPubSubService_CreatePublicTopic(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+
+	topic, err := ssePubSub.CreatePublicTopic("/server//status/")
+	if err != nil || topic.GetName() != "server/status" {
+		t.Fatalf("Expected topic server/status, got %v %v", topic, err)
+	}
+	if same, _ := ssePubSub.CreatePublicTopic("server/status"); same != topic {
+		t.Error("Expected the existing topic for the canonical name")
+	}
+
+	if _, err := ssePubSub.CreatePublicTopic("server/+"); !errors.Is(err, ErrInvalidTopic) {
+		t.Errorf("Expected ErrInvalidTopic, got %v", err)
+	}
+	if topic := ssePubSub.NewPublicTopic(""); topic != nil {
+		t.Error("Expected no topic for an empty name")
+	}
+	if len(ssePubSub.GetPublicTopics()) != 1 {
+		t.Errorf("Expected 1 topic, got %d", len(ssePubSub.GetPublicTopics()))
+	}
+
+	// Rules of the service
+	ssePubSub.SetTopicRules(TopicRules{MaxDepth: 1})
+	if ssePubSub.GetTopicRules().MaxDepth != 1 {
+		t.Error("Expected the rules to be set")
+	}
+	if _, err := ssePubSub.CreatePublicTopic("a/b"); err == nil {
+		t.Error("Expected error for too many levels")
+	}
+}
+
+func TestClient_CreatePrivateTopic(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+
+	topic, err := client.CreatePrivateTopic("private/")
+	if err != nil || topic.GetName() != "private" {
+		t.Fatalf("Expected topic private, got %v %v", topic, err)
+	}
+	if _, err := client.CreatePrivateTopic("a b"); !errors.Is(err, ErrInvalidTopic) {
+		t.Errorf("Expected ErrInvalidTopic, got %v", err)
+	}
+	if client.NewPrivateTopic("#") != nil {
+		t.Error("Expected no topic for a wildcard")
+	}
+}
+
+func TestGroup_CreateTopic(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	group := ssePubSub.NewGroup("group")
+
+	topic, err := group.CreateTopic("rooms//1")
+	if err != nil || topic.GetName() != "rooms/1" {
+		t.Fatalf("Expected topic rooms/1, got %v %v", topic, err)
+	}
+	if _, err := group.CreateTopic(""); !errors.Is(err, ErrInvalidTopic) {
+		t.Errorf("Expected ErrInvalidTopic, got %v", err)
+	}
+	if group.NewTopic("") != nil {
+		t.Error("Expected no topic for an empty name")
+	}
+}
+
+// TestTopicByName_Canonicalize tests that the lookups find topics by names which are not canonical.
+func TestTopicByName_Canonicalize(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	public := ssePubSub.NewPublicTopic("server/status")
+	client := ssePubSub.NewClient()
+	private := client.NewPrivateTopic("private")
+	group := ssePubSub.NewGroup("group")
+	groupTopic := group.NewTopic("rooms/1")
+	group.AddClient(client)
+
+	if t2, ok := ssePubSub.GetPublicTopicByName("/server//status/"); !ok || t2 != public {
+		t.Error("Expected the public topic for a non-canonical name")
+	}
+	if t2, ok := client.GetPrivateTopicByName("private/"); !ok || t2 != private {
+		t.Error("Expected the private topic for a non-canonical name")
+	}
+	if t2, ok := group.GetTopicByName("rooms//1"); !ok || t2 != groupTopic {
+		t.Error("Expected the group topic for a non-canonical name")
+	}
+	if t2, ok := client.GetTopicByName("/rooms/1"); !ok || t2 != groupTopic {
+		t.Error("Expected the topic of the client for a non-canonical name")
+	}
+	if _, ok := client.GetTopicByName("server/+"); ok {
+		t.Error("Expected no topic for a pattern")
+	}
+}
+
+func TestAddPublicTopic_Canonicalize(t *testing.T) {
+	s := NewSSEPubSubService()
+
+	// The authorizer sees the canonical name
+	var authorized string
+	s.SetAuthorizer(AuthorizerFunc(func(r *http.Request, req *AuthRequest) error {
+		authorized = req.Topic
+		return nil
+	}))
+
+	code, body := doRequest(s, AddPublicTopic, "/add/topic/public?topic=/news//today/", nil)
+	if code != http.StatusOK || body.TopicName != "news/today" || authorized != "news/today" {
+		t.Errorf("Expected topic news/today, got %d %+v, authorized %s", code, body, authorized)
+	}
+
+	code, body = doRequest(s, AddPublicTopic, "/add/topic/public?topic=news/%2B", nil)
+	if code != http.StatusBadRequest || body.errorCode() != CodeInvalidTopic {
+		t.Errorf("Expected 400 invalid_topic, got %d %+v", code, body.Error)
+	}
+
+	// Subscriptions find the topic by a non-canonical name and authorize the canonical one
+	client := s.NewClient()
+	code, body = doRequest(s, Subscribe, "/sub?client_id="+client.GetID()+"&topic=/news/today", nil)
+	if code != http.StatusOK || authorized != "news/today" {
+		t.Errorf("Expected subscription of news/today, got %d %+v, authorized %s", code, body.Error, authorized)
+	}
+	code, body = doRequest(s, Unsubscribe, "/unsub?client_id="+client.GetID()+"&topic=news//today/", nil)
+	if code != http.StatusOK || authorized != "news/today" {
+		t.Errorf("Expected unsubscription of news/today, got %d %+v, authorized %s", code, body.Error, authorized)
+	}
+}
@@ -0,0 +1,111 @@
+package pubsubsse
+
+import "context"
+
+// Names of the spans and span events
+const (
+	// SpanPublish is started by Pub and its variants. It ends when the update was handed to every subscriber.
+	SpanPublish = "pubsub.publish"
+	// SpanDeliver is started when an update is sent to a client. It is a child of the publish span.
+	SpanDeliver = "pubsub.deliver"
+	// EventEnqueue is added to the publish span for every subscriber, with its client ID and delivery status.
+	EventEnqueue = "pubsub.enqueue"
+	// EventFlush is added to the deliver span when the update was written to the connection of the client.
+	EventFlush = "pubsub.flush"
+)
+
+// Keys of the span attributes
+const (
+	AttrTopic     = "pubsub.topic"
+	AttrTopicType = "pubsub.topic_type"
+	AttrEvent     = "pubsub.event"
+	AttrSeq       = "pubsub.seq"
+	AttrClientID  = "pubsub.client_id"
+	AttrStatus    = "pubsub.status"
+	AttrBackplane = "pubsub.backplane"
+)
+
+// Attribute is a key-value pair of a span or span event.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr creates an attribute.
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Tracer starts spans, e.g. an adapter to an OpenTelemetry trace.Tracer.
+// Start returns a context which carries the new span, so spans started with it are its children.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a traced operation started by a Tracer.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	AddEvent(name string, attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Span which records nothing. It is used if no tracer is set.
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(attrs ...Attribute)         {}
+func (nopSpan) AddEvent(name string, attrs ...Attribute) {}
+func (nopSpan) RecordError(err error)                    {}
+func (nopSpan) End()                                     {}
+
+// Get the tracer. nil if tracing is disabled.
+func (s *SSEPubSubService) GetTracer() Tracer {
+	s.tracerLock.RLock()
+	defer s.tracerLock.RUnlock()
+
+	return s.tracer
+}
+
+// Set the tracer. nil disables tracing, which is the default.
+// The context of a traced update is kept with the update until it was delivered
+// and, for replays, in the history of the topic.
+func (s *SSEPubSubService) SetTracer(tr Tracer) {
+	s.tracerLock.Lock()
+	defer s.tracerLock.Unlock()
+
+	s.tracer = tr
+}
+
+// Get the tracer of the service of the topic
+func (t *Topic) tracer() Tracer {
+	if s := t.service(); s != nil {
+		return s.GetTracer()
+	}
+	return nil
+}
+
+// Start the publish span of an update.
+// The returned context is nil if tracing is disabled, so the update carries no context.
+func (t *Topic) startPublishSpan(ctx context.Context, event string) (context.Context, Span) {
+	tr := t.tracer()
+	if tr == nil {
+		return nil, nopSpan{}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return tr.Start(ctx, SpanPublish, Attr(AttrTopic, t.GetName()), Attr(AttrTopicType, t.GetType()), Attr(AttrEvent, event))
+}
+
+// Start the deliver span of an update sent to the client. It is a child of the publish span.
+func (c *Client) startDeliverSpan(m *message) Span {
+	if m.ctx == nil || c.sSEPubSubService == nil {
+		return nopSpan{}
+	}
+	tr := c.sSEPubSubService.GetTracer()
+	if tr == nil {
+		return nopSpan{}
+	}
+	_, span := tr.Start(m.ctx, SpanDeliver, Attr(AttrClientID, c.GetID()), Attr(AttrTopic, m.topic), Attr(AttrSeq, m.seq))
+	return span
+}
@@ -0,0 +1,214 @@
+package pubsubsse
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// Tests for:
+// +SetTracer(tr Tracer)
+// +PubContext(ctx Context, msg interface): error
+// +PubRawContext(ctx Context, data []byte): error
+// +PubAsyncContext(ctx Context, msg interface): <-chan *DeliveryReport
+
+// Span recorded by the memoryTracer
+type memorySpan struct {
+	tracer *memoryTracer
+	name   string
+	parent *memorySpan
+	attrs  map[string]interface{}
+	events []memoryEvent
+	err    error
+	ended  bool
+}
+
+// Event of a memorySpan
+type memoryEvent struct {
+	name  string
+	attrs map[string]interface{}
+}
+
+// In-memory exporter which records all spans
+type memoryTracer struct {
+	lock  sync.Mutex
+	spans []*memorySpan
+}
+
+type memorySpanKey struct{}
+
+func attrMap(attrs []Attribute) map[string]interface{} {
+	m := map[string]interface{}{}
+	for _, a := range attrs {
+		m[a.Key] = a.Value
+	}
+	return m
+}
+
+func (tr *memoryTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent, _ := ctx.Value(memorySpanKey{}).(*memorySpan)
+	span := &memorySpan{tracer: tr, name: name, parent: parent, attrs: attrMap(attrs)}
+
+	tr.lock.Lock()
+	tr.spans = append(tr.spans, span)
+	tr.lock.Unlock()
+
+	return context.WithValue(ctx, memorySpanKey{}, span), span
+}
+
+func (s *memorySpan) SetAttributes(attrs ...Attribute) {
+	s.tracer.lock.Lock()
+	defer s.tracer.lock.Unlock()
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *memorySpan) AddEvent(name string, attrs ...Attribute) {
+	s.tracer.lock.Lock()
+	defer s.tracer.lock.Unlock()
+	s.events = append(s.events, memoryEvent{name: name, attrs: attrMap(attrs)})
+}
+
+func (s *memorySpan) RecordError(err error) {
+	s.tracer.lock.Lock()
+	defer s.tracer.lock.Unlock()
+	s.err = err
+}
+
+func (s *memorySpan) End() {
+	s.tracer.lock.Lock()
+	defer s.tracer.lock.Unlock()
+	s.ended = true
+}
+
+// Get the recorded spans with the name
+func (tr *memoryTracer) find(name string) []*memorySpan {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+
+	found := []*memorySpan{}
+	for _, s := range tr.spans {
+		if s.name == name {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+func TestTopic_PubContext(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	tracer := &memoryTracer{}
+	ssePubSub.SetTracer(tracer)
+	topic := ssePubSub.NewPublicTopic("news")
+
+	receiving := ssePubSub.NewClient()
+	receiving.Sub(topic)
+	receiving.Poll(context.Background(), "", 0)
+	waiting := ssePubSub.NewClient()
+	waiting.Sub(topic)
+
+	// The trace of the request continues into the publish span
+	ctx, request := tracer.Start(context.Background(), "http.request")
+	if err := topic.PubContext(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := tracer.find(SpanPublish)
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 publish span, got %d", len(spans))
+	}
+	publish := spans[0]
+	tracer.lock.Lock()
+	if publish.parent != request || !publish.ended || publish.attrs[AttrTopic] != "news" || publish.attrs[AttrSeq] != uint64(1) {
+		t.Errorf("Unexpected publish span %+v", publish)
+	}
+
+	// One enqueue event per subscriber
+	statuses := map[interface{}]interface{}{}
+	for _, e := range publish.events {
+		if e.name == EventEnqueue {
+			statuses[e.attrs[AttrClientID]] = e.attrs[AttrStatus]
+		}
+	}
+	tracer.lock.Unlock()
+	if statuses[receiving.GetID()] != string(Delivered) || statuses[waiting.GetID()] != string(NotReceiving) {
+		t.Errorf("Unexpected enqueue events %v", statuses)
+	}
+
+	// The delivery is a child of the publish span
+	receiving.Poll(context.Background(), "", 0)
+	spans = tracer.find(SpanDeliver)
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 deliver span, got %d", len(spans))
+	}
+	deliver := spans[0]
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	if deliver.parent != publish || !deliver.ended || deliver.attrs[AttrClientID] != receiving.GetID() {
+		t.Errorf("Unexpected deliver span %+v", deliver)
+	}
+	if len(deliver.events) != 1 || deliver.events[0].name != EventFlush {
+		t.Errorf("Expected flush event, got %+v", deliver.events)
+	}
+}
+
+func TestTopic_PubContext_Error(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	tracer := &memoryTracer{}
+	ssePubSub.SetTracer(tracer)
+	topic := ssePubSub.NewPublicTopic("news")
+
+	if err := topic.PubContext(context.Background(), make(chan int)); err == nil {
+		t.Fatal("Expected error for a message which can not be encoded")
+	}
+	if err := topic.PubRawContext(context.Background(), []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := tracer.find(SpanPublish)
+	if len(spans) != 2 || spans[0].err == nil || !spans[0].ended || spans[1].err != nil || !spans[1].ended {
+		t.Errorf("Unexpected publish spans %+v", spans)
+	}
+}
+
+func TestTopic_PubAsyncContext(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	tracer := &memoryTracer{}
+	ssePubSub.SetTracer(tracer)
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	client.Sub(topic)
+	client.Poll(context.Background(), "", 0)
+
+	ctx, request := tracer.Start(context.Background(), "http.request")
+	if report := <-topic.PubAsyncContext(ctx, "a"); report.Err != nil {
+		t.Fatal(report.Err)
+	}
+
+	spans := tracer.find(SpanPublish)
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 publish span, got %d", len(spans))
+	}
+	tracer.lock.Lock()
+	defer tracer.lock.Unlock()
+	if spans[0].parent != request || !spans[0].ended {
+		t.Errorf("Unexpected publish span %+v", spans[0])
+	}
+}
+
+func TestTopic_Pub_NoTracer(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	client.Sub(topic)
+	client.Poll(context.Background(), "", 0)
+
+	// Without a tracer the updates carry no context
+	topic.Pub("a")
+	for _, m := range client.stream.popAll() {
+		if m.ctx != nil {
+			t.Error("Expected no trace context")
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package pubsubsse
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes (RFC 6455)
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+)
+
+// GUID to compute Sec-WebSocket-Accept
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Max size of a message received from the browser
+const wsMaxMessageSize = 1 << 20
+
+// Max payload size of a control frame (RFC 6455 5.5)
+const wsMaxControlSize = 125
+
+// Deadline for writing a frame. A browser which does not read blocks the stream at most this long.
+const wsWriteTimeout = 10 * time.Second
+
+// Close status codes (RFC 6455 7.4.1)
+var (
+	wsCloseNormal   = []byte{0x03, 0xe8} // 1000: normal closure
+	wsCloseProtocol = []byte{0x03, 0xea} // 1002: protocol error
+	wsCloseTooBig   = []byte{0x03, 0xf1} // 1009: message too big
+)
+
+// errWSProtocol is returned if the browser violates the WebSocket protocol. The connection is closed with 1002.
+var errWSProtocol = errors.New("websocket: protocol error")
+
+// errWSTooBig is returned if a message of the browser is bigger than wsMaxMessageSize. The connection is closed with 1009.
+var errWSTooBig = errors.New("websocket: message too big")
+
+// WebSocketCommand is a command the browser sends over the WebSocket.
+//
+//	{"action": "subscribe", "topic": "server/status"}
+//	{"action": "unsubscribe", "topic": "server/#"}
+//	{"action": "ping"}
+type WebSocketCommand struct {
+	Action string `json:"action"`
+	Topic  string `json:"topic,omitempty"`
+}
+
+// wsConn is a server side WebSocket connection
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeLock sync.Mutex
+	// closeSent is true once a close frame was sent. No frames are sent after it.
+	closeSent bool
+}
+
+// Get the origins which may open a WebSocket besides the own one
+func (s *SSEPubSubService) GetWebSocketOrigins() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string(nil), s.webSocketOrigins...)
+}
+
+// Set the origins which may open a WebSocket besides the own one, e.g. "https://app.example.com".
+// "*" allows every origin. By default only pages of the same host may connect, a request without
+// Origin header (not sent by a browser) is always accepted.
+func (s *SSEPubSubService) SetWebSocketOrigins(origins ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.webSocketOrigins = append([]string(nil), origins...)
+}
+
+// Check if the Origin of the request may open a WebSocket.
+// Browsers do not apply the same-origin policy to WebSockets, without the check every page could
+// connect with the cookies of the user.
+func (s *SSEPubSubService) checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range s.GetWebSocketOrigins() {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebSocket handles the WebSocket connection of a client.
+// It is an alternative to Event for environments which break SSE.
+// The client receives the same JSON messages as over the SSE stream (one text message per frame)
+// and can subscribe and unsubscribe topics and patterns over the same connection.
+// 0. Check the origin, authorize and find the client
+// 1. Upgrade the connection
+// 2. Read the commands of the browser
+// 3. Start the client and send its messages over the connection
+// 4. Close the connection if the client stops or the browser closes it
+func WebSocket(s *SSEPubSubService, w http.ResponseWriter, r *http.Request) {
+	clientID := r.URL.Query().Get("client_id")
+
+	if !s.checkWebSocketOrigin(r) {
+		writeError(s, w, detailError(ErrForbidden, "origin %s is not allowed", r.Header.Get("Origin")))
+		return
+	}
+
+	if !authorize(s, w, r, &AuthRequest{Action: ActionConnect, ClientID: clientID}) {
+		return
+	}
+
+	// Get the client
+	client, ok := s.GetClientByID(clientID)
+	if !ok {
+		writeError(s, w, ErrClientNotFound)
+		return
+	}
+
+	// Test if client is already receiving. With takeover the new stream replaces the old one.
+	if client.GetStatus() == Receving && !s.GetTakeover() {
+		writeError(s, w, ErrAlreadyReceiving)
+		return
+	}
+
+	// Test if the service is shut down
+	if s.isClosed() {
+		writeError(s, w, ErrServiceClosed)
+		return
+	}
+
+	// Upgrade the connection
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		writeError(s, w, detailError(ErrInvalidRequest, "%s", err))
+		return
+	}
+	defer ws.conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// Read the commands of the browser until the connection is closed
+	go func() {
+		defer cancel()
+		err := ws.readLoop(func(data []byte) {
+			handleWebSocketCommand(s, client, r, data)
+		})
+		if err != nil {
+			s.GetLogger().Debug("WebSocket closed", logKeyClientID, clientID, logKeyError, err)
+		}
+	}()
+
+	// Send the messages of the client. The JSON envelope is sent as text message.
+	// A failing write ends the stream.
+	client.resume(ctx, r.URL.Query().Get("last_event_id"), WireEnvelope, func(frame string) {
+		opcode, payload, ok := sseToWebSocket(frame)
+		if !ok {
+			return
+		}
+		if err := ws.writeFrame(opcode, payload); err != nil {
+			s.GetLogger().Debug("Error writing to WebSocket", logKeyClientID, clientID, logKeyError, err)
+			cancel()
+		}
+	})
+
+	// Close the connection, unless the close frame was already sent by readLoop
+	ws.writeFrame(wsOpClose, wsCloseNormal)
+}
+
+// Upgrade the HTTP connection to a WebSocket
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if r.Method != http.MethodGet {
+		return nil, errors.New("websocket: method must be GET")
+	}
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || !headerContains(r.Header, "Connection", "upgrade") {
+		return nil, errors.New("websocket: not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, errors.New("websocket: unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, errors.New("websocket: missing key")
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: %s", err)
+	}
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, reader: rw.Reader}, nil
+}
+
+// Compute the Sec-WebSocket-Accept of a key
+func wsAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Check if a comma separated header contains the token
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Convert an SSE frame into a WebSocket message.
+// The data lines are sent as text message, heartbeat comments as ping.
+// The id of the frame is added to the JSON message as "id", so the browser can
+// reconnect with it as last_event_id.
+// Frames without data (e.g. the retry directive) are skipped.
+func sseToWebSocket(frame string) (opcode byte, payload []byte, ok bool) {
+	if strings.HasPrefix(frame, ":") {
+		return wsOpPing, nil, true
+	}
+
+	data, ok := sseData(frame)
+	if !ok {
+		return 0, nil, false
+	}
+	if id := sseID(frame); id != "" && strings.HasPrefix(data, "{") {
+		quoted, _ := json.Marshal(id)
+		field := `{"id":` + string(quoted)
+		if rest := strings.TrimSpace(data[1:]); !strings.HasPrefix(rest, "}") {
+			field += ","
+		}
+		data = field + data[1:]
+	}
+	return wsOpText, []byte(data), true
+}
+
+// Get the id of an SSE frame, "" if it has none
+func sseID(frame string) string {
+	for _, line := range strings.Split(frame, "\n") {
+		if strings.HasPrefix(line, "id: ") {
+			return strings.TrimPrefix(line, "id: ")
+		}
+	}
+	return ""
+}
+
+// Write an unmasked frame. After a close frame no frames are written anymore.
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	ws.writeLock.Lock()
+	defer ws.writeLock.Unlock()
+
+	if ws.closeSent {
+		return errors.New("websocket: close frame already sent")
+	}
+	if opcode == wsOpClose {
+		ws.closeSent = true
+	}
+
+	header := []byte{0x80 | opcode}
+	n := len(payload)
+	switch {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xffff:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	ws.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := ws.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Read a single frame. Frames of the browser have to be masked.
+// Frames with RSV bits (no extension is negotiated), reserved opcodes or invalid control frames
+// return an error wrapping errWSProtocol.
+func (ws *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(ws.reader, head); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0f
+	masked := head[1]&0x80 != 0
+
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, fmt.Errorf("%w: RSV bits are set", errWSProtocol)
+	}
+	switch opcode {
+	case wsOpContinuation, wsOpText, wsOpBinary, wsOpClose, wsOpPing, wsOpPong:
+	default:
+		return false, 0, nil, fmt.Errorf("%w: reserved opcode 0x%x", errWSProtocol, opcode)
+	}
+	n := uint64(head[1] & 0x7f)
+
+	switch n {
+	case 126:
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(ws.reader, b); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(b))
+	case 127:
+		b := make([]byte, 8)
+		if _, err := io.ReadFull(ws.reader, b); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(b)
+	}
+
+	if !masked {
+		return false, 0, nil, fmt.Errorf("%w: frame of the client is not masked", errWSProtocol)
+	}
+	// Control frames must not be fragmented and carry at most 125 bytes
+	if opcode&0x8 != 0 && (!fin || n > wsMaxControlSize) {
+		return false, 0, nil, fmt.Errorf("%w: invalid control frame", errWSProtocol)
+	}
+	if n > wsMaxMessageSize {
+		return false, 0, nil, errWSTooBig
+	}
+
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(ws.reader, mask); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// Read the messages of the browser until the connection is closed.
+// Control frames are answered, fragmented messages are joined.
+// A close frame of the browser is echoed. If the browser violates the protocol,
+// the connection is closed with 1002 (1009 if a message is too big).
+// The error why the connection was closed is returned, nil if it was closed normally.
+func (ws *wsConn) readLoop(onMessage func([]byte)) error {
+	err := ws.readMessages(onMessage)
+	switch {
+	case err == nil:
+	case errors.Is(err, errWSProtocol):
+		ws.writeFrame(wsOpClose, wsCloseProtocol)
+	case errors.Is(err, errWSTooBig):
+		ws.writeFrame(wsOpClose, wsCloseTooBig)
+	case err == io.EOF || errors.Is(err, net.ErrClosed):
+		return nil
+	}
+	return err
+}
+
+// Read the messages of the browser until it sends a close frame
+func (ws *wsConn) readMessages(onMessage func([]byte)) error {
+	var message []byte
+	fragmented := false
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return err
+		}
+
+		switch opcode {
+		case wsOpPing:
+			ws.writeFrame(wsOpPong, payload)
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			// Echo the status code
+			if len(payload) == 1 {
+				return fmt.Errorf("%w: invalid close frame", errWSProtocol)
+			}
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			ws.writeFrame(wsOpClose, payload)
+			return nil
+		case wsOpText, wsOpBinary:
+			if fragmented {
+				return fmt.Errorf("%w: new message before the fragmented message ended", errWSProtocol)
+			}
+			message = payload
+		case wsOpContinuation:
+			if !fragmented {
+				return fmt.Errorf("%w: continuation frame without a message", errWSProtocol)
+			}
+			if len(message)+len(payload) > wsMaxMessageSize {
+				return errWSTooBig
+			}
+			message = append(message, payload...)
+		}
+
+		fragmented = !fin
+		if fin {
+			onMessage(message)
+			message = nil
+		}
+	}
+}
+
+// Handle a command of the browser. Errors are sent back as sys "error" message.
+func handleWebSocketCommand(s *SSEPubSubService, client *Client, r *http.Request, data []byte) {
+	cmd := &WebSocketCommand{}
+	if err := json.Unmarshal(data, cmd); err != nil {
+		client.sendError("", detailError(ErrInvalidRequest, "invalid command"))
+		return
+	}
+
+	switch cmd.Action {
+	case "ping":
+		if err := client.send(&eventData{Sys: []eventDataSys{{Type: "pong"}}}); err != nil {
+			s.GetLogger().Error("Error sending pong to client", logKeyClientID, client.GetID(), logKeyError, err)
+		}
+
+	case "subscribe", "unsubscribe":
+		cmd.Topic = lookupTopicName(s, cmd.Topic)
+
+		// The commands are authorized like the Subscribe and Unsubscribe handlers
+		if a := s.GetAuthorizer(); a != nil {
+			if err := a.Authorize(r, &AuthRequest{Action: ActionSubscribe, ClientID: client.GetID(), Topic: cmd.Topic}); err != nil {
+				client.sendError(cmd.Topic, authError(err))
+				return
+			}
+		}
+
+		var err error
+		if cmd.Action == "subscribe" {
+			err = subscribeTopicOrPattern(client, cmd.Topic)
+		} else {
+			err = unsubscribeTopicOrPattern(client, cmd.Topic)
+		}
+		if err != nil {
+			client.sendError(cmd.Topic, err)
+		}
+
+	default:
+		client.sendError("", detailError(ErrInvalidRequest, "unknown action %s", cmd.Action))
+	}
+}
+
+// sendError sends a message to the client to inform it about a failed command.
+// The error is described like in the JSON error responses of the HTTP handlers.
+func (c *Client) sendError(topic string, err error) {
+	_, detail := errorDetail(err)
+
+	fulldata := &eventData{
+		Sys: []eventDataSys{
+			{
+				Type: "error",
+				List: []eventDataSysList{
+					{
+						Name:  topic,
+						Error: detail.Message,
+						Code:  detail.Code,
+					},
+				},
+			},
+		},
+	}
+
+	if err := c.send(fulldata); err != nil {
+		c.logger().Error("Error sending error to client", logKeyClientID, c.GetID(), logKeyError, err)
+	}
+}
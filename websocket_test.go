@@ -0,0 +1,413 @@
+package pubsubsse
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests for:
+// +WebSocket(s *SSEPubSubService, w ResponseWriter, r *Request)
+// +SetWebSocketOrigins(origins ...string)
+// -sseToWebSocket(frame string): byte, []byte, bool
+// -wsAcceptKey(key string): string
+
+// Minimal WebSocket client for the tests
+type testWSClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Connect to the WebSocket handler
+func dialTestWS(t *testing.T, server *httptest.Server, clientID string) *testWSClient {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	req := "GET /ws?client_id=" + clientID + " HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Invalid Sec-WebSocket-Accept %s", resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+
+	return &testWSClient{conn: conn, reader: reader}
+}
+
+// Send a masked frame
+func (c *testWSClient) write(t *testing.T, opcode byte, payload []byte) {
+	c.writeRaw(t, 0x80|opcode, payload)
+}
+
+// Send a masked frame with the first byte head (FIN, RSV bits and opcode)
+func (c *testWSClient) writeRaw(t *testing.T, head byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{head}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Read a frame of the server
+func (c *testWSClient) read(t *testing.T) (byte, []byte) {
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, head); err != nil {
+		t.Fatal(err)
+	}
+	n := int(head[1] & 0x7f)
+	if n == 126 {
+		b := make([]byte, 2)
+		io.ReadFull(c.reader, b)
+		n = int(binary.BigEndian.Uint16(b))
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	return head[0] & 0x0f, payload
+}
+
+// Read frames until the close frame and check its status code
+func (c *testWSClient) expectClose(t *testing.T, code []byte) {
+	t.Helper()
+	for i := 0; i < 20; i++ {
+		opcode, payload := c.read(t)
+		if opcode != wsOpClose {
+			continue
+		}
+		if !bytes.Equal(payload, code) {
+			t.Errorf("Expected close code %x, got %x", code, payload)
+		}
+		return
+	}
+	t.Error("Connection was not closed")
+}
+
+// Read text messages until one matches
+func (c *testWSClient) waitFor(t *testing.T, match func(eventData) bool) eventData {
+	t.Helper()
+	for i := 0; i < 20; i++ {
+		opcode, payload := c.read(t)
+		if opcode != wsOpText {
+			continue
+		}
+		var data eventData
+		if err := json.Unmarshal(payload, &data); err != nil {
+			t.Fatalf("Invalid JSON message %s", payload)
+		}
+		if match(data) {
+			return data
+		}
+	}
+	t.Fatal("Message not received")
+	return eventData{}
+}
+
+// Check if the data contains a sys message of the type
+func hasSys(data eventData, typ string) bool {
+	for _, sys := range data.Sys {
+		if sys.Type == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func startWSServer(ssePubSub *SSEPubSubService) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) { WebSocket(ssePubSub, w, r) })
+	return httptest.NewServer(mux)
+}
+
+func TestWebSocket(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+
+	server := startWSServer(ssePubSub)
+	defer server.Close()
+
+	ws := dialTestWS(t, server, client.GetID())
+
+	// Init message
+	ws.waitFor(t, func(d eventData) bool { return hasSys(d, "topics") })
+
+	// Subscribe over the WebSocket
+	ws.write(t, wsOpText, []byte(`{"action":"subscribe","topic":"news"}`))
+	ws.waitFor(t, func(d eventData) bool { return hasSys(d, "subscribed") })
+	if !topic.IsSubscribed(client) {
+		t.Error("Client is not subscribed")
+	}
+
+	// Same JSON envelope as over SSE
+	topic.Pub("hello")
+	data := ws.waitFor(t, func(d eventData) bool { return len(d.Updates) > 0 })
+	if data.Updates[0].Topic != "news" || data.Updates[0].Data != "hello" {
+		t.Errorf("Unexpected update %v", data.Updates)
+	}
+
+	// Patterns
+	ws.write(t, wsOpText, []byte(`{"action":"subscribe","topic":"news/#"}`))
+	ws.waitFor(t, func(d eventData) bool { return hasSys(d, "subscribed_patterns") })
+
+	// Ping command and control frame
+	ws.write(t, wsOpText, []byte(`{"action":"ping"}`))
+	ws.waitFor(t, func(d eventData) bool { return hasSys(d, "pong") })
+	ws.write(t, wsOpPing, []byte("x"))
+	if opcode, payload := ws.read(t); opcode != wsOpPong || string(payload) != "x" {
+		t.Errorf("Expected pong, got %d %s", opcode, payload)
+	}
+
+	// Errors
+	ws.write(t, wsOpText, []byte(`{"action":"subscribe","topic":"unknown"}`))
+	data = ws.waitFor(t, func(d eventData) bool { return hasSys(d, "error") })
+	if data.Sys[0].List[0].Name != "unknown" || data.Sys[0].List[0].Error != "topic not found" {
+		t.Errorf("Unexpected error %v", data.Sys[0].List)
+	}
+
+	// Unsubscribe
+	ws.write(t, wsOpText, []byte(`{"action":"unsubscribe","topic":"news"}`))
+	ws.waitFor(t, func(d eventData) bool { return hasSys(d, "unsubscribed") })
+	if _, ok := topic.GetClients()[client.GetID()]; ok {
+		t.Error("Client is still subscribed")
+	}
+
+	// Closing the WebSocket stops the client
+	ws.write(t, wsOpClose, nil)
+	eventually(t, "Client is still receiving", func() bool { return client.GetStatus() == Waiting })
+}
+
+func TestWebSocket_RemoveClient(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+
+	server := startWSServer(ssePubSub)
+	defer server.Close()
+
+	ws := dialTestWS(t, server, client.GetID())
+	ws.waitFor(t, func(d eventData) bool { return true })
+
+	// The connection is closed if the client is removed
+	ssePubSub.RemoveClient(client)
+	for i := 0; i < 10; i++ {
+		if opcode, _ := ws.read(t); opcode == wsOpClose {
+			return
+		}
+	}
+	t.Error("Connection was not closed")
+}
+
+// TestWebSocket_ID tests that the messages carry the id to resume with.
+func TestWebSocket_ID(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	client.Sub(topic)
+
+	server := startWSServer(ssePubSub)
+	defer server.Close()
+
+	ws := dialTestWS(t, server, client.GetID())
+	ws.waitFor(t, func(d eventData) bool { return hasSys(d, "topics") })
+
+	topic.Pub("hello")
+	for i := 0; i < 20; i++ {
+		opcode, payload := ws.read(t)
+		if opcode != wsOpText || !strings.Contains(string(payload), "hello") {
+			continue
+		}
+		var msg struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			t.Fatalf("Invalid JSON message %s", payload)
+		}
+		if msg.ID != "news="+topic.epoch+".1" {
+			t.Errorf("Unexpected id %q", msg.ID)
+		}
+		return
+	}
+	t.Fatal("Message not received")
+}
+
+func TestWebSocket_Origin(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+
+	request := func(origin string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "http://localhost/ws?client_id="+client.GetID(), nil)
+		r.Header.Set("Origin", origin)
+		WebSocket(ssePubSub, w, r)
+		return w.Code
+	}
+
+	// Other origins are refused before the upgrade, the own one reaches it
+	if code := request("https://evil.example"); code != http.StatusForbidden {
+		t.Errorf("Expected 403, got %d", code)
+	}
+	if code := request("http://localhost"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 (no upgrade), got %d", code)
+	}
+
+	ssePubSub.SetWebSocketOrigins("https://app.example")
+	if code := request("https://app.example"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 (no upgrade), got %d", code)
+	}
+	if code := request("https://evil.example"); code != http.StatusForbidden {
+		t.Errorf("Expected 403, got %d", code)
+	}
+}
+
+func TestWebSocket_InvalidControlFrame(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+
+	server := startWSServer(ssePubSub)
+	defer server.Close()
+
+	ws := dialTestWS(t, server, client.GetID())
+	ws.waitFor(t, func(d eventData) bool { return true })
+
+	// A ping with more than 125 bytes closes the connection
+	ws.write(t, wsOpPing, make([]byte, 126))
+	ws.expectClose(t, wsCloseProtocol)
+}
+
+// TestWebSocket_ProtocolError tests that frames which violate RFC 6455 close the connection with 1002.
+func TestWebSocket_ProtocolError(t *testing.T) {
+	ping := []byte(`{"action":"ping"}`)
+	tests := []struct {
+		name   string
+		frames func(t *testing.T, ws *testWSClient)
+	}{
+		{"RSV1 bit", func(t *testing.T, ws *testWSClient) { ws.writeRaw(t, 0x80|0x40|wsOpText, ping) }},
+		{"RSV3 bit", func(t *testing.T, ws *testWSClient) { ws.writeRaw(t, 0x80|0x10|wsOpText, ping) }},
+		{"reserved data opcode", func(t *testing.T, ws *testWSClient) { ws.write(t, 0x3, ping) }},
+		{"reserved control opcode", func(t *testing.T, ws *testWSClient) { ws.write(t, 0xb, nil) }},
+		{"continuation without message", func(t *testing.T, ws *testWSClient) { ws.write(t, wsOpContinuation, ping) }},
+		{"new message while fragmented", func(t *testing.T, ws *testWSClient) {
+			ws.writeRaw(t, wsOpText, ping[:5])
+			ws.write(t, wsOpText, ping)
+		}},
+		{"invalid close frame", func(t *testing.T, ws *testWSClient) { ws.write(t, wsOpClose, []byte{0x03}) }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ssePubSub := NewSSEPubSubService()
+			client := ssePubSub.NewClient()
+			server := startWSServer(ssePubSub)
+			defer server.Close()
+
+			ws := dialTestWS(t, server, client.GetID())
+			ws.waitFor(t, func(d eventData) bool { return true })
+
+			test.frames(t, ws)
+			ws.expectClose(t, wsCloseProtocol)
+		})
+	}
+}
+
+// TestWebSocket_Close tests that the close frame of the browser is echoed.
+func TestWebSocket_Close(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	server := startWSServer(ssePubSub)
+	defer server.Close()
+
+	ws := dialTestWS(t, server, client.GetID())
+	ws.waitFor(t, func(d eventData) bool { return true })
+
+	ws.write(t, wsOpClose, []byte{0x03, 0xe9, 'b', 'y', 'e'}) // 1001: going away
+	ws.expectClose(t, []byte{0x03, 0xe9})
+
+	// Only one close frame is sent
+	ws.conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := ws.reader.ReadByte(); err == nil {
+		t.Error("Expected no frame after the close frame")
+	}
+}
+
+// TestWebSocket_Fragmented tests that fragmented messages are joined.
+func TestWebSocket_Fragmented(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+	server := startWSServer(ssePubSub)
+	defer server.Close()
+
+	ws := dialTestWS(t, server, client.GetID())
+	ws.waitFor(t, func(d eventData) bool { return true })
+
+	ws.writeRaw(t, wsOpText, []byte(`{"action":`))
+	ws.write(t, wsOpPing, nil) // Control frames may be sent between the fragments
+	ws.write(t, wsOpContinuation, []byte(`"ping"}`))
+	ws.waitFor(t, func(d eventData) bool { return hasSys(d, "pong") })
+}
+
+func TestWebSocket_NoUpgrade(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	client := ssePubSub.NewClient()
+
+	w := httptest.NewRecorder()
+	WebSocket(ssePubSub, w, httptest.NewRequest("GET", "/ws?client_id="+client.GetID(), nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+}
+
+func TestSSEToWebSocket(t *testing.T) {
+	// The id is added to the message
+	opcode, payload, ok := sseToWebSocket("id: a=1\nevent: x\ndata: {\"a\":\ndata: 1}\n\n")
+	if !ok || opcode != wsOpText || string(payload) != "{\"id\":\"a=1\",\"a\":\n1}" {
+		t.Errorf("Unexpected message %d %q", opcode, payload)
+	}
+	if _, payload, _ := sseToWebSocket("id: a=1\ndata: {}\n\n"); string(payload) != `{"id":"a=1"}` {
+		t.Errorf("Unexpected message %q", payload)
+	}
+	if _, payload, _ := sseToWebSocket("data: {\"a\":1}\n\n"); string(payload) != `{"a":1}` {
+		t.Errorf("Unexpected message %q", payload)
+	}
+	if opcode, _, ok := sseToWebSocket(": ping\n\n"); !ok || opcode != wsOpPing {
+		t.Error("Expected heartbeat as ping")
+	}
+	if _, _, ok := sseToWebSocket("retry: 1000\n\n"); ok {
+		t.Error("Expected retry directive to be skipped")
+	}
+}
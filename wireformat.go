@@ -0,0 +1,140 @@
+package pubsubsse
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WireFormat defines how messages are written to the event stream.
+type WireFormat int
+
+const (
+	// Every frame is an unnamed SSE message with the eventData JSON envelope ({"sys": [...], "updates": [...]}).
+	WireEnvelope WireFormat = iota
+	// Updates are SSE events named after their topic (or the event name of the topic)
+	// with the published data as data. Sys messages are "sys" events with the eventData JSON envelope.
+	// Browsers can use addEventListener("server/status", ...) directly.
+	WireNamedEvents
+)
+
+// SysEventName is the SSE event name of sys messages in the named events wire format.
+const SysEventName = "sys"
+
+// String returns the name of the wire format.
+func (f WireFormat) String() string {
+	switch f {
+	case WireEnvelope:
+		return "envelope"
+	case WireNamedEvents:
+		return "named_events"
+	}
+	return "unknown"
+}
+
+// Get the wire format of the event streams
+func (s *SSEPubSubService) GetWireFormat() WireFormat {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.wireFormat
+}
+
+// Set the wire format of the event streams.
+// Streams which are already open keep their wire format.
+func (s *SSEPubSubService) SetWireFormat(f WireFormat) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.wireFormat = f
+}
+
+// Get the reconnection time sent to the browser
+func (s *SSEPubSubService) GetRetry() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.retry
+}
+
+// Set the reconnection time sent to the browser as SSE retry directive when a stream starts.
+// 0 sends no retry directive, so the browser uses its default.
+func (s *SSEPubSubService) SetRetry(d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.retry = d
+}
+
+// Get the SSE event name of the updates of the topic
+func (t *Topic) GetEventName() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.eventName == "" {
+		return t.name
+	}
+	return t.eventName
+}
+
+// Set the SSE event name of the updates of the topic. Empty resets it to the topic name.
+// The event name is only used in the named events wire format.
+// An error wrapping ErrInvalidEventName is returned if the name contains a line break.
+func (t *Topic) SetEventName(name string) error {
+	if err := validateEventName(name); err != nil {
+		return err
+	}
+
+	t.lock.Lock()
+	t.eventName = name
+	t.lock.Unlock()
+
+	t.publishBackplaneOptions()
+	return nil
+}
+
+// Check if the event name fits into the event line of an SSE frame
+func validateEventName(name string) error {
+	if strings.ContainsAny(name, "\r\n") {
+		return detailError(ErrInvalidEventName, "%q contains a line break", name)
+	}
+	return nil
+}
+
+// Build an SSE frame.
+// Multi-line data is split into multiple data lines.
+// Line breaks in the event name are removed, e.g. of a topic name used as event name.
+func sseFrame(id, event, data string) string {
+	var sb strings.Builder
+	if id != "" {
+		sb.WriteString("id: " + id + "\n")
+	}
+	if event != "" {
+		sb.WriteString("event: " + strings.NewReplacer("\r", "", "\n", "").Replace(event) + "\n")
+	}
+	for _, line := range strings.Split(data, "\n") {
+		sb.WriteString("data: " + strings.TrimSuffix(line, "\r") + "\n")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// Build the SSE retry directive
+func sseRetry(d time.Duration) string {
+	return "retry: " + strconv.FormatInt(d.Milliseconds(), 10) + "\n\n"
+}
+
+// Get the data of an SSE frame. Multiple data lines are joined.
+// ok is false if the frame has no data, e.g. a comment or the retry directive.
+func sseData(frame string) (data string, ok bool) {
+	lines := []string{}
+	for _, line := range strings.Split(frame, "\n") {
+		if strings.HasPrefix(line, "data: ") {
+			lines = append(lines, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	if len(lines) == 0 {
+		return "", false
+	}
+	return strings.Join(lines, "\n"), true
+}
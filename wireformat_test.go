@@ -0,0 +1,160 @@
+package pubsubsse
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests for:
+// +SetWireFormat(f WireFormat)
+// +SetRetry(d Duration)
+// +SetEventName(name string): error
+// +GetEventName(): string
+// +PubEvent(event string, msg interface): error
+// -sseFrame(id, event, data string): string
+
+// Read the next frame
+func nextFrame(t *testing.T, frames chan string) string {
+	t.Helper()
+	select {
+	case frame := <-frames:
+		return frame
+	case <-time.After(time.Second):
+		t.Fatal("No frame received")
+	}
+	return ""
+}
+
+// Get the value of a field of an SSE frame
+func frameField(frame, field string) string {
+	for _, line := range strings.Split(frame, "\n") {
+		if strings.HasPrefix(line, field+": ") {
+			return strings.TrimPrefix(line, field+": ")
+		}
+	}
+	return ""
+}
+
+func TestSSEFrame(t *testing.T) {
+	frame := sseFrame("a=1", "news", "line1\nline2")
+	expected := "id: a=1\nevent: news\ndata: line1\ndata: line2\n\n"
+	if frame != expected {
+		t.Errorf("Expected %q, got %q", expected, frame)
+	}
+
+	if frame := sseFrame("", "", "{}"); frame != "data: {}\n\n" {
+		t.Errorf("Expected unnamed frame without id, got %q", frame)
+	}
+}
+
+func TestWireFormat_Default(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	if ssePubSub.GetWireFormat() != WireEnvelope {
+		t.Error("Expected envelope wire format by default")
+	}
+	if ssePubSub.GetRetry() != 0 {
+		t.Error("Expected no retry directive by default")
+	}
+
+	topic := ssePubSub.NewPublicTopic("news")
+	client := ssePubSub.NewClient()
+	client.Sub(topic)
+	frames, cancel := resumeClient(client, "")
+	defer cancel()
+
+	nextFrame(t, frames) // Init message
+	topic.Pub("hello")
+
+	frame := nextFrame(t, frames)
+	if frameField(frame, "event") != "" {
+		t.Errorf("Expected unnamed frame, got %q", frame)
+	}
+	_, data := parseFrame(t, frame)
+	if len(data.Updates) != 1 || data.Updates[0].Data != "hello" {
+		t.Errorf("Expected envelope with update, got %q", frame)
+	}
+}
+
+func TestWireFormat_NamedEvents(t *testing.T) {
+	ssePubSub := NewSSEPubSubService()
+	ssePubSub.SetWireFormat(WireNamedEvents)
+	ssePubSub.SetRetry(3 * time.Second)
+
+	status := ssePubSub.NewPublicTopic("server/status")
+	status.SetRetained(true)
+	status.Pub("up")
+
+	client := ssePubSub.NewClient()
+	client.Sub(status)
+	frames, cancel := resumeClient(client, "")
+	defer cancel()
+
+	// Retry directive
+	if frame := nextFrame(t, frames); frame != "retry: 3000\n\n" {
+		t.Errorf("Expected retry directive, got %q", frame)
+	}
+
+	// Init message as sys event
+	frame := nextFrame(t, frames)
+	if frameField(frame, "event") != SysEventName {
+		t.Errorf("Expected sys event, got %q", frame)
+	}
+	_, data := parseFrame(t, frame)
+	if len(data.Updates) != 0 {
+		t.Error("Expected retained values as events of their own")
+	}
+
+	// Retained value
+	frame = nextFrame(t, frames)
+	if frameField(frame, "event") != "server/status" || frameField(frame, "data") != `"up"` {
+		t.Errorf("Expected retained value as named event, got %q", frame)
+	}
+
+	// Update with the topic name
+	status.Pub("down")
+	frame = nextFrame(t, frames)
+	if frameField(frame, "event") != "server/status" || frameField(frame, "data") != `"down"` {
+		t.Errorf("Expected named event, got %q", frame)
+	}
+	if frameField(frame, "id") == "" {
+		t.Error("Expected id in named event")
+	}
+
+	// Event name of the topic
+	status.SetEventName("status")
+	if status.GetEventName() != "status" {
+		t.Errorf("Expected event name status, got %s", status.GetEventName())
+	}
+	status.Pub("up")
+	if frame := nextFrame(t, frames); frameField(frame, "event") != "status" {
+		t.Errorf("Expected event status, got %q", frame)
+	}
+
+	// Per message override
+	status.PubEvent("alert", map[string]string{"level": "high"})
+	frame = nextFrame(t, frames)
+	if frameField(frame, "event") != "alert" || frameField(frame, "data") != `{"level":"high"}` {
+		t.Errorf("Expected event alert, got %q", frame)
+	}
+
+	status.SetEventName("")
+	if status.GetEventName() != "server/status" {
+		t.Errorf("Expected event name to be reset, got %s", status.GetEventName())
+	}
+
+	// Event names with line breaks would inject fields into the frame
+	if err := status.SetEventName("status\ndata: injected"); !errors.Is(err, ErrInvalidEventName) {
+		t.Errorf("Expected ErrInvalidEventName, got %v", err)
+	}
+	if status.GetEventName() != "server/status" {
+		t.Errorf("Expected event name to be unchanged, got %s", status.GetEventName())
+	}
+	if err := status.PubEvent("alert\r\nid: 1", "x"); !errors.Is(err, ErrInvalidEventName) {
+		t.Errorf("Expected ErrInvalidEventName, got %v", err)
+	}
+	if frame := sseFrame("", "a\nb", "x"); frame != "event: ab\ndata: x\n\n" {
+		t.Errorf("Expected line breaks to be removed from the event, got %q", frame)
+	}
+}